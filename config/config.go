@@ -0,0 +1,211 @@
+// Package config reads service settings from the environment.
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config store backends selectable through CONFIG_STORE.
+const (
+	StoreFile          = "file"
+	StoreElasticsearch = "elasticsearch"
+	StoreBolt          = "bolt"
+)
+
+// Config holds the settings the service is started with.
+type Config struct {
+	// ListenAddr is the address the HTTP server listens on.
+	ListenAddr string
+	// ShutdownGracePeriod is how long in-flight requests, including document
+	// batches and migrations, may run after SIGTERM before the server closes
+	// their connections.
+	ShutdownGracePeriod time.Duration
+	// ShutdownReadinessDelay is how long /readyz fails after SIGTERM before
+	// the server stops accepting connections, so that load balancers notice.
+	ShutdownReadinessDelay time.Duration
+
+	// RequireAPIKeys makes every route except /metrics, /healthz and /readyz
+	// require an API key.
+	RequireAPIKeys bool
+	// AdminAPIKey is granted every action on every index. It is meant for
+	// creating the first API keys and for break-glass access.
+	AdminAPIKey string
+	// TenantTokenSecret signs tenant tokens. Backends holding it can mint
+	// tokens themselves; empty disables tenant tokens.
+	TenantTokenSecret string
+
+	// RateLimits is the sustained number of requests per second each caller
+	// may make on each index, by budget: search, write and admin. Zero
+	// disables a budget.
+	RateLimits map[string]float64
+	// RateBursts is how many requests of each budget may be made at once.
+	RateBursts map[string]int
+	// DocumentsPerDay is how many documents each caller may write to each
+	// index per UTC day; zero means no quota. API keys can override it.
+	DocumentsPerDay int64
+
+	// ConfigStore selects the configuration backend: file, elasticsearch or bolt.
+	ConfigStore string
+	// ConfigStorePath is the file used by the file and bolt backends.
+	ConfigStorePath string
+	// ConfigIndex is the system index used by the elasticsearch backend.
+	ConfigIndex string
+	// AuditStore selects where configuration changes are recorded: file or
+	// elasticsearch.
+	AuditStore string
+	// AuditLogPath is the file used by the file audit log.
+	AuditLogPath string
+	// AuditIndex is the system index used by the elasticsearch audit log.
+	AuditIndex string
+	// LegacyMappingsFile is imported into the config store on startup when
+	// it exists.
+	LegacyMappingsFile string
+	// DiscoverIndices makes startup infer the mapping of every *_ReadAlias
+	// alias found in the cluster.
+	DiscoverIndices bool
+
+	// ESMaxRetries is how often a failed Elasticsearch request is retried.
+	ESMaxRetries int
+	// ESRetryBackoff and ESRetryMaxBackoff bound the jittered exponential
+	// backoff between retries.
+	ESRetryBackoff    time.Duration
+	ESRetryMaxBackoff time.Duration
+	// ESBreakerThreshold consecutive failures open the circuit breaker for
+	// ESBreakerCooldown; zero disables it.
+	ESBreakerThreshold int
+	ESBreakerCooldown  time.Duration
+	// ESTimeouts bounds Elasticsearch operations by class: search, read,
+	// write, bulk, admin and task (reindex and by-query requests).
+	ESTimeouts map[string]time.Duration
+	// Deadlines bounds whole requests by endpoint group: search, facets,
+	// documents and admin. Searches and facets that run into their deadline
+	// return partial results where Elasticsearch allows it.
+	Deadlines map[string]time.Duration
+
+	// LogLevel is the minimum level logged: debug, info, warn or error.
+	LogLevel string
+	// LogFormat is json or text.
+	LogFormat string
+	// LogRedactFields lists document field paths whose values are masked
+	// in logged queries. Document content is never logged.
+	LogRedactFields []string
+	// LogQueriesFor lists the logical indices whose generated Elasticsearch
+	// queries are logged.
+	LogQueriesFor []string
+
+	// TraceExporter is none, stdout or otlp.
+	TraceExporter string
+	// TraceSampleRatio is the share of new traces recorded, from 0 to 1.
+	TraceSampleRatio float64
+}
+
+// Load returns the configuration taken from environment variables, falling
+// back to defaults suitable for local development.
+func Load() Config {
+	return Config{
+		ListenAddr:             getEnv("LISTEN_ADDR", ":1234"),
+		ShutdownGracePeriod:    getEnvDuration("SHUTDOWN_GRACE_PERIOD", 30*time.Second),
+		ShutdownReadinessDelay: getEnvDuration("SHUTDOWN_READINESS_DELAY", 5*time.Second),
+		RequireAPIKeys:         getEnvBool("AUTH_REQUIRE_API_KEYS", true),
+		AdminAPIKey:            os.Getenv("AUTH_ADMIN_KEY"),
+		TenantTokenSecret:      os.Getenv("TENANT_TOKEN_SECRET"),
+		RateLimits: map[string]float64{
+			"search": getEnvFloat("RATE_LIMIT_SEARCH", 50),
+			"write":  getEnvFloat("RATE_LIMIT_WRITE", 20),
+			"admin":  getEnvFloat("RATE_LIMIT_ADMIN", 5),
+		},
+		RateBursts: map[string]int{
+			"search": getEnvInt("RATE_BURST_SEARCH", 100),
+			"write":  getEnvInt("RATE_BURST_WRITE", 40),
+			"admin":  getEnvInt("RATE_BURST_ADMIN", 10),
+		},
+		DocumentsPerDay:    int64(getEnvInt("QUOTA_DOCUMENTS_PER_DAY", 0)),
+		ConfigStore:        getEnv("CONFIG_STORE", StoreFile),
+		ConfigStorePath:    getEnv("CONFIG_STORE_PATH", "config_store.json"),
+		ConfigIndex:        getEnv("CONFIG_STORE_INDEX", ".config-service"),
+		AuditStore:         getEnv("AUDIT_STORE", StoreFile),
+		AuditLogPath:       getEnv("AUDIT_LOG_PATH", "audit.log"),
+		AuditIndex:         getEnv("AUDIT_INDEX", ".config-service-audit"),
+		LegacyMappingsFile: getEnv("MAPPINGS_FILE", "es_mappings.json"),
+		DiscoverIndices:    getEnvBool("BOOTSTRAP_DISCOVER", false),
+		ESMaxRetries:       getEnvInt("ES_MAX_RETRIES", 3),
+		ESRetryBackoff:     getEnvDuration("ES_RETRY_BACKOFF", 100*time.Millisecond),
+		ESRetryMaxBackoff:  getEnvDuration("ES_RETRY_MAX_BACKOFF", 2*time.Second),
+		ESBreakerThreshold: getEnvInt("ES_BREAKER_THRESHOLD", 5),
+		ESBreakerCooldown:  getEnvDuration("ES_BREAKER_COOLDOWN", 30*time.Second),
+		ESTimeouts: map[string]time.Duration{
+			"search": getEnvDuration("ES_TIMEOUT_SEARCH", 10*time.Second),
+			"read":   getEnvDuration("ES_TIMEOUT_READ", 5*time.Second),
+			"write":  getEnvDuration("ES_TIMEOUT_WRITE", 10*time.Second),
+			"bulk":   getEnvDuration("ES_TIMEOUT_BULK", time.Minute),
+			"admin":  getEnvDuration("ES_TIMEOUT_ADMIN", 30*time.Second),
+			"task":   getEnvDuration("ES_TIMEOUT_TASK", 30*time.Minute),
+		},
+		Deadlines: map[string]time.Duration{
+			"search":    getEnvDuration("DEADLINE_SEARCH", 10*time.Second),
+			"facets":    getEnvDuration("DEADLINE_FACETS", 10*time.Second),
+			"documents": getEnvDuration("DEADLINE_DOCUMENTS", 15*time.Second),
+			"admin":     getEnvDuration("DEADLINE_ADMIN", 0),
+		},
+		LogLevel:         getEnv("LOG_LEVEL", "info"),
+		LogFormat:        getEnv("LOG_FORMAT", "json"),
+		LogRedactFields:  getEnvList("LOG_REDACT_FIELDS"),
+		LogQueriesFor:    getEnvList("LOG_QUERIES_FOR"),
+		TraceExporter:    getEnv("TRACE_EXPORTER", "none"),
+		TraceSampleRatio: getEnvFloat("TRACE_SAMPLE_RATIO", 1),
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	v, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+func getEnvInt(key string, fallback int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+// getEnvDuration accepts Go duration strings such as "500ms" or "2m".
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+// getEnvList splits a comma separated variable, dropping empty entries.
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
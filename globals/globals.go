@@ -1,5 +0,0 @@
-package globals
-
-import "elastic-search-config-service/models"
-
-var ESIndexMappings map[string]models.MappingInfo
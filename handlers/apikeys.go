@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"elastic-search-config-service/middleware"
+	"elastic-search-config-service/models"
+	"elastic-search-config-service/services"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateAPIKey creates a key scoped to actions and index patterns. The secret
+// is part of the response and is never shown again.
+func CreateAPIKey(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.CreateAPIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+
+		caller, _ := middleware.APIKeyFromContext(r.Context())
+		created, err := esClient.CreateAPIKey(r.Context(), req, caller.ID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, created)
+	}
+}
+
+// ListAPIKeys lists every key with its scopes and audit fields.
+func ListAPIKeys(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys, err := esClient.ListAPIKeys(r.Context())
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, keys)
+	}
+}
+
+// GetAPIKey returns a single key with its scopes and audit fields.
+func GetAPIKey(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		keyID := vars["key_id"]
+
+		key, err := esClient.GetAPIKey(r.Context(), keyID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, key)
+	}
+}
+
+// RevokeAPIKey disables a key for good.
+func RevokeAPIKey(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		keyID := vars["key_id"]
+
+		caller, _ := middleware.APIKeyFromContext(r.Context())
+		key, err := esClient.RevokeAPIKey(r.Context(), keyID, caller.ID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, key)
+	}
+}
@@ -3,7 +3,6 @@ package handlers
 import (
 	"elastic-search-config-service/models"
 	"elastic-search-config-service/services"
-	"encoding/json"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -15,19 +14,12 @@ func GetIndexAttributesHandler(esClient *services.ElasticsearchClient) http.Hand
 		indexName := vars["index_name"]
 
 		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
-		attributes, err := esClient.GetIndexAttributes(ind)
+		attributes, err := esClient.GetIndexAttributes(r.Context(), ind)
 		if err != nil {
-			http.Error(w, "Error fetching index attributes: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
-		jsonResponse, err := json.Marshal(attributes)
-		if err != nil {
-			http.Error(w, "Error converting response to JSON: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(jsonResponse)
+		writeJSON(w, http.StatusOK, attributes)
 	}
 }
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"elastic-search-config-service/models"
+	"elastic-search-config-service/services"
+)
+
+// GetAuditLog lists recorded configuration changes, newest first. They can
+// be filtered by index, actor and operation, and bounded in time with from
+// and to as RFC 3339 timestamps; limit caps how many are returned.
+func GetAuditLog(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		q := models.AuditQuery{
+			Index:     params.Get("index"),
+			Actor:     params.Get("actor"),
+			Operation: params.Get("operation"),
+		}
+		var err error
+		if q.From, err = timeParam(params, "from"); err != nil {
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+		if q.To, err = timeParam(params, "to"); err != nil {
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+		if value := params.Get("limit"); value != "" {
+			if q.Limit, err = strconv.Atoi(value); err != nil || q.Limit < 1 {
+				writeBadRequest(w, r, "limit must be a positive integer")
+				return
+			}
+		}
+
+		entries, err := esClient.QueryAudit(r.Context(), q)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, entries)
+	}
+}
+
+// timeParam parses an optional RFC 3339 query parameter.
+func timeParam(params url.Values, name string) (time.Time, error) {
+	value := params.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+	}
+	return t, nil
+}
@@ -9,34 +9,32 @@ import (
 	"github.com/gorilla/mux"
 )
 
-// TODO: add dynamic update support using scripts
+// ChangeMappings updates searchable and facet attributes of an index and
+// adds new fields to its mapping.
 func ChangeMappings(esClient *services.ElasticsearchClient) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		indexName := vars["index_name"]
 
-		var settings models.IndexSettings
-		err := json.NewDecoder(r.Body).Decode(&settings)
+		var change models.MappingChange
+		err := json.NewDecoder(r.Body).Decode(&change)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeBadRequest(w, r, err.Error())
 			return
 		}
-		// TODO: add verification for fields names here whether they are present in mappings
-		// we can call GetIndexAttributes from within services
-		// give implementation below
 
 		// validating if some field info passed or not else return
-		if len(settings.SearchableAttributes) == 0 && len(settings.FacetAttributes) == 0 {
-			http.Error(w, "non empty index settings not allowed", http.StatusBadRequest)
+		if len(change.SearchableAttributes) == 0 && len(change.FacetAttributes) == 0 && len(change.Fields) == 0 {
+			writeBadRequest(w, r, "non empty index settings not allowed")
+			return
 		}
 		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
-		err = esClient.ChangeMappings(ind, settings)
+		result, err := esClient.ChangeMappings(r.Context(), ind, change)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Mappings for index changed successfully"})
+		writeJSON(w, http.StatusCreated, result)
 	}
 }
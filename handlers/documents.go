@@ -18,19 +18,205 @@ func PostDocuments(esClient *services.ElasticsearchClient) http.HandlerFunc {
 		var documents []models.Document
 		err := json.NewDecoder(r.Body).Decode(&documents)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+
+		if !consumeDocumentQuota(w, r, esClient, indexName, len(documents)) {
 			return
 		}
 
 		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
 		// we will do write on write aliases
-		err = esClient.IndexDocuments(ind.WriteAlias, documents)
+		err = esClient.IndexDocuments(r.Context(), ind, documents)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, map[string]string{"message": "Documents indexed successfully"})
+	}
+}
+
+// GetDocument returns a single document with its version as an ETag.
+func GetDocument(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		indexName := vars["index_name"]
+
+		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
+		_, access := callerRestrictions(r)
+		doc, err := esClient.GetDocument(r.Context(), ind, vars["id"], access)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("ETag", formatETag(doc.Version))
+		writeJSON(w, http.StatusOK, doc)
+	}
+}
+
+// PutDocument creates or replaces a document. The body is the document content.
+func PutDocument(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		indexName := vars["index_name"]
+
+		cond, err := parseWriteCondition(r)
+		if err != nil {
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+
+		var content interface{}
+		err = json.NewDecoder(r.Body).Decode(&content)
+		if err != nil {
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+
+		if !consumeDocumentQuota(w, r, esClient, indexName, 1) {
+			return
+		}
+
+		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
+		result, err := esClient.PutDocument(r.Context(), ind, vars["id"], content, cond)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		status := http.StatusOK
+		if result.Result == "created" {
+			status = http.StatusCreated
+		}
+		w.Header().Set("ETag", formatETag(result.Version))
+		writeJSON(w, status, result)
+	}
+}
+
+// PatchDocument merges the body into the content of an existing document.
+// With ?upsert=true a missing document is created from the body.
+func PatchDocument(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		indexName := vars["index_name"]
+
+		cond, err := parseWriteCondition(r)
+		if err != nil {
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+		if cond.IfNoneMatch {
+			writeBadRequest(w, r, "If-None-Match is not supported for partial updates, use PUT")
+			return
+		}
+		upsert, err := parseBoolQuery(r, "upsert")
+		if err != nil {
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+
+		var partial map[string]interface{}
+		err = json.NewDecoder(r.Body).Decode(&partial)
+		if err != nil {
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+
+		if !consumeDocumentQuota(w, r, esClient, indexName, 1) {
+			return
+		}
+
+		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
+		result, err := esClient.UpdateDocument(r.Context(), ind, vars["id"], partial, upsert, cond)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		status := http.StatusOK
+		if result.Result == "created" {
+			status = http.StatusCreated
+		}
+		w.Header().Set("ETag", formatETag(result.Version))
+		writeJSON(w, status, result)
+	}
+}
+
+// DeleteDocument removes a single document.
+func DeleteDocument(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		indexName := vars["index_name"]
+
+		cond, err := parseWriteCondition(r)
+		if err != nil {
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+		if cond.IfNoneMatch {
+			writeBadRequest(w, r, "If-None-Match is not supported for deletes")
+			return
+		}
+
+		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
+		result, err := esClient.DeleteDocument(r.Context(), ind, vars["id"], cond)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// MultiGetDocuments returns several documents by ID, listing the missing ones.
+func MultiGetDocuments(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		indexName := vars["index_name"]
+
+		var req models.MultiGetRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+
+		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
+		_, access := callerRestrictions(r)
+		docs, err := esClient.MultiGetDocuments(r.Context(), ind, req.IDs, access)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, docs)
+	}
+}
+
+// DeleteDocumentsByQuery deletes every document matching the filter.
+func DeleteDocumentsByQuery(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		indexName := vars["index_name"]
+
+		var req models.DeleteByQueryRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+
+		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
+		result, err := esClient.DeleteDocumentsByQuery(r.Context(), ind, req.Filter)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Documents indexed successfully"})
+		writeJSON(w, http.StatusOK, result)
 	}
 }
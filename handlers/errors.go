@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"elastic-search-config-service/middleware"
+	"elastic-search-config-service/models"
+	"elastic-search-config-service/services"
+)
+
+// statusClientClosedRequest is the non-standard status logged when the client
+// disconnected before a response could be written.
+const statusClientClosedRequest = 499
+
+// errorStatus maps a services error onto the HTTP status and error code it
+// should be reported with.
+func errorStatus(err error) (int, string) {
+	switch services.KindOf(err) {
+	case services.ErrIndexNotFound:
+		return http.StatusNotFound, models.ErrCodeIndexNotFound
+	case services.ErrIndexExists:
+		return http.StatusConflict, models.ErrCodeIndexExists
+	case services.ErrDocumentNotFound:
+		return http.StatusNotFound, models.ErrCodeDocumentNotFound
+	case services.ErrAPIKeyNotFound:
+		return http.StatusNotFound, models.ErrCodeAPIKeyNotFound
+	case services.ErrSettingsVersionNotFound:
+		return http.StatusNotFound, models.ErrCodeSettingsVersionNotFound
+	case services.ErrVersionConflict:
+		return http.StatusPreconditionFailed, models.ErrCodeVersionConflict
+	case services.ErrConflict:
+		return http.StatusConflict, models.ErrCodeConflict
+	case services.ErrInvalidRequest:
+		return http.StatusBadRequest, models.ErrCodeInvalidRequest
+	case services.ErrInvalidField:
+		return http.StatusBadRequest, models.ErrCodeInvalidField
+	case services.ErrUpstreamRejected:
+		return http.StatusBadRequest, models.ErrCodeUpstreamRejected
+	case services.ErrQuotaExceeded:
+		return http.StatusTooManyRequests, models.ErrCodeQuotaExceeded
+	case services.ErrUpstreamUnavailable:
+		return http.StatusServiceUnavailable, models.ErrCodeUpstreamUnavailable
+	case services.ErrTimeout:
+		return http.StatusGatewayTimeout, models.ErrCodeTimeout
+	case services.ErrCanceled:
+		return statusClientClosedRequest, models.ErrCodeCanceled
+	default:
+		return http.StatusInternalServerError, models.ErrCodeInternal
+	}
+}
+
+// writeError reports err using the standard error envelope.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status, code := errorStatus(err)
+	if status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "request failed", "code", code, "error", err)
+	}
+
+	var details interface{}
+	var svcErr *services.Error
+	if errors.As(err, &svcErr) {
+		switch {
+		case len(svcErr.Fields) > 0:
+			details = svcErr.Fields
+		case svcErr.Upstream != nil:
+			details = svcErr.Upstream
+		}
+	}
+	writeErrorResponse(w, r, status, code, err.Error(), details)
+}
+
+// writeBadRequest reports a request that could not be decoded or validated.
+func writeBadRequest(w http.ResponseWriter, r *http.Request, message string) {
+	writeErrorResponse(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, message, nil)
+}
+
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, status int, code, message string, details interface{}) {
+	writeJSON(w, status, models.ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: middleware.RequestIDFromContext(r.Context()),
+	})
+}
+
+// writeJSON sets the content type before the status line is written and
+// encodes v as the response body.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// NotFound answers requests that match no route.
+func NotFound() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeErrorResponse(w, r, http.StatusNotFound, models.ErrCodeNotFound, "no route for "+r.URL.Path, nil)
+	}
+}
+
+// MethodNotAllowed answers requests whose path matches a route registered
+// for a different method.
+func MethodNotAllowed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeErrorResponse(w, r, http.StatusMethodNotAllowed, models.ErrCodeMethodNotAllowed, r.Method+" not allowed on "+r.URL.Path, nil)
+	}
+}
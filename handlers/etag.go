@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"elastic-search-config-service/models"
+)
+
+// formatETag encodes a document version as a strong ETag.
+func formatETag(v models.DocumentVersion) string {
+	return fmt.Sprintf(`"%d-%d"`, v.SeqNo, v.PrimaryTerm)
+}
+
+func parseETag(tag string) (models.DocumentVersion, error) {
+	tag = strings.TrimSpace(tag)
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return models.DocumentVersion{}, fmt.Errorf("malformed ETag %s", tag)
+	}
+	seqNo, primaryTerm, ok := strings.Cut(tag[1:len(tag)-1], "-")
+	if !ok {
+		return models.DocumentVersion{}, fmt.Errorf("malformed ETag %s", tag)
+	}
+	var v models.DocumentVersion
+	var err error
+	if v.SeqNo, err = strconv.Atoi(seqNo); err != nil {
+		return models.DocumentVersion{}, fmt.Errorf("malformed ETag %s", tag)
+	}
+	if v.PrimaryTerm, err = strconv.Atoi(primaryTerm); err != nil {
+		return models.DocumentVersion{}, fmt.Errorf("malformed ETag %s", tag)
+	}
+	return v, nil
+}
+
+// parseWriteCondition reads If-Match and If-None-Match. Only a single ETag
+// is accepted for If-Match, and only "*" for If-None-Match.
+func parseWriteCondition(r *http.Request) (models.WriteCondition, error) {
+	var cond models.WriteCondition
+	ifMatch := r.Header.Get("If-Match")
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifMatch != "" && ifNoneMatch != "" {
+		return cond, errors.New("If-Match and If-None-Match cannot be combined")
+	}
+	if ifMatch != "" {
+		v, err := parseETag(ifMatch)
+		if err != nil {
+			return cond, err
+		}
+		cond.IfMatch = &v
+	}
+	if ifNoneMatch != "" {
+		if strings.TrimSpace(ifNoneMatch) != "*" {
+			return cond, errors.New(`only "*" is supported for If-None-Match`)
+		}
+		cond.IfNoneMatch = true
+	}
+	return cond, nil
+}
+
+func parseBoolQuery(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be a boolean", name)
+	}
+	return b, nil
+}
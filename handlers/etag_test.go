@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"elastic-search-config-service/models"
+)
+
+func TestParseETag(t *testing.T) {
+	tests := []struct {
+		name    string
+		tag     string
+		want    models.DocumentVersion
+		wantErr bool
+	}{
+		{name: "strong tag", tag: `"12-3"`, want: models.DocumentVersion{SeqNo: 12, PrimaryTerm: 3}},
+		{name: "surrounding spaces", tag: ` "0-1" `, want: models.DocumentVersion{SeqNo: 0, PrimaryTerm: 1}},
+		{name: "weak tag", tag: `W/"12-3"`, wantErr: true},
+		{name: "unquoted", tag: `12-3`, wantErr: true},
+		{name: "missing primary term", tag: `"12"`, wantErr: true},
+		{name: "not a number", tag: `"twelve-3"`, wantErr: true},
+		{name: "empty", tag: `""`, wantErr: true},
+		{name: "lone quote", tag: `"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseETag(tt.tag)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseETag(%s) = %+v, want an error", tt.tag, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("parseETag(%s) = %+v, want %+v", tt.tag, got, tt.want)
+			}
+			if again, err := parseETag(formatETag(got)); err != nil || again != got {
+				t.Errorf("parsing formatted tag %s = %+v, %v, want %+v", formatETag(got), again, err, got)
+			}
+		})
+	}
+}
+
+func TestParseWriteCondition(t *testing.T) {
+	tests := []struct {
+		name        string
+		ifMatch     string
+		ifNoneMatch string
+		want        models.WriteCondition
+		wantErr     bool
+	}{
+		{name: "unconditional"},
+		{name: "if match", ifMatch: `"7-2"`, want: models.WriteCondition{IfMatch: &models.DocumentVersion{SeqNo: 7, PrimaryTerm: 2}}},
+		{name: "if none match any", ifNoneMatch: "*", want: models.WriteCondition{IfNoneMatch: true}},
+		{name: "both headers", ifMatch: `"7-2"`, ifNoneMatch: "*", wantErr: true},
+		{name: "several tags", ifMatch: `"7-2", "8-2"`, wantErr: true},
+		{name: "if none match a tag", ifNoneMatch: `"7-2"`, wantErr: true},
+		{name: "malformed tag", ifMatch: "7-2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/products/documents/1", nil)
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+
+			got, err := parseWriteCondition(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseWriteCondition = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseWriteCondition = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -17,26 +17,19 @@ func GetFacets(esClient *services.ElasticsearchClient) http.HandlerFunc {
 		var req models.FacetListingRequest
 		err := json.NewDecoder(r.Body).Decode(&req)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeBadRequest(w, r, err.Error())
 			return
 		}
 
-		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
-		// we will do write on write aliases
-		res, err := esClient.GetFacetListing(ind, req)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+		req.TenantFilter, req.FieldAccess = callerRestrictions(r)
 
-		jsonResponse, err := json.Marshal(res)
+		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
+		res, err := esClient.GetFacetListing(r.Context(), ind, req)
 		if err != nil {
-			http.Error(w, "Error converting response to JSON: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(jsonResponse)
+		writeJSON(w, http.StatusOK, res)
 	}
 }
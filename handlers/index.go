@@ -13,18 +13,17 @@ func PostIndex(esClient *services.ElasticsearchClient) http.HandlerFunc {
 		var data models.IndexName
 		err := json.NewDecoder(r.Body).Decode(&data)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeBadRequest(w, r, err.Error())
 			return
 		}
 		ind := models.GetIndexInfo(data)
 		// apply validation on index names here
-		err = esClient.CreateIndexAndAliases(ind)
+		err = esClient.CreateIndexAndAliases(r.Context(), ind, data.Schema)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Index created successfully"})
+		writeJSON(w, http.StatusCreated, map[string]string{"message": "Index created successfully"})
 	}
 }
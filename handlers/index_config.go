@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"elastic-search-config-service/models"
+	"elastic-search-config-service/services"
+
+	"github.com/gorilla/mux"
+)
+
+// ExportIndexConfig returns the configuration of a logical index as a single
+// versioned document accepted by ImportIndexConfig.
+func ExportIndexConfig(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		indexName := vars["index_name"]
+
+		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
+		config, err := esClient.ExportIndexConfig(r.Context(), ind)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, config)
+	}
+}
+
+// ImportIndexConfig applies an exported configuration to a logical index,
+// creating it when missing. With mode=plan it only reports what would
+// change; mode=apply, the default, makes the changes.
+func ImportIndexConfig(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		indexName := vars["index_name"]
+
+		var config models.IndexConfigExport
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+		mode := r.URL.Query().Get("mode")
+		if mode == "" {
+			mode = models.ImportApply
+		}
+
+		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
+		plan, err := esClient.ImportIndexConfig(r.Context(), ind, config, mode)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, plan)
+	}
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"net/http"
+
+	"elastic-search-config-service/services"
+
+	"github.com/gorilla/mux"
+)
+
+// GetMappingCache exposes the mapping registry entry of an index for debugging.
+// It never triggers a load.
+func GetMappingCache(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		indexName := vars["index_name"]
+
+		writeJSON(w, http.StatusOK, esClient.Mappings().Snapshot(indexName))
+	}
+}
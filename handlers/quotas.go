@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"elastic-search-config-service/metrics"
+	"elastic-search-config-service/middleware"
+	"elastic-search-config-service/services"
+)
+
+// consumeDocumentQuota charges n documents against the daily quota of the
+// caller on indexName. When the quota is used up or cannot be checked it
+// answers the request itself and returns false.
+func consumeDocumentQuota(w http.ResponseWriter, r *http.Request, esClient *services.ElasticsearchClient, indexName string, n int) bool {
+	var limit int64
+	if key, ok := middleware.APIKeyFromContext(r.Context()); ok {
+		limit = key.DocumentsPerDay
+	}
+	err := esClient.ConsumeDocumentQuota(r.Context(), middleware.CallerID(r), indexName, n, limit)
+	if err == nil {
+		return true
+	}
+	if services.KindOf(err) == services.ErrQuotaExceeded {
+		metrics.CountRateLimited("quota_documents")
+		now := time.Now().UTC()
+		midnight := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+		w.Header().Set("Retry-After", strconv.Itoa(int(midnight.Sub(now).Seconds())+1))
+	}
+	writeError(w, r, err)
+	return false
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"elastic-search-config-service/middleware"
 	"elastic-search-config-service/models"
 	"elastic-search-config-service/services"
 	"encoding/json"
@@ -17,24 +18,30 @@ func Search(esClient *services.ElasticsearchClient) http.HandlerFunc {
 		var data models.SearchReq
 		err := json.NewDecoder(r.Body).Decode(&data)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeBadRequest(w, r, err.Error())
 			return
 		}
 		data.IndexName = indexName
+		data.TenantFilter, data.FieldAccess = callerRestrictions(r)
 		// apply validation on index names here
-		res, err := esClient.Search(data)
+		res, err := esClient.Search(r.Context(), data)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		jsonResponse, err := json.Marshal(res)
-		if err != nil {
-			http.Error(w, "Error converting response to JSON: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(jsonResponse)
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+// callerRestrictions returns the tenant filter and field rules carried by the
+// API key or tenant token the request was authorized with.
+func callerRestrictions(r *http.Request) (models.Filter, models.FieldAccess) {
+	if tenant, ok := middleware.TenantFromContext(r.Context()); ok {
+		return tenant.Filter, tenant.FieldAccess
+	}
+	if key, ok := middleware.APIKeyFromContext(r.Context()); ok {
+		return nil, key.FieldAccess
 	}
+	return nil, models.FieldAccess{}
 }
@@ -3,26 +3,144 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
+	"elastic-search-config-service/models"
 	"elastic-search-config-service/services"
+
+	"github.com/gorilla/mux"
 )
 
-func PostIndexSettings(esClient *services.ElasticsearchClient) http.HandlerFunc {
+// PutIndexSettings updates dynamic settings of a single logical index.
+func PutIndexSettings(esClient *services.ElasticsearchClient) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		indexName := vars["index_name"]
+
 		var settings map[string]interface{}
 		err := json.NewDecoder(r.Body).Decode(&settings)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+
+		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
+		applied, err := esClient.UpdateIndexSettings(r.Context(), ind, settings)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, applied)
+	}
+}
+
+// GetIndexSettings returns the attributes stored for a logical index.
+func GetIndexSettings(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		indexName := vars["index_name"]
+
+		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
+		settings, err := esClient.GetIndexSettings(r.Context(), ind)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, settings)
+	}
+}
+
+// PutDisplayedAttributes sets the fields search and facets may return. The
+// body is a list of field paths or patterns; an empty list shows every field.
+func PutDisplayedAttributes(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		indexName := vars["index_name"]
+
+		var attributes []string
+		if err := json.NewDecoder(r.Body).Decode(&attributes); err != nil {
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+
+		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
+		settings, err := esClient.UpdateDisplayedAttributes(r.Context(), ind, attributes)
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
+		writeJSON(w, http.StatusOK, settings)
+	}
+}
+
+// GetSettingsHistory lists every accepted settings version of a logical
+// index, oldest first.
+func GetSettingsHistory(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		indexName := vars["index_name"]
+
+		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
+		history, err := esClient.SettingsHistory(r.Context(), ind)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, history)
+	}
+}
+
+// GetSettingsDiff compares the settings versions given by the from and to
+// query parameters; without to, from is compared with the latest version.
+func GetSettingsDiff(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		indexName := vars["index_name"]
+
+		params := r.URL.Query()
+		from, err := strconv.ParseInt(params.Get("from"), 10, 64)
+		if err != nil || from < 1 {
+			writeBadRequest(w, r, "from must be a settings version")
+			return
+		}
+		var to int64
+		if value := params.Get("to"); value != "" {
+			if to, err = strconv.ParseInt(value, 10, 64); err != nil || to < 1 {
+				writeBadRequest(w, r, "to must be a settings version")
+				return
+			}
+		}
 
-		err = esClient.UpdateIndexSettings(settings)
+		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
+		diff, err := esClient.SettingsDiff(r.Context(), ind, from, to)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
+		writeJSON(w, http.StatusOK, diff)
+	}
+}
+
+// RestoreSettingsVersion makes an earlier settings version current again,
+// migrating the index when its mapping has to change.
+func RestoreSettingsVersion(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		indexName := vars["index_name"]
 
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Index settings updated successfully"})
+		version, err := strconv.ParseInt(vars["version"], 10, 64)
+		if err != nil || version < 1 {
+			writeBadRequest(w, r, "version must be a settings version")
+			return
+		}
+
+		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
+		result, err := esClient.RestoreSettingsVersion(r.Context(), ind, version)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
 	}
 }
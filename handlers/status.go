@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+
+	"elastic-search-config-service/models"
+	"elastic-search-config-service/services"
+)
+
+// GetBootstrapStatus reports how the mapping registry was populated at startup.
+func GetBootstrapStatus(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, esClient.BootstrapStatus())
+	}
+}
+
+// GetResilienceStatus reports retry, timeout and circuit breaker counters for
+// requests to Elasticsearch.
+func GetResilienceStatus(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, esClient.ResilienceStats())
+	}
+}
+
+// Healthz answers as long as the process is able to serve HTTP.
+func Healthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": models.CheckOK})
+	}
+}
+
+// Readyz reports 503 until Elasticsearch is reachable with a cluster health
+// other than red and the mapping store is loaded.
+func Readyz(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		readiness := esClient.Readiness(r.Context())
+		status := http.StatusOK
+		if !readiness.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, readiness)
+	}
+}
+
+// GetClusterStatus describes the cluster, the alias topology of every
+// logical index and the work in progress.
+func GetClusterStatus(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, err := esClient.ClusterStatus(r.Context())
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	}
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"elastic-search-config-service/middleware"
+	"elastic-search-config-service/models"
+	"elastic-search-config-service/services"
+)
+
+// CreateTenantToken mints a tenant token limited to indices the calling key
+// may search, with a filter applied to every search made with the token.
+func CreateTenantToken(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.CreateTenantTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+
+		caller, ok := middleware.APIKeyFromContext(r.Context())
+		if !ok {
+			// API keys are not required, so neither is a key to mint with.
+			caller = models.APIKey{ID: services.AdminAPIKeyID, Actions: models.Actions, Indices: []string{"*"}}
+		}
+		token, err := esClient.MintTenantToken(r.Context(), req, caller)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, token)
+	}
+}
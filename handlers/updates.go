@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"elastic-search-config-service/models"
+	"elastic-search-config-service/services"
+
+	"github.com/gorilla/mux"
+)
+
+// ScriptUpdateDocument applies a single scripted field update to a document,
+// e.g. appending a review or bumping a counter.
+func ScriptUpdateDocument(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		indexName := vars["index_name"]
+
+		cond, err := parseWriteCondition(r)
+		if err != nil {
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+		if cond.IfNoneMatch {
+			writeBadRequest(w, r, "If-None-Match is not supported for updates")
+			return
+		}
+
+		var update models.FieldUpdate
+		err = json.NewDecoder(r.Body).Decode(&update)
+		if err != nil {
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+
+		if !consumeDocumentQuota(w, r, esClient, indexName, 1) {
+			return
+		}
+
+		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
+		result, err := esClient.ScriptUpdateDocument(r.Context(), ind, vars["id"], update, cond)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		w.Header().Set("ETag", formatETag(result.Version))
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// UpdateDocumentsByQuery applies a scripted field update to every document
+// matching the filter.
+func UpdateDocumentsByQuery(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		indexName := vars["index_name"]
+
+		var req models.UpdateByQueryRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			writeBadRequest(w, r, err.Error())
+			return
+		}
+
+		ind := models.GetIndexInfo(models.IndexName{Index: indexName})
+		result, err := esClient.UpdateDocumentsByQuery(r.Context(), ind, req.Filter, req.Update)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// GetManagedScripts lists the stored scripts backing scripted updates.
+func GetManagedScripts(esClient *services.ElasticsearchClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, esClient.ManagedScripts())
+	}
+}
@@ -0,0 +1,144 @@
+// Package logging configures the structured logger used across the service.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+
+	"elastic-search-config-service/middleware"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redacted replaces every value the logger must not write out.
+const Redacted = "[REDACTED]"
+
+// alwaysRedacted are attribute keys that hold document bodies.
+var alwaysRedacted = map[string]struct{}{
+	"content":  {},
+	"document": {},
+	"_source":  {},
+}
+
+// Options controls the logger built by New.
+type Options struct {
+	// Level is the minimum level written.
+	Level slog.Level
+	// JSON selects JSON output; otherwise logfmt style text is written.
+	JSON bool
+	// RedactFields lists document field paths, e.g. "content.email", whose
+	// values are replaced wherever they show up in logged queries.
+	RedactFields []string
+}
+
+// New returns a logger writing to w that tags records with the request ID
+// found in the context and redacts document content.
+func New(w io.Writer, opts Options) *slog.Logger {
+	r := redactor{fields: opts.RedactFields}
+	handlerOpts := &slog.HandlerOptions{
+		Level:       opts.Level,
+		ReplaceAttr: r.replaceAttr,
+	}
+	var h slog.Handler
+	if opts.JSON {
+		h = slog.NewJSONHandler(w, handlerOpts)
+	} else {
+		h = slog.NewTextHandler(w, handlerOpts)
+	}
+	return slog.New(contextHandler{Handler: h})
+}
+
+// ParseLevel accepts debug, info, warn or error, defaulting to info.
+func ParseLevel(s string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// contextHandler adds the request ID and trace carried by the context to
+// each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if id := middleware.RequestIDFromContext(ctx); id != "" {
+		rec.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		rec.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+type redactor struct {
+	fields []string
+}
+
+func (r redactor) replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if _, ok := alwaysRedacted[a.Key]; ok || r.redacts(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	if a.Value.Kind() == slog.KindAny {
+		switch v := a.Value.Any().(type) {
+		case map[string]interface{}, []interface{}, []map[string]interface{}:
+			return slog.Any(a.Key, r.redactValue(v))
+		}
+	}
+	return a
+}
+
+// redactValue returns a copy of v with redacted keys masked. The original is
+// left untouched since it is usually about to be sent to Elasticsearch.
+func (r redactor) redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, child := range t {
+			if r.redacts(k) {
+				out[k] = Redacted
+				continue
+			}
+			out[k] = r.redactValue(child)
+		}
+		return out
+	case []map[string]interface{}:
+		out := make([]interface{}, len(t))
+		for i, child := range t {
+			out[i] = r.redactValue(child)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, child := range t {
+			out[i] = r.redactValue(child)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// redacts reports whether the value under key must be hidden. Configured
+// fields match themselves, their sub-fields and multi-fields such as
+// "content.email.keyword".
+func (r redactor) redacts(key string) bool {
+	for _, field := range r.fields {
+		if key == field || strings.HasPrefix(key, field+".") {
+			return true
+		}
+	}
+	return false
+}
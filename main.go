@@ -1,16 +1,27 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io/fs"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"elastic-search-config-service/globals"
+	"elastic-search-config-service/config"
+	"elastic-search-config-service/logging"
+	"elastic-search-config-service/metrics"
+	"elastic-search-config-service/middleware"
 	"elastic-search-config-service/models"
 	"elastic-search-config-service/router"
 	"elastic-search-config-service/services"
+	"elastic-search-config-service/store"
+	"elastic-search-config-service/tracing"
 )
 
 // LoadMappingsFromFile loads the mappings from a JSON file
@@ -28,25 +39,176 @@ func LoadMappingsFromFile(filename string) (map[string]models.MappingInfo, error
 	return mappings, nil
 }
 
+// newConfigStore builds the config store selected in cfg.
+func newConfigStore(cfg config.Config, esClient *services.ElasticsearchClient) (store.ConfigStore, error) {
+	switch cfg.ConfigStore {
+	case config.StoreFile:
+		return store.NewFileStore(cfg.ConfigStorePath), nil
+	case config.StoreBolt:
+		return store.NewBoltStore(cfg.ConfigStorePath)
+	case config.StoreElasticsearch:
+		return store.NewElasticsearchStore(context.Background(), esClient.Transport(), cfg.ConfigIndex)
+	default:
+		return nil, fmt.Errorf("unknown config store %q", cfg.ConfigStore)
+	}
+}
+
+// newAuditLog builds the audit log selected in cfg.
+func newAuditLog(cfg config.Config, esClient *services.ElasticsearchClient) (store.AuditLog, error) {
+	switch cfg.AuditStore {
+	case config.StoreFile:
+		return store.NewFileAuditLog(cfg.AuditLogPath), nil
+	case config.StoreElasticsearch:
+		return store.NewElasticsearchAuditLog(context.Background(), esClient.Transport(), cfg.AuditIndex)
+	default:
+		return nil, fmt.Errorf("unknown audit store %q", cfg.AuditStore)
+	}
+}
+
+// checkAPIKeysUsable makes sure some key can authenticate requests when keys
+// are required: the admin key, or an active key created earlier. Otherwise
+// every request would be answered with 401.
+func checkAPIKeysUsable(ctx context.Context, esClient *services.ElasticsearchClient, adminKey string) error {
+	if adminKey != "" {
+		return nil
+	}
+	keys, err := esClient.ListAPIKeys(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, key := range keys {
+		if key.Active(now) {
+			return nil
+		}
+	}
+	return errors.New("AUTH_ADMIN_KEY is empty and no active api key exists; set AUTH_ADMIN_KEY or AUTH_REQUIRE_API_KEYS=false, see README.md")
+}
+
 func main() {
-	//TODO: Handle empty or no file present case
-	loadedMappings, err := LoadMappingsFromFile("es_mappings.json")
+	if err := run(); err != nil {
+		slog.Error("service stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run starts the service and serves until it is shut down. Failures that
+// leave the service unusable are returned, after the deferred cleanup ran.
+func run() error {
+	cfg := config.Load()
+	slog.SetDefault(logging.New(os.Stdout, logging.Options{
+		Level:        logging.ParseLevel(cfg.LogLevel),
+		JSON:         cfg.LogFormat != "text",
+		RedactFields: cfg.LogRedactFields,
+	}))
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.TraceExporter,
+		SampleRatio: cfg.TraceSampleRatio,
+	})
 	if err != nil {
-		fmt.Println("Failed to load mappings:", err)
-		return
+		return fmt.Errorf("error setting up tracing: %w", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	loadedMappings, err := LoadMappingsFromFile(cfg.LegacyMappingsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		slog.Info("no mappings file, starting with an empty registry", "file", cfg.LegacyMappingsFile)
+	} else if err != nil {
+		slog.Warn("ignoring mappings file", "file", cfg.LegacyMappingsFile, "error", err)
 	}
 
-	globals.ESIndexMappings = loadedMappings
 	// Initialize Elasticsearch client
-	esClient, err := services.NewElasticsearchClient("https://localhost:9200")
+	esClient, err := services.NewElasticsearchClient("https://localhost:9200", services.ResilienceConfig{
+		MaxRetries:       cfg.ESMaxRetries,
+		InitialBackoff:   cfg.ESRetryBackoff,
+		MaxBackoff:       cfg.ESRetryMaxBackoff,
+		BreakerThreshold: cfg.ESBreakerThreshold,
+		BreakerCooldown:  cfg.ESBreakerCooldown,
+		Timeouts:         cfg.ESTimeouts,
+	})
 	if err != nil {
-		log.Fatalf("Error creating Elasticsearch client: %v", err)
+		return fmt.Errorf("error creating elasticsearch client: %w", err)
+	}
+
+	configStore, err := newConfigStore(cfg, esClient)
+	if err != nil {
+		return fmt.Errorf("error opening config store: %w", err)
+	}
+	defer configStore.Close()
+	esClient.SetConfigStore(configStore)
+	auditLog, err := newAuditLog(cfg, esClient)
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %w", err)
+	}
+	defer auditLog.Close()
+	esClient.SetAuditLog(auditLog)
+	esClient.SetQueryLogging(cfg.LogQueriesFor)
+	esClient.SetAdminAPIKey(cfg.AdminAPIKey)
+	esClient.SetTenantTokenSecret(cfg.TenantTokenSecret)
+	esClient.SetDocumentQuota(cfg.DocumentsPerDay)
+	if !cfg.RequireAPIKeys {
+		slog.Warn("api keys are not required, every route is open to requests without a tenant token")
+	} else if err := checkAPIKeysUsable(context.Background(), esClient, cfg.AdminAPIKey); err != nil {
+		return fmt.Errorf("api keys are required but none can be used: %w", err)
+	}
+	metrics.Registry.MustRegister(esClient.Collectors()...)
+
+	if err := esClient.Bootstrap(context.Background(), loadedMappings, cfg.DiscoverIndices); err != nil {
+		return fmt.Errorf("error loading mappings: %w", err)
 	}
 
 	// Initialize router
-	r := router.NewRouter(esClient)
+	rateLimits := make(map[string]middleware.Rate, len(cfg.RateLimits))
+	for budget, perSecond := range cfg.RateLimits {
+		rateLimits[budget] = middleware.Rate{PerSecond: perSecond, Burst: cfg.RateBursts[budget]}
+	}
+	r := router.NewRouter(esClient, router.Options{
+		Deadlines:      cfg.Deadlines,
+		RequireAPIKeys: cfg.RequireAPIKeys,
+		RateLimits:     rateLimits,
+	})
 
 	// Start server
-	log.Println("Server is running on :1234")
-	log.Fatal(http.ListenAndServe(":1234", r))
+	srv := &http.Server{Addr: cfg.ListenAddr, Handler: r}
+	return serve(srv, esClient, cfg.ShutdownReadinessDelay, cfg.ShutdownGracePeriod)
+}
+
+// serve runs srv until SIGINT or SIGTERM, then fails readiness for
+// readinessDelay, stops accepting connections and waits up to grace for
+// in-flight requests. Migrations still running when grace runs out have their
+// state saved before their requests are cut.
+func serve(srv *http.Server, esClient *services.ElasticsearchClient, readinessDelay, grace time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		slog.Info("server is running", "addr", srv.Addr)
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+	esClient.BeginShutdown()
+	slog.Info("shutting down, failing readiness", "readiness_delay", readinessDelay.String())
+	time.Sleep(readinessDelay)
+	slog.Info("draining in-flight requests", "grace_period", grace.String())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err == nil {
+		slog.Info("server drained")
+		return nil
+	}
+
+	slog.Warn("grace period expired with requests in flight")
+	if _, err := esClient.PersistUnfinishedMigrations(context.Background()); err != nil {
+		slog.Error("error saving unfinished migrations", "error", err)
+	}
+	return srv.Close()
 }
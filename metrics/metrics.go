@@ -0,0 +1,126 @@
+// Package metrics holds the Prometheus collectors exposed on /metrics.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "config_service"
+
+// Registry holds every collector of the service. Components that expose
+// state through functions register their own collectors on it.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	esDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "elasticsearch_request_duration_seconds",
+		Help:      "Latency of single Elasticsearch requests by operation, retries counted separately.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"operation", "status"})
+
+	queryBuildDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "query_build_duration_seconds",
+		Help:      "Time spent building Elasticsearch queries, mapping lookup included.",
+		Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+	}, []string{"operation"})
+
+	esTook = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "elasticsearch_took_seconds",
+		Help:      "Search execution time reported by Elasticsearch in took.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	esRoundTrip = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "elasticsearch_round_trip_seconds",
+		Help:      "Search round-trip time seen by the service; compare with elasticsearch_took_seconds.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	bulkDocuments = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bulk_documents_total",
+		Help:      "Documents written by batch operations, by source and result.",
+	}, []string{"source", "result"})
+
+	rateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests refused with 429, by budget; quota_documents counts exhausted daily document quotas.",
+	}, []string{"budget"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, esDuration, queryBuildDuration,
+		esTook, esRoundTrip, bulkDocuments, rateLimited,
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveHTTP records a served request.
+func ObserveHTTP(route, method string, status int, d time.Duration) {
+	httpRequests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(route, method).Observe(d.Seconds())
+}
+
+// ObserveElasticsearch records a single request to Elasticsearch. A status
+// of zero means no response was received.
+func ObserveElasticsearch(operation string, status int, d time.Duration) {
+	label := "error"
+	if status > 0 {
+		label = strconv.Itoa(status)
+	}
+	esDuration.WithLabelValues(operation, label).Observe(d.Seconds())
+}
+
+// ObserveQueryBuild records the time spent building a query.
+func ObserveQueryBuild(operation string, d time.Duration) {
+	queryBuildDuration.WithLabelValues(operation).Observe(d.Seconds())
+}
+
+// ObserveSearch records the took reported by Elasticsearch, in milliseconds,
+// next to the round-trip time measured by the service.
+func ObserveSearch(operation string, tookMillis int64, roundTrip time.Duration) {
+	esTook.WithLabelValues(operation).Observe(float64(tookMillis) / 1000)
+	esRoundTrip.WithLabelValues(operation).Observe(roundTrip.Seconds())
+}
+
+// CountBulkDocuments records the outcome of a batch write.
+func CountBulkDocuments(source string, succeeded, failed int) {
+	bulkDocuments.WithLabelValues(source, "success").Add(float64(succeeded))
+	bulkDocuments.WithLabelValues(source, "failure").Add(float64(failed))
+}
+
+// CountRateLimited records a request refused because budget was spent.
+func CountRateLimited(budget string) {
+	rateLimited.WithLabelValues(budget).Inc()
+}
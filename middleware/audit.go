@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"elastic-search-config-service/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxAuditedBody bounds the request payload kept in an audit entry;
+	// larger payloads are recorded by size only.
+	maxAuditedBody = 64 << 10
+	// maxAuditedError bounds the error response read back for the entry.
+	maxAuditedError = 4 << 10
+)
+
+// Auditor records configuration changes.
+type Auditor interface {
+	// AuditSnapshot returns the configuration of index, or nil when there is
+	// none to describe.
+	AuditSnapshot(ctx context.Context, index string) json.RawMessage
+	RecordAudit(ctx context.Context, entry models.AuditEntry)
+}
+
+type auditRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *auditRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *auditRecorder) Write(b []byte) (int, error) {
+	if r.status >= http.StatusBadRequest && r.body.Len() < maxAuditedError {
+		r.body.Write(b[:min(len(b), maxAuditedError-r.body.Len())])
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Audit records every request reaching next as operation, with the caller,
+// the payload, the configuration of the target index before and after, and
+// the outcome. It must run inside Authorize so the caller is known. The
+// index comes from the route, or from the index_name of the payload for
+// routes that create one.
+func Audit(a Auditor, operation string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(io.LimitReader(r.Body, maxAuditedBody+1))
+		if err != nil {
+			writeErrorResponse(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, "error reading request body")
+			return
+		}
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(payload), r.Body))
+
+		index := mux.Vars(r)["index_name"]
+		if index == "" {
+			var body models.IndexName
+			if json.Unmarshal(payload, &body) == nil {
+				index = body.Index
+			}
+		}
+
+		// Snapshots and the entry itself must not be cut short by the
+		// request's deadline or by the client going away.
+		ctx := context.WithoutCancel(r.Context())
+		entry := models.AuditEntry{
+			ID:        newAuditID(),
+			Time:      time.Now().UTC(),
+			Actor:     CallerID(r),
+			RequestID: RequestIDFromContext(r.Context()),
+			Operation: operation,
+			Index:     index,
+			Request:   auditedPayload(payload),
+		}
+		if index != "" {
+			entry.Before = a.AuditSnapshot(ctx, index)
+		}
+
+		rec := &auditRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		entry.Status = rec.status
+		entry.Outcome = models.AuditSuccess
+		if rec.status >= http.StatusBadRequest {
+			entry.Outcome = models.AuditFailure
+			entry.Error = auditedError(rec.body.Bytes())
+		}
+		if index != "" {
+			entry.After = a.AuditSnapshot(ctx, index)
+		}
+		a.RecordAudit(ctx, entry)
+	})
+}
+
+// auditedPayload keeps JSON payloads as they are and describes anything
+// else by its size.
+func auditedPayload(payload []byte) json.RawMessage {
+	if len(payload) == 0 {
+		return nil
+	}
+	if len(payload) <= maxAuditedBody && json.Valid(payload) {
+		return json.RawMessage(payload)
+	}
+	note, _ := json.Marshal(map[string]interface{}{"omitted": true, "size_bytes_at_least": len(payload)})
+	return note
+}
+
+// auditedError extracts the message of an error response.
+func auditedError(body []byte) string {
+	var resp models.ErrorResponse
+	if json.Unmarshal(body, &resp) == nil && resp.Message != "" {
+		return resp.Message
+	}
+	return string(bytes.TrimSpace(body))
+}
+
+func newAuditID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"elastic-search-config-service/models"
+
+	"github.com/gorilla/mux"
+)
+
+// APIKeyHeader carries the API key of a request. "Authorization: ApiKey <key>"
+// is accepted as well. Tenant tokens are sent as "Authorization: Bearer <token>".
+const APIKeyHeader = "X-API-Key"
+
+// Authenticator resolves the credentials presented with a request. ok is
+// false when they are not valid; err reports a failure to look them up.
+type Authenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key, remoteAddr string) (models.APIKey, bool, error)
+	AuthenticateTenantToken(ctx context.Context, token string) (models.TenantTokenClaims, bool, error)
+}
+
+type apiKeyKey struct{}
+
+type tenantKey struct{}
+
+// Authorize lets a request through to next only when it carries an API key
+// granted action on the index named in the route, if any, or a tenant token
+// for that index when action is search. Without requireKeys requests need no
+// credentials, but a tenant token that is presented is still verified and
+// restricts the request. A nil auth turns authentication off.
+func Authorize(auth Authenticator, requireKeys bool, action string, next http.Handler) http.Handler {
+	if auth == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		index := mux.Vars(r)["index_name"]
+		if token := bearerToken(r); token != "" {
+			claims, ok := authenticateTenant(auth, w, r, token)
+			if !ok {
+				return
+			}
+			if action != models.ActionSearch || !claims.Allows(index) {
+				writeErrorResponse(w, r, http.StatusForbidden, models.ErrCodeForbidden, "tenant token may not perform "+action+" on "+target(index))
+				return
+			}
+			ctx := context.WithValue(r.Context(), tenantKey{}, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+		if !requireKeys {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, ok := authenticateKey(auth, w, r)
+		if !ok {
+			return
+		}
+		if !key.Allows(action, index) {
+			writeErrorResponse(w, r, http.StatusForbidden, models.ErrCodeForbidden, "api key "+key.ID+" may not perform "+action+" on "+target(index))
+			return
+		}
+		ctx := context.WithValue(r.Context(), apiKeyKey{}, key)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Authenticate lets a request through to next when it carries any valid API
+// key, leaving the scope checks to next. A nil auth turns authentication off.
+func Authenticate(auth Authenticator, next http.Handler) http.Handler {
+	if auth == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := authenticateKey(auth, w, r)
+		if !ok {
+			return
+		}
+		ctx := context.WithValue(r.Context(), apiKeyKey{}, key)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticateKey resolves the API key of r, answering the request itself
+// when there is none or it is not valid.
+func authenticateKey(auth Authenticator, w http.ResponseWriter, r *http.Request) (models.APIKey, bool) {
+	presented := presentedAPIKey(r)
+	if presented == "" {
+		writeErrorResponse(w, r, http.StatusUnauthorized, models.ErrCodeUnauthorized, "missing api key")
+		return models.APIKey{}, false
+	}
+	key, ok, err := auth.AuthenticateAPIKey(r.Context(), presented, clientIP(r))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error authenticating api key", "error", err)
+		writeErrorResponse(w, r, http.StatusServiceUnavailable, models.ErrCodeUpstreamUnavailable, "api keys cannot be verified right now")
+		return models.APIKey{}, false
+	}
+	if !ok {
+		writeErrorResponse(w, r, http.StatusUnauthorized, models.ErrCodeUnauthorized, "invalid api key")
+		return models.APIKey{}, false
+	}
+	return key, true
+}
+
+func authenticateTenant(auth Authenticator, w http.ResponseWriter, r *http.Request, token string) (models.TenantTokenClaims, bool) {
+	claims, ok, err := auth.AuthenticateTenantToken(r.Context(), token)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error authenticating tenant token", "error", err)
+		writeErrorResponse(w, r, http.StatusServiceUnavailable, models.ErrCodeUpstreamUnavailable, "tenant tokens cannot be verified right now")
+		return models.TenantTokenClaims{}, false
+	}
+	if !ok {
+		writeErrorResponse(w, r, http.StatusUnauthorized, models.ErrCodeUnauthorized, "invalid or expired tenant token")
+		return models.TenantTokenClaims{}, false
+	}
+	return claims, true
+}
+
+func target(index string) string {
+	if index == "" {
+		return "cluster"
+	}
+	return "index " + index
+}
+
+// APIKeyFromContext returns the key a request was authorized with, if any.
+func APIKeyFromContext(ctx context.Context) (models.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyKey{}).(models.APIKey)
+	return key, ok
+}
+
+// TenantFromContext returns the tenant token a request was authorized with,
+// if any.
+func TenantFromContext(ctx context.Context) (models.TenantTokenClaims, bool) {
+	claims, ok := ctx.Value(tenantKey{}).(models.TenantTokenClaims)
+	return claims, ok
+}
+
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+func presentedAPIKey(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	scheme, key, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "ApiKey") {
+		return strings.TrimSpace(key)
+	}
+	return ""
+}
+
+// clientIP returns the address the request came from, without its port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "ApiKey")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.ErrorResponse{
+		Code:      code,
+		Message:   message,
+		RequestID: RequestIDFromContext(r.Context()),
+	})
+}
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"elastic-search-config-service/metrics"
+)
+
+// Metrics records request counts and latency by route template, so that
+// index names do not end up as label values.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		metrics.ObserveHTTP(routeTemplate(r), r.Method, rec.status, time.Since(start))
+	})
+}
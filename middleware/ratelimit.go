@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"elastic-search-config-service/metrics"
+	"elastic-search-config-service/models"
+
+	"github.com/gorilla/mux"
+)
+
+// bucketIdleTimeout is how long an untouched bucket is kept. A bucket idle
+// that long has refilled anyway, so dropping it changes nothing.
+const bucketIdleTimeout = 10 * time.Minute
+
+// Rate is a token bucket budget: Burst requests at once, refilled at
+// PerSecond. A non-positive PerSecond means no limit.
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter keeps one token bucket per budget, caller and index.
+type RateLimiter struct {
+	rates map[string]Rate
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter returns a limiter with the given budgets, keyed by name
+// such as search, write or admin.
+func NewRateLimiter(rates map[string]Rate) *RateLimiter {
+	return &RateLimiter{
+		rates:     rates,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// take removes a token from the bucket at key and reports how long to wait
+// for the next one when it is empty.
+func (l *RateLimiter) take(key string, rate Rate, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	burst := float64(rate.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate.PerSecond)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / rate.PerSecond * float64(time.Second))
+	return false, wait
+}
+
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketIdleTimeout {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > bucketIdleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// RateLimit answers 429 with Retry-After once the caller has spent the
+// budget of that name on the index of the route. Callers are told apart by
+// API key, falling back to the client IP. It must run inside Authorize so
+// the key is known. A nil l or an unknown budget adds no limit.
+func RateLimit(l *RateLimiter, budget string, next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	rate, ok := l.rates[budget]
+	if !ok || rate.PerSecond <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := budget + "|" + CallerID(r) + "|" + mux.Vars(r)["index_name"]
+		allowed, wait := l.take(key, rate, time.Now())
+		if !allowed {
+			metrics.CountRateLimited(budget)
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeErrorResponse(w, r, http.StatusTooManyRequests, models.ErrCodeRateLimited, "rate limit of "+budget+" requests exceeded, retry in "+strconv.Itoa(seconds)+"s")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CallerID identifies who made a request for rate limits and quotas: the API
+// key, the key a tenant token was minted with, or else the client IP.
+func CallerID(r *http.Request) string {
+	if key, ok := APIKeyFromContext(r.Context()); ok {
+		return "key:" + key.ID
+	}
+	if tenant, ok := TenantFromContext(r.Context()); ok && tenant.APIKeyID != "" {
+		return "key:" + tenant.APIKeyID
+	}
+	return "ip:" + clientIP(r)
+}
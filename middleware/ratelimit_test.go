@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterTake(t *testing.T) {
+	type attempt struct {
+		at        time.Duration
+		key       string
+		wantAllow bool
+		wantWait  time.Duration
+	}
+	tests := []struct {
+		name     string
+		rate     Rate
+		attempts []attempt
+	}{
+		{
+			name: "burst then refused until a token refills",
+			rate: Rate{PerSecond: 2, Burst: 2},
+			attempts: []attempt{
+				{at: 0, wantAllow: true},
+				{at: 0, wantAllow: true},
+				{at: 0, wantWait: 500 * time.Millisecond},
+				{at: 250 * time.Millisecond, wantWait: 250 * time.Millisecond},
+				{at: 500 * time.Millisecond, wantAllow: true},
+				{at: 500 * time.Millisecond, wantWait: 500 * time.Millisecond},
+			},
+		},
+		{
+			name: "refill stops at the burst",
+			rate: Rate{PerSecond: 10, Burst: 2},
+			attempts: []attempt{
+				{at: 0, wantAllow: true},
+				{at: 10 * time.Second, wantAllow: true},
+				{at: 10 * time.Second, wantAllow: true},
+				{at: 10 * time.Second, wantWait: 100 * time.Millisecond},
+			},
+		},
+		{
+			name: "burst below one still allows a request",
+			rate: Rate{PerSecond: 1},
+			attempts: []attempt{
+				{at: 0, wantAllow: true},
+				{at: 0, wantWait: time.Second},
+				{at: time.Second, wantAllow: true},
+			},
+		},
+		{
+			name: "buckets are separate per key",
+			rate: Rate{PerSecond: 1, Burst: 1},
+			attempts: []attempt{
+				{at: 0, key: "a", wantAllow: true},
+				{at: 0, key: "a", wantWait: time.Second},
+				{at: 0, key: "b", wantAllow: true},
+			},
+		},
+		{
+			name: "idle buckets are swept and start full",
+			rate: Rate{PerSecond: 0.001, Burst: 1},
+			attempts: []attempt{
+				{at: 0, wantAllow: true},
+				{at: time.Second, wantWait: 999 * time.Second},
+				{at: bucketIdleTimeout + 2*time.Second, wantAllow: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			l := NewRateLimiter(nil)
+			l.lastSweep = start
+			for i, a := range tt.attempts {
+				allowed, wait := l.take(a.key, tt.rate, start.Add(a.at))
+				if allowed != a.wantAllow {
+					t.Fatalf("attempt %d: allowed = %v, want %v", i, allowed, a.wantAllow)
+				}
+				if diff := wait - a.wantWait; diff < -time.Millisecond || diff > time.Millisecond {
+					t.Errorf("attempt %d: wait = %v, want %v", i, wait, a.wantWait)
+				}
+			}
+		})
+	}
+}
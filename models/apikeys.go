@@ -0,0 +1,138 @@
+package models
+
+import (
+	"path"
+	"strings"
+	"time"
+)
+
+// Actions an API key can be granted.
+const (
+	// ActionSearch covers search and facet requests.
+	ActionSearch = "search"
+	// ActionReadDocuments covers fetching documents by ID.
+	ActionReadDocuments = "documents:read"
+	// ActionWriteDocuments covers indexing, updating and deleting documents.
+	ActionWriteDocuments = "documents:write"
+	// ActionAdmin covers index creation, settings, mappings, status and key
+	// management.
+	ActionAdmin = "admin"
+)
+
+// Actions lists every action an API key can be granted.
+var Actions = []string{ActionSearch, ActionReadDocuments, ActionWriteDocuments, ActionAdmin}
+
+// APIKey describes an API key without its secret. Indices holds index name
+// patterns such as "products" or "products_*"; "*" matches every index.
+type APIKey struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Actions []string `json:"actions"`
+	Indices []string `json:"indices"`
+	FieldAccess
+	// DocumentsPerDay overrides the configured daily document quota of the
+	// key on each index; zero keeps the default.
+	DocumentsPerDay int64      `json:"documents_per_day,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+
+	CreatedAt    time.Time  `json:"created_at"`
+	CreatedBy    string     `json:"created_by,omitempty"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+	LastUsedFrom string     `json:"last_used_from,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy    string     `json:"revoked_by,omitempty"`
+}
+
+// Active reports whether the key is neither revoked nor expired at now.
+func (k APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+// Allows reports whether the key may perform action on index. Requests that
+// do not target a single index, such as creating an index or reading the
+// cluster status, pass an empty index and need a key covering "*".
+func (k APIKey) Allows(action, index string) bool {
+	if !k.hasAction(action) {
+		return false
+	}
+	for _, pattern := range k.Indices {
+		if pattern == "*" {
+			return true
+		}
+		if index == "" {
+			continue
+		}
+		if ok, _ := path.Match(pattern, index); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsPattern reports whether the key may perform action on every index
+// the pattern can match. A pattern is only proven covered when it is
+// literal, equal to a granted pattern or narrows a granted "prefix*" pattern;
+// anything else is refused.
+func (k APIKey) AllowsPattern(action, pattern string) bool {
+	if !strings.ContainsAny(pattern, globMeta) {
+		return k.Allows(action, pattern)
+	}
+	if !k.hasAction(action) {
+		return false
+	}
+	for _, granted := range k.Indices {
+		if patternCovers(granted, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func (k APIKey) hasAction(action string) bool {
+	for _, a := range k.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// globMeta are the characters with a special meaning in path.Match patterns.
+const globMeta = `*?[\`
+
+// patternCovers reports whether every name matched by pattern is also matched
+// by granted.
+func patternCovers(granted, pattern string) bool {
+	if granted == "*" || granted == pattern {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(granted, "*")
+	if !ok || strings.ContainsAny(prefix, globMeta) {
+		return false
+	}
+	literal := pattern
+	if i := strings.IndexAny(pattern, globMeta); i >= 0 {
+		literal = pattern[:i]
+	}
+	return strings.HasPrefix(literal, prefix)
+}
+
+// CreateAPIKeyRequest is the body accepted when creating an API key.
+type CreateAPIKeyRequest struct {
+	Name    string   `json:"name"`
+	Actions []string `json:"actions"`
+	Indices []string `json:"indices"`
+	FieldAccess
+	DocumentsPerDay int64      `json:"documents_per_day,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreatedAPIKey is returned once when a key is created. Key is the secret to
+// send in the X-API-Key header; only its hash is kept by the service.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
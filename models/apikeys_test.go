@@ -0,0 +1,71 @@
+package models
+
+import "testing"
+
+func TestAPIKeyAllows(t *testing.T) {
+	key := APIKey{
+		Actions: []string{ActionSearch, ActionReadDocuments},
+		Indices: []string{"products", "logs_*"},
+	}
+	wildcard := APIKey{Actions: []string{ActionAdmin}, Indices: []string{"*"}}
+
+	tests := []struct {
+		name   string
+		key    APIKey
+		action string
+		index  string
+		want   bool
+	}{
+		{name: "literal index", key: key, action: ActionSearch, index: "products", want: true},
+		{name: "index matching a granted pattern", key: key, action: ActionReadDocuments, index: "logs_2024", want: true},
+		{name: "index outside the granted patterns", key: key, action: ActionSearch, index: "orders", want: false},
+		{name: "index sharing a prefix with a literal grant", key: key, action: ActionSearch, index: "products_v2", want: false},
+		{name: "action not granted", key: key, action: ActionWriteDocuments, index: "products", want: false},
+		{name: "cluster request without a wildcard grant", key: key, action: ActionSearch, index: "", want: false},
+		{name: "cluster request with a wildcard grant", key: wildcard, action: ActionAdmin, index: "", want: true},
+		{name: "any index with a wildcard grant", key: wildcard, action: ActionAdmin, index: "orders", want: true},
+		{name: "wildcard grant still checks the action", key: wildcard, action: ActionSearch, index: "orders", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.key.Allows(tt.action, tt.index); got != tt.want {
+				t.Errorf("Allows(%q, %q) = %v, want %v", tt.action, tt.index, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIKeyAllowsPattern(t *testing.T) {
+	key := APIKey{
+		Actions: []string{ActionSearch},
+		Indices: []string{"products", "logs_*", "tenant_?"},
+	}
+	wildcard := APIKey{Actions: []string{ActionSearch}, Indices: []string{"*"}}
+
+	tests := []struct {
+		name    string
+		key     APIKey
+		action  string
+		pattern string
+		want    bool
+	}{
+		{name: "literal index", key: key, action: ActionSearch, pattern: "products", want: true},
+		{name: "literal index matching a granted pattern", key: key, action: ActionSearch, pattern: "logs_eu", want: true},
+		{name: "pattern equal to a grant", key: key, action: ActionSearch, pattern: "logs_*", want: true},
+		{name: "pattern narrowing a prefix grant", key: key, action: ActionSearch, pattern: "logs_eu_*", want: true},
+		{name: "pattern with a class narrowing a prefix grant", key: key, action: ActionSearch, pattern: "logs_[ab]*", want: true},
+		{name: "pattern widening a prefix grant", key: key, action: ActionSearch, pattern: "log*", want: false},
+		{name: "pattern widening a literal grant", key: key, action: ActionSearch, pattern: "products*", want: false},
+		{name: "pattern under a grant that is not a prefix", key: key, action: ActionSearch, pattern: "tenant_a*", want: false},
+		{name: "match-all pattern", key: key, action: ActionSearch, pattern: "*", want: false},
+		{name: "match-all pattern with a wildcard grant", key: wildcard, action: ActionSearch, pattern: "*", want: true},
+		{name: "action not granted", key: key, action: ActionAdmin, pattern: "logs_*", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.key.AllowsPattern(tt.action, tt.pattern); got != tt.want {
+				t.Errorf("AllowsPattern(%q, %q) = %v, want %v", tt.action, tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
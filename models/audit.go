@@ -0,0 +1,59 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Outcomes recorded in AuditEntry.
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditEntry records a single configuration-changing request.
+type AuditEntry struct {
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor"`
+	RequestID string    `json:"request_id,omitempty"`
+	Operation string    `json:"operation"`
+	Index     string    `json:"index,omitempty"`
+	// Request is the request body as sent by the client.
+	Request json.RawMessage `json:"request,omitempty"`
+	// Before and After are the configuration of the index around the
+	// request, when there is an index to describe.
+	Before  json.RawMessage `json:"before,omitempty"`
+	After   json.RawMessage `json:"after,omitempty"`
+	Outcome string          `json:"outcome"`
+	Status  int             `json:"status"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// AuditQuery selects audit entries. Empty fields match everything; From and
+// To bound Time inclusively.
+type AuditQuery struct {
+	Index     string
+	Actor     string
+	Operation string
+	From      time.Time
+	To        time.Time
+	Limit     int
+}
+
+// Matches reports whether e is selected by q, ignoring Limit.
+func (q AuditQuery) Matches(e AuditEntry) bool {
+	switch {
+	case q.Index != "" && e.Index != q.Index:
+		return false
+	case q.Actor != "" && e.Actor != q.Actor:
+		return false
+	case q.Operation != "" && e.Operation != q.Operation:
+		return false
+	case !q.From.IsZero() && e.Time.Before(q.From):
+		return false
+	case !q.To.IsZero() && e.Time.After(q.To):
+		return false
+	}
+	return true
+}
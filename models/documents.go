@@ -4,3 +4,50 @@ type Document struct {
 	ID      string      `json:"id"`
 	Content interface{} `json:"content"`
 }
+
+// DocumentVersion identifies a revision of a document for optimistic
+// concurrency control. It is exposed to clients as an ETag.
+type DocumentVersion struct {
+	SeqNo       int `json:"seq_no"`
+	PrimaryTerm int `json:"primary_term"`
+}
+
+// StoredDocument is a document as read back from the index.
+type StoredDocument struct {
+	ID      string          `json:"id"`
+	Content interface{}     `json:"content"`
+	Version DocumentVersion `json:"version"`
+}
+
+// DocumentWriteResult reports the outcome of a single document write.
+type DocumentWriteResult struct {
+	ID      string          `json:"id"`
+	Result  string          `json:"result"`
+	Version DocumentVersion `json:"version"`
+}
+
+// WriteCondition makes a document write conditional. IfMatch requires the
+// stored document to be at that version; IfNoneMatch requires that no
+// document exists yet.
+type WriteCondition struct {
+	IfMatch     *DocumentVersion
+	IfNoneMatch bool
+}
+
+type MultiGetRequest struct {
+	IDs []string `json:"ids"`
+}
+
+type MultiGetResponse struct {
+	Documents []StoredDocument `json:"documents"`
+	Missing   []string         `json:"missing"`
+}
+
+type DeleteByQueryRequest struct {
+	Filter Filter `json:"filter"`
+}
+
+type DeleteByQueryResponse struct {
+	Deleted          int64 `json:"deleted"`
+	VersionConflicts int64 `json:"version_conflicts"`
+}
@@ -0,0 +1,68 @@
+package models
+
+// ErrorResponse is the envelope every handler uses to report a failure.
+type ErrorResponse struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// Error codes returned in ErrorResponse.Code. Clients should switch on the
+// code rather than the message, which is meant for humans and may change.
+const (
+	// ErrCodeInvalidRequest (400): the request body or parameters could not be
+	// parsed or failed validation.
+	ErrCodeInvalidRequest = "invalid_request"
+	// ErrCodeInvalidField (400): the request referenced fields that are
+	// missing from the index mapping or unusable for the operation. Details
+	// lists every offending field with a reason.
+	ErrCodeInvalidField = "invalid_field"
+	// ErrCodeUpstreamRejected (400): Elasticsearch rejected the generated
+	// request. Details carries the upstream type, reason and root_cause.
+	ErrCodeUpstreamRejected = "upstream_rejected"
+	// ErrCodeUnauthorized (401): the request carried no API key, or one that
+	// is unknown, revoked or expired.
+	ErrCodeUnauthorized = "unauthorized"
+	// ErrCodeForbidden (403): the API key is valid but not allowed to perform
+	// the action on the index.
+	ErrCodeForbidden = "forbidden"
+	// ErrCodeNotFound (404): no route matches the request path.
+	ErrCodeNotFound = "not_found"
+	// ErrCodeIndexNotFound (404): the logical index or its aliases do not exist.
+	ErrCodeIndexNotFound = "index_not_found"
+	// ErrCodeDocumentNotFound (404): no document exists with the given ID.
+	ErrCodeDocumentNotFound = "document_not_found"
+	// ErrCodeAPIKeyNotFound (404): no API key exists with the given ID.
+	ErrCodeAPIKeyNotFound = "api_key_not_found"
+	// ErrCodeSettingsVersionNotFound (404): the settings history of the index
+	// has no such version.
+	ErrCodeSettingsVersionNotFound = "settings_version_not_found"
+	// ErrCodeMethodNotAllowed (405): the route exists but not for this method.
+	ErrCodeMethodNotAllowed = "method_not_allowed"
+	// ErrCodeIndexExists (409): the index or alias being created already exists.
+	ErrCodeIndexExists = "index_already_exists"
+	// ErrCodeConflict (409): the operation clashes with work in progress on
+	// the index, such as a running mapping migration.
+	ErrCodeConflict = "conflict"
+	// ErrCodeVersionConflict (412): the If-Match or If-None-Match condition
+	// of a document write did not hold.
+	ErrCodeVersionConflict = "version_conflict"
+	// ErrCodeRateLimited (429): the caller spent its request budget; retry
+	// after the number of seconds in the Retry-After header.
+	ErrCodeRateLimited = "rate_limited"
+	// ErrCodeQuotaExceeded (429): the daily document quota of the caller on
+	// the index is used up; Retry-After points at the next UTC midnight.
+	ErrCodeQuotaExceeded = "quota_exceeded"
+	// ErrCodeCanceled (499): the client closed the connection before the
+	// request finished.
+	ErrCodeCanceled = "client_closed_request"
+	// ErrCodeInternal (500): an unexpected failure inside the service.
+	ErrCodeInternal = "internal_error"
+	// ErrCodeUpstreamUnavailable (503): Elasticsearch is unreachable or
+	// overloaded; the request may be retried.
+	ErrCodeUpstreamUnavailable = "upstream_unavailable"
+	// ErrCodeTimeout (504): the request deadline passed before Elasticsearch
+	// answered.
+	ErrCodeTimeout = "timeout"
+)
@@ -10,9 +10,16 @@ type FacetInfo struct {
 
 type FacetListingRequest struct {
 	Facets []FacetInfo `json:"facets"`
+	// TenantFilter comes from the tenant token of the request, if any, and
+	// restricts the documents the facets are counted over.
+	TenantFilter Filter `json:"-"`
+	// FieldAccess comes from the API key or tenant token of the request.
+	FieldAccess FieldAccess `json:"-"`
 }
 
 type FacetResponse struct {
+	Took         int64                      `json:"took"`
+	TimedOut     bool                       `json:"timed_out"`
 	Aggregations map[string]json.RawMessage `json:"aggregations"`
 }
 
@@ -27,6 +34,9 @@ type FacetBucket struct {
 
 type DynamicFacetResponse struct {
 	FacetData map[string][]FacetValue `json:"facet_data"`
+	// TimedOut is set when the request deadline cut aggregation short and
+	// the counts only cover the shards that answered in time.
+	TimedOut bool `json:"timed_out,omitempty"`
 }
 
 type FacetValue struct {
@@ -0,0 +1,45 @@
+package models
+
+// Health check outcomes.
+const (
+	CheckOK   = "ok"
+	CheckFail = "fail"
+)
+
+type HealthCheck struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// Readiness tells an orchestrator whether the instance can serve traffic.
+type Readiness struct {
+	Ready  bool                   `json:"ready"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+// ClusterStatus describes the cluster and the logical indices on it.
+type ClusterStatus struct {
+	ClusterName       string               `json:"cluster_name"`
+	Version           string               `json:"version"`
+	Health            string               `json:"health"`
+	PendingTasks      int                  `json:"pending_tasks"`
+	RunningTasks      int                  `json:"running_tasks"`
+	RunningMigrations int                  `json:"running_migrations"`
+	Indices           []LogicalIndexStatus `json:"indices"`
+}
+
+// LogicalIndexStatus shows where the aliases of a logical index point.
+// Generation is the physical index currently serving reads.
+type LogicalIndexStatus struct {
+	Name       string        `json:"name"`
+	ReadAlias  AliasTopology `json:"read_alias"`
+	WriteAlias AliasTopology `json:"write_alias"`
+	Generation string        `json:"generation"`
+	DocCount   int64         `json:"doc_count"`
+	Migrating  bool          `json:"migrating"`
+}
+
+type AliasTopology struct {
+	Name    string   `json:"name"`
+	Indices []string `json:"indices"`
+}
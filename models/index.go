@@ -2,6 +2,60 @@ package models
 
 type IndexName struct {
 	Index string `json:"index_name"`
+	// Schema is optional; without it the index is created with dynamic mapping.
+	Schema *IndexSchema `json:"schema,omitempty"`
+}
+
+// Values accepted for IndexSchema.Dynamic.
+const (
+	DynamicStrict = "strict"
+	DynamicFalse  = "false"
+	DynamicTrue   = "true"
+)
+
+// IndexSchema declares the mapping and settings an index is created with.
+type IndexSchema struct {
+	// Dynamic controls unknown fields: "strict" rejects them, "false" keeps
+	// them in _source without indexing and "true" maps them automatically.
+	Dynamic  string `json:"dynamic,omitempty"`
+	Shards   int    `json:"number_of_shards,omitempty"`
+	Replicas *int   `json:"number_of_replicas,omitempty"`
+	// Analyzers holds custom analyzer definitions, passed as is to
+	// settings.analysis.analyzer, that fields can refer to by name.
+	Analyzers map[string]map[string]interface{} `json:"analyzers,omitempty"`
+	// Tokenizers, Filters, CharFilters and Normalizers hold the other
+	// definitions of settings.analysis that custom analyzers refer to.
+	Tokenizers  map[string]map[string]interface{} `json:"tokenizers,omitempty"`
+	Filters     map[string]map[string]interface{} `json:"filters,omitempty"`
+	CharFilters map[string]map[string]interface{} `json:"char_filters,omitempty"`
+	Normalizers map[string]map[string]interface{} `json:"normalizers,omitempty"`
+	// Fields is keyed by the dotted field path. Parents of nested documents
+	// are declared with type "nested"; undeclared parents become objects.
+	Fields map[string]FieldSchema `json:"fields"`
+}
+
+// FieldSchema describes a single field of an IndexSchema.
+type FieldSchema struct {
+	Type           string `json:"type"`
+	Searchable     bool   `json:"searchable"`
+	Facet          bool   `json:"facet"`
+	Sortable       bool   `json:"sortable"`
+	Analyzer       string `json:"analyzer,omitempty"`
+	SearchAnalyzer string `json:"search_analyzer,omitempty"`
+}
+
+// FieldTypes lists the field types accepted in a FieldSchema.
+var FieldTypes = map[string]struct{}{
+	"text":    {},
+	"keyword": {},
+	"integer": {},
+	"long":    {},
+	"float":   {},
+	"double":  {},
+	"boolean": {},
+	"date":    {},
+	"object":  {},
+	"nested":  {},
 }
 
 type IndexInfo struct {
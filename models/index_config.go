@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// IndexConfig is the whole configuration of a logical index: the physical
+// indices behind its aliases, the attributes kept by the service, the
+// dynamic Elasticsearch settings and the field mappings.
+type IndexConfig struct {
+	IndexName     string                  `json:"index_name"`
+	ReadIndices   []string                `json:"read_indices"`
+	WriteIndices  []string                `json:"write_indices"`
+	Settings      IndexSettings           `json:"settings"`
+	IndexSettings map[string]interface{}  `json:"index_settings,omitempty"`
+	FieldMappings map[string]FieldMapping `json:"field_mappings,omitempty"`
+}
+
+// ConfigFormatVersion is the version of the IndexConfigExport format written
+// by this service.
+const ConfigFormatVersion = 1
+
+// Modes of a configuration import.
+const (
+	// ImportPlan only reports what an import would change.
+	ImportPlan = "plan"
+	// ImportApply makes the changes.
+	ImportApply = "apply"
+)
+
+// IndexConfigExport is the portable configuration of a logical index: enough
+// to create it on another cluster and bring its attributes and dynamic
+// settings in line. Schema is derived from the current mapping; fields of
+// types IndexSchema cannot express are left out of it.
+type IndexConfigExport struct {
+	FormatVersion int       `json:"format_version"`
+	IndexName     string    `json:"index_name"`
+	ExportedAt    time.Time `json:"exported_at"`
+	// SettingsVersion is the settings history version that was exported.
+	SettingsVersion int64                  `json:"settings_version,omitempty"`
+	Schema          IndexSchema            `json:"schema"`
+	Settings        IndexSettings          `json:"settings"`
+	IndexSettings   map[string]interface{} `json:"index_settings,omitempty"`
+}
+
+// ConfigImportPlan reports what importing an IndexConfigExport changes, or
+// changed when Mode is apply.
+type ConfigImportPlan struct {
+	IndexName   string `json:"index_name"`
+	Mode        string `json:"mode"`
+	CreateIndex bool   `json:"create_index"`
+	// IndexSettings are the dynamic settings whose value differs.
+	IndexSettings map[string]interface{} `json:"index_settings,omitempty"`
+	Attributes    []AttributeChange      `json:"attributes,omitempty"`
+	// Remap is set when the mapping has to follow changed searchable or
+	// facet attributes, possibly through a reindex.
+	Remap bool `json:"remap"`
+	// Warnings lists parts of the schema that differ from the existing index
+	// but can only be chosen when an index is created.
+	Warnings  []string `json:"warnings,omitempty"`
+	Unchanged bool     `json:"unchanged"`
+
+	Migration       *MappingChangeResult `json:"migration,omitempty"`
+	SettingsVersion int64                `json:"settings_version,omitempty"`
+}
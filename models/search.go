@@ -31,6 +31,11 @@ type SearchReq struct {
 	PageSize     uint32         `json:"page_size"`
 	Cursor       uint32         `json:"cursor"`
 	Filter       Filter         `json:"filter"`
+	// TenantFilter comes from the tenant token of the request, if any, and
+	// is ANDed with Filter.
+	TenantFilter Filter `json:"-"`
+	// FieldAccess comes from the API key or tenant token of the request.
+	FieldAccess FieldAccess `json:"-"`
 }
 
 // FieldMapping defines the mapping for a field in the query
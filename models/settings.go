@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // order of searchable attributes will decide boosting
 type SearchableAttributes []string
 
@@ -10,4 +12,95 @@ type FacetsAttributes []string
 type IndexSettings struct {
 	SearchableAttributes SearchableAttributes `json:"searchable_attributes"`
 	FacetAttributes      FacetsAttributes     `json:"facet_attributes"`
+	// DisplayedAttributes limits the fields returned in search hits and
+	// facets. Entries are field paths, object paths or patterns such as
+	// "content.price*"; empty returns every field.
+	DisplayedAttributes []string `json:"displayed_attributes,omitempty"`
+}
+
+// MappingChange is the body of a change mappings request. Fields adds new
+// fields to the mapping, declared the way an IndexSchema declares them; a
+// searchable or facet field joins the matching attributes.
+type MappingChange struct {
+	IndexSettings
+	Fields map[string]FieldSchema `json:"fields,omitempty"`
+}
+
+// FieldAccess restricts the document fields a caller gets back from search
+// and facets. Empty AllowedFields permits every field not denied; entries
+// take the same forms as DisplayedAttributes.
+type FieldAccess struct {
+	AllowedFields []string `json:"allowed_fields,omitempty"`
+	DeniedFields  []string `json:"denied_fields,omitempty"`
+}
+
+// IndexSettingsUpdate reports the dynamic settings applied to a logical index.
+type IndexSettingsUpdate struct {
+	Indices  []string               `json:"indices"`
+	Settings map[string]interface{} `json:"settings"`
+}
+
+// Strategies reported in MappingChangeResult.
+const (
+	MigrationUnchanged = "unchanged"
+	MigrationInPlace   = "in_place"
+	MigrationReindex   = "reindex"
+)
+
+// MappingChangeResult describes how a mapping change was carried out.
+type MappingChangeResult struct {
+	Strategy         string   `json:"strategy"`
+	SourceIndex      string   `json:"source_index"`
+	TargetIndex      string   `json:"target_index"`
+	Changes          []string `json:"changes"`
+	BreakingChanges  []string `json:"breaking_changes,omitempty"`
+	UpdatedDocuments int64    `json:"updated_documents,omitempty"`
+	// ReplayedDocuments counts writes made during a reindex that were copied
+	// into the new index before the aliases were switched.
+	ReplayedDocuments int64 `json:"replayed_documents,omitempty"`
+}
+
+// IndexSettingsVersion is one accepted version of the settings of a logical
+// index. Versions are numbered from 1 per index.
+type IndexSettingsVersion struct {
+	Version   int64         `json:"version"`
+	Settings  IndexSettings `json:"settings"`
+	CreatedAt time.Time     `json:"created_at"`
+	// RestoredFrom is the earlier version this one was restored from.
+	RestoredFrom int64 `json:"restored_from,omitempty"`
+}
+
+// IndexSettingsDiff lists what changed between two settings versions.
+type IndexSettingsDiff struct {
+	IndexName string            `json:"index_name"`
+	From      int64             `json:"from"`
+	To        int64             `json:"to"`
+	Changes   []AttributeChange `json:"changes"`
+}
+
+// AttributeChange lists the entries added to and removed from one attribute
+// list, such as searchable_attributes.
+type AttributeChange struct {
+	Attribute string   `json:"attribute"`
+	Added     []string `json:"added,omitempty"`
+	Removed   []string `json:"removed,omitempty"`
+}
+
+// SettingsRestoreResult reports the version created by restoring an earlier
+// one and the mapping migration it required.
+type SettingsRestoreResult struct {
+	Version   IndexSettingsVersion `json:"version"`
+	Migration MappingChangeResult  `json:"migration"`
+}
+
+// InterruptedMigration is the state of a reindex that was still running when
+// the service shut down. JournaledIDs are the documents written to the source
+// index during the reindex that had not been replayed into the target yet.
+type InterruptedMigration struct {
+	IndexName     string    `json:"index_name"`
+	SourceIndex   string    `json:"source_index"`
+	TargetIndex   string    `json:"target_index"`
+	StartedAt     time.Time `json:"started_at"`
+	InterruptedAt time.Time `json:"interrupted_at"`
+	JournaledIDs  []string  `json:"journaled_ids"`
 }
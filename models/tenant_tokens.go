@@ -0,0 +1,46 @@
+package models
+
+import (
+	"path"
+	"time"
+)
+
+// TenantTokenClaims is the payload of a tenant token. Filter is ANDed into
+// every search and facet request made with the token, on the indices
+// matching Indices only.
+type TenantTokenClaims struct {
+	Indices []string `json:"indices"`
+	Filter  Filter   `json:"filter"`
+	// FieldAccess is inherited from the key the token was minted with.
+	FieldAccess
+	// APIKeyID is the key the token was minted with; revoking the key
+	// invalidates the token. Tokens minted outside the service leave it
+	// empty.
+	APIKeyID  string `json:"api_key,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Allows reports whether the token may be used to search index.
+func (c TenantTokenClaims) Allows(index string) bool {
+	for _, pattern := range c.Indices {
+		if ok, _ := path.Match(pattern, index); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateTenantTokenRequest is the body accepted when minting a tenant token.
+type CreateTenantTokenRequest struct {
+	Indices   []string  `json:"indices"`
+	Filter    Filter    `json:"filter"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TenantToken is a signed token to hand to a frontend, sent as
+// "Authorization: Bearer <token>".
+type TenantToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
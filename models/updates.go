@@ -0,0 +1,46 @@
+package models
+
+// Operations supported by scripted document updates.
+const (
+	UpdateOpAppend    = "append"
+	UpdateOpRemove    = "remove"
+	UpdateOpModify    = "modify"
+	UpdateOpIncrement = "increment"
+)
+
+// FieldUpdate describes a single scripted change to a document. Path is the
+// full field path, e.g. "content.reviews", and Where selects array items whose
+// fields equal the given values.
+//
+//   - append adds Item to the array at Path.
+//   - remove deletes the items of the array at Path matching Where.
+//   - modify sets the fields in Set on the items matching Where.
+//   - increment adds By to the number at Path or, when Where is given, to
+//     Field of the matching items of the array at Path.
+type FieldUpdate struct {
+	Op    string                 `json:"op"`
+	Path  string                 `json:"path"`
+	Item  map[string]interface{} `json:"item,omitempty"`
+	Where map[string]interface{} `json:"where,omitempty"`
+	Set   map[string]interface{} `json:"set,omitempty"`
+	Field string                 `json:"field,omitempty"`
+	By    float64                `json:"by,omitempty"`
+}
+
+type UpdateByQueryRequest struct {
+	Filter Filter      `json:"filter"`
+	Update FieldUpdate `json:"update"`
+}
+
+type UpdateByQueryResponse struct {
+	Updated          int64 `json:"updated"`
+	Noops            int64 `json:"noops"`
+	VersionConflicts int64 `json:"version_conflicts"`
+}
+
+// ManagedScript is a stored script the service installs and invokes.
+type ManagedScript struct {
+	ID        string `json:"id"`
+	Op        string `json:"op"`
+	Installed bool   `json:"installed"`
+}
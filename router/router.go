@@ -2,22 +2,98 @@ package router
 
 import (
 	"elastic-search-config-service/handlers"
+	"elastic-search-config-service/metrics"
+	"elastic-search-config-service/middleware"
+	"elastic-search-config-service/models"
 	"elastic-search-config-service/services"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
-func NewRouter(esClient *services.ElasticsearchClient) *mux.Router {
+// Options configures the middleware NewRouter puts in front of handlers.
+type Options struct {
+	// Deadlines bounds requests by endpoint group: search, facets,
+	// documents and admin.
+	Deadlines map[string]time.Duration
+	// RequireAPIKeys makes every route but /metrics, /healthz and /readyz
+	// need an API key granted the route's action.
+	RequireAPIKeys bool
+	// RateLimits are the request budgets of each caller on each index:
+	// search (searches, facets and document reads), write and admin.
+	RateLimits map[string]middleware.Rate
+}
+
+// rateBudgets maps route actions onto the rate limit budget they spend.
+var rateBudgets = map[string]string{
+	models.ActionSearch:         "search",
+	models.ActionReadDocuments:  "search",
+	models.ActionWriteDocuments: "write",
+	models.ActionAdmin:          "admin",
+}
+
+// NewRouter wires every endpoint.
+func NewRouter(esClient *services.ElasticsearchClient, opts Options) *mux.Router {
 	r := mux.NewRouter()
+	r.Use(middleware.RequestID, middleware.Tracing, middleware.AccessLog, middleware.Metrics)
+	r.NotFoundHandler = middleware.RequestID(middleware.AccessLog(middleware.Metrics(handlers.NotFound())))
+	r.MethodNotAllowedHandler = middleware.RequestID(middleware.AccessLog(middleware.Metrics(handlers.MethodNotAllowed())))
+
+	// Tenant tokens are checked even when API keys are not required.
+	var keyAuth middleware.Authenticator
+	if opts.RequireAPIKeys {
+		keyAuth = esClient
+	}
+	limiter := middleware.NewRateLimiter(opts.RateLimits)
+	// route guards h with an API key granted action, spends the matching
+	// rate limit budget and bounds it with the deadline of group.
+	route := func(action, group string, h http.Handler) http.Handler {
+		return middleware.Authorize(esClient, opts.RequireAPIKeys, action,
+			middleware.RateLimit(limiter, rateBudgets[action],
+				middleware.Deadline(opts.Deadlines[group], h)))
+	}
+	// audited records each request to h as a configuration change.
+	audited := func(operation string, h http.HandlerFunc) http.Handler {
+		return middleware.Audit(esClient, operation, h)
+	}
 
-	r.HandleFunc("/index", handlers.PostIndex(esClient)).Methods("POST")
-	r.HandleFunc("/index/settings", handlers.PostIndexSettings(esClient)).Methods("POST")
-	r.HandleFunc("/{index_name}/documents", handlers.PostDocuments(esClient)).Methods("POST")
-	r.HandleFunc("/{index_name}/attributes", handlers.GetIndexAttributesHandler(esClient)).Methods("GET")
-	r.HandleFunc("/{index_name}/change_mappings", handlers.ChangeMappings(esClient)).Methods("POST")
-	r.HandleFunc("/{index_name}/search", handlers.Search(esClient)).Methods(http.MethodPost)
-	r.HandleFunc("/{index_name}/facets", handlers.GetFacets(esClient)).Methods(http.MethodPost)
+	r.Handle("/metrics", metrics.Handler()).Methods(http.MethodGet)
+	r.HandleFunc("/healthz", handlers.Healthz()).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", handlers.Readyz(esClient)).Methods(http.MethodGet)
+	r.Handle("/index", route(models.ActionAdmin, "admin", audited("create_index", handlers.PostIndex(esClient)))).Methods("POST")
+	r.Handle("/status", route(models.ActionAdmin, "admin", handlers.GetClusterStatus(esClient))).Methods(http.MethodGet)
+	r.Handle("/status/bootstrap", route(models.ActionAdmin, "", handlers.GetBootstrapStatus(esClient))).Methods(http.MethodGet)
+	r.Handle("/status/elasticsearch", route(models.ActionAdmin, "", handlers.GetResilienceStatus(esClient))).Methods(http.MethodGet)
+	r.Handle("/audit", route(models.ActionAdmin, "admin", handlers.GetAuditLog(esClient))).Methods(http.MethodGet)
+	r.Handle("/scripts", route(models.ActionAdmin, "", handlers.GetManagedScripts(esClient))).Methods(http.MethodGet)
+	r.Handle("/api-keys", route(models.ActionAdmin, "admin", audited("create_api_key", handlers.CreateAPIKey(esClient)))).Methods(http.MethodPost)
+	r.Handle("/api-keys", route(models.ActionAdmin, "admin", handlers.ListAPIKeys(esClient))).Methods(http.MethodGet)
+	r.Handle("/api-keys/{key_id}", route(models.ActionAdmin, "admin", handlers.GetAPIKey(esClient))).Methods(http.MethodGet)
+	r.Handle("/api-keys/{key_id}", route(models.ActionAdmin, "admin", audited("revoke_api_key", handlers.RevokeAPIKey(esClient)))).Methods(http.MethodDelete)
+	r.Handle("/tenant-tokens", middleware.Authenticate(keyAuth, middleware.RateLimit(limiter, "admin", handlers.CreateTenantToken(esClient)))).Methods(http.MethodPost)
+	r.Handle("/{index_name}/documents", route(models.ActionWriteDocuments, "documents", handlers.PostDocuments(esClient))).Methods("POST")
+	r.Handle("/{index_name}/documents/_mget", route(models.ActionReadDocuments, "documents", handlers.MultiGetDocuments(esClient))).Methods(http.MethodPost)
+	r.Handle("/{index_name}/documents/_delete_by_query", route(models.ActionWriteDocuments, "admin", handlers.DeleteDocumentsByQuery(esClient))).Methods(http.MethodPost)
+	r.Handle("/{index_name}/documents/_update_by_query", route(models.ActionWriteDocuments, "admin", handlers.UpdateDocumentsByQuery(esClient))).Methods(http.MethodPost)
+	r.Handle("/{index_name}/documents/{id}", route(models.ActionReadDocuments, "documents", handlers.GetDocument(esClient))).Methods(http.MethodGet)
+	r.Handle("/{index_name}/documents/{id}", route(models.ActionWriteDocuments, "documents", handlers.PutDocument(esClient))).Methods(http.MethodPut)
+	r.Handle("/{index_name}/documents/{id}", route(models.ActionWriteDocuments, "documents", handlers.PatchDocument(esClient))).Methods(http.MethodPatch)
+	r.Handle("/{index_name}/documents/{id}", route(models.ActionWriteDocuments, "documents", handlers.DeleteDocument(esClient))).Methods(http.MethodDelete)
+	r.Handle("/{index_name}/documents/{id}/_update", route(models.ActionWriteDocuments, "documents", handlers.ScriptUpdateDocument(esClient))).Methods(http.MethodPost)
+	r.Handle("/{index_name}/attributes", route(models.ActionAdmin, "admin", handlers.GetIndexAttributesHandler(esClient))).Methods("GET")
+	r.Handle("/{index_name}/settings", route(models.ActionAdmin, "admin", handlers.GetIndexSettings(esClient))).Methods(http.MethodGet)
+	r.Handle("/{index_name}/settings", route(models.ActionAdmin, "admin", audited("update_settings", handlers.PutIndexSettings(esClient)))).Methods(http.MethodPut)
+	r.Handle("/{index_name}/settings/displayed_attributes", route(models.ActionAdmin, "admin", audited("update_displayed_attributes", handlers.PutDisplayedAttributes(esClient)))).Methods(http.MethodPut)
+	r.Handle("/{index_name}/settings/history", route(models.ActionAdmin, "admin", handlers.GetSettingsHistory(esClient))).Methods(http.MethodGet)
+	r.Handle("/{index_name}/settings/history/{version}/restore", route(models.ActionAdmin, "admin", audited("restore_settings", handlers.RestoreSettingsVersion(esClient)))).Methods(http.MethodPost)
+	r.Handle("/{index_name}/settings/diff", route(models.ActionAdmin, "admin", handlers.GetSettingsDiff(esClient))).Methods(http.MethodGet)
+	r.Handle("/{index_name}/config/export", route(models.ActionAdmin, "admin", handlers.ExportIndexConfig(esClient))).Methods(http.MethodGet)
+	r.Handle("/{index_name}/config/import", route(models.ActionAdmin, "admin", audited("import_config", handlers.ImportIndexConfig(esClient)))).Methods(http.MethodPost)
+	r.Handle("/{index_name}/change_mappings", route(models.ActionAdmin, "admin", audited("change_mappings", handlers.ChangeMappings(esClient)))).Methods("POST")
+	r.Handle("/{index_name}/search", route(models.ActionSearch, "search", handlers.Search(esClient))).Methods(http.MethodPost)
+	r.Handle("/{index_name}/facets", route(models.ActionSearch, "facets", handlers.GetFacets(esClient))).Methods(http.MethodPost)
+	r.Handle("/{index_name}/mapping-cache", route(models.ActionAdmin, "", handlers.GetMappingCache(esClient))).Methods(http.MethodGet)
 	// TODO: add synonym support
 
 	return r
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"elastic-search-config-service/models"
+	"elastic-search-config-service/store"
+)
+
+const (
+	// apiKeyPrefix starts every key so that leaked keys are easy to spot.
+	apiKeyPrefix = "ecs_"
+	// apiKeyCacheTTL bounds how long a key revoked on another replica keeps
+	// working on this one.
+	apiKeyCacheTTL = 30 * time.Second
+	// apiKeyTouchInterval limits how often the last use of a key is written
+	// back to the config store.
+	apiKeyTouchInterval = time.Minute
+	// AdminAPIKeyID identifies requests made with the admin key configured at
+	// startup.
+	AdminAPIKeyID = "admin"
+)
+
+// storedAPIKey is the config store record of a key. Only the SHA-256 of the
+// secret is kept; secrets are random, so a plain hash is enough.
+type storedAPIKey struct {
+	models.APIKey
+	Hash string `json:"hash"`
+}
+
+type cachedAPIKey struct {
+	key       storedAPIKey
+	loadedAt  time.Time
+	touchedAt time.Time
+}
+
+// apiKeyring caches keys read from the config store and holds the admin key.
+type apiKeyring struct {
+	mu    sync.Mutex
+	admin []byte
+	keys  map[string]*cachedAPIKey
+}
+
+func newAPIKeyring() *apiKeyring {
+	return &apiKeyring{keys: make(map[string]*cachedAPIKey)}
+}
+
+// SetAdminAPIKey configures a key that is granted every action on every
+// index, so that the first keys can be created. An empty key disables it.
+func (es *ElasticsearchClient) SetAdminAPIKey(key string) {
+	es.apiKeys.mu.Lock()
+	defer es.apiKeys.mu.Unlock()
+	es.apiKeys.admin = nil
+	if key != "" {
+		es.apiKeys.admin = hashSecret(key)
+	}
+}
+
+func hashSecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// splitAPIKey separates a presented key into its ID and secret.
+func splitAPIKey(key string) (id, secret string, ok bool) {
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix)
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, ".")
+}
+
+// AuthenticateAPIKey resolves a key presented by a client. ok is false for
+// unknown, malformed, revoked and expired keys; err is only set when the
+// config store could not be read. remoteAddr is recorded as the last use.
+func (es *ElasticsearchClient) AuthenticateAPIKey(ctx context.Context, key, remoteAddr string) (models.APIKey, bool, error) {
+	es.apiKeys.mu.Lock()
+	admin := es.apiKeys.admin
+	es.apiKeys.mu.Unlock()
+	if admin != nil && subtle.ConstantTimeCompare(hashSecret(key), admin) == 1 {
+		return models.APIKey{
+			ID:      AdminAPIKeyID,
+			Name:    "admin key from configuration",
+			Actions: models.Actions,
+			Indices: []string{"*"},
+		}, true, nil
+	}
+
+	id, secret, ok := splitAPIKey(key)
+	if !ok {
+		return models.APIKey{}, false, nil
+	}
+	cached, err := es.cachedAPIKey(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return models.APIKey{}, false, nil
+	}
+	if err != nil {
+		return models.APIKey{}, false, err
+	}
+
+	want, err := hex.DecodeString(cached.key.Hash)
+	if err != nil || subtle.ConstantTimeCompare(hashSecret(secret), want) != 1 {
+		return models.APIKey{}, false, nil
+	}
+	now := time.Now()
+	if !cached.key.Active(now) {
+		return models.APIKey{}, false, nil
+	}
+	es.touchAPIKey(ctx, id, remoteAddr, now)
+	return cached.key.APIKey, true, nil
+}
+
+func (es *ElasticsearchClient) cachedAPIKey(ctx context.Context, id string) (cachedAPIKey, error) {
+	es.apiKeys.mu.Lock()
+	cached, ok := es.apiKeys.keys[id]
+	es.apiKeys.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < apiKeyCacheTTL {
+		return *cached, nil
+	}
+
+	rec, err := es.store.Get(ctx, store.CollectionAPIKeys, id)
+	if err != nil {
+		return cachedAPIKey{}, err
+	}
+	var key storedAPIKey
+	if err := json.Unmarshal(rec.Value, &key); err != nil {
+		return cachedAPIKey{}, fmt.Errorf("error decoding api key %s: %w", id, err)
+	}
+
+	es.apiKeys.mu.Lock()
+	defer es.apiKeys.mu.Unlock()
+	fresh := &cachedAPIKey{key: key, loadedAt: time.Now()}
+	if ok {
+		fresh.touchedAt = cached.touchedAt
+	}
+	es.apiKeys.keys[id] = fresh
+	return *fresh, nil
+}
+
+// touchAPIKey records the last use of a key, at most once per
+// apiKeyTouchInterval and without delaying the request.
+func (es *ElasticsearchClient) touchAPIKey(ctx context.Context, id, remoteAddr string, now time.Time) {
+	es.apiKeys.mu.Lock()
+	cached, ok := es.apiKeys.keys[id]
+	if !ok || now.Sub(cached.touchedAt) < apiKeyTouchInterval {
+		es.apiKeys.mu.Unlock()
+		return
+	}
+	cached.touchedAt = now
+	es.apiKeys.mu.Unlock()
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		_, err := es.updateAPIKey(ctx, id, func(key *storedAPIKey) error {
+			key.LastUsedAt = &now
+			key.LastUsedFrom = remoteAddr
+			return nil
+		})
+		if err != nil {
+			slog.WarnContext(ctx, "error recording api key use", "api_key", id, "error", err)
+		}
+	}()
+}
+
+// CreateAPIKey stores a new key and returns it with its secret, which is not
+// kept and cannot be shown again. createdBy is the ID of the key that made
+// the request.
+func (es *ElasticsearchClient) CreateAPIKey(ctx context.Context, req models.CreateAPIKeyRequest, createdBy string) (models.CreatedAPIKey, error) {
+	if err := validateAPIKeyRequest(req); err != nil {
+		return models.CreatedAPIKey{}, err
+	}
+	if err := es.validateFieldAccess(ctx, req.Indices, req.FieldAccess); err != nil {
+		return models.CreatedAPIKey{}, err
+	}
+
+	id, err := randomToken(8, hex.EncodeToString)
+	if err != nil {
+		return models.CreatedAPIKey{}, err
+	}
+	secret, err := randomToken(24, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return models.CreatedAPIKey{}, err
+	}
+
+	key := storedAPIKey{
+		APIKey: models.APIKey{
+			ID:              id,
+			Name:            req.Name,
+			Actions:         req.Actions,
+			Indices:         req.Indices,
+			FieldAccess:     req.FieldAccess,
+			DocumentsPerDay: req.DocumentsPerDay,
+			ExpiresAt:       req.ExpiresAt,
+			CreatedAt:       time.Now().UTC(),
+			CreatedBy:       createdBy,
+		},
+		Hash: hex.EncodeToString(hashSecret(secret)),
+	}
+	data, err := json.Marshal(key)
+	if err != nil {
+		return models.CreatedAPIKey{}, err
+	}
+	if _, err := es.store.Put(ctx, store.CollectionAPIKeys, id, data, 0); err != nil {
+		return models.CreatedAPIKey{}, fmt.Errorf("error saving api key: %w", err)
+	}
+	slog.InfoContext(ctx, "api key created", "api_key", id, "name", req.Name, "actions", req.Actions, "indices", req.Indices, "created_by", createdBy)
+	return models.CreatedAPIKey{APIKey: key.APIKey, Key: apiKeyPrefix + id + "." + secret}, nil
+}
+
+func validateAPIKeyRequest(req models.CreateAPIKeyRequest) error {
+	var invalid []FieldError
+	if strings.TrimSpace(req.Name) == "" {
+		invalid = append(invalid, FieldError{Field: "name", Reason: "must not be empty"})
+	}
+	if len(req.Actions) == 0 {
+		invalid = append(invalid, FieldError{Field: "actions", Reason: "must not be empty"})
+	}
+	for _, action := range req.Actions {
+		known := false
+		for _, a := range models.Actions {
+			known = known || a == action
+		}
+		if !known {
+			invalid = append(invalid, FieldError{Field: "actions", Reason: "unknown action " + action})
+		}
+	}
+	if len(req.Indices) == 0 {
+		invalid = append(invalid, FieldError{Field: "indices", Reason: "must not be empty"})
+	}
+	for _, pattern := range req.Indices {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			invalid = append(invalid, FieldError{Field: "indices", Reason: "invalid index pattern " + pattern})
+		}
+	}
+	if req.DocumentsPerDay < 0 {
+		invalid = append(invalid, FieldError{Field: "documents_per_day", Reason: "must not be negative"})
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		invalid = append(invalid, FieldError{Field: "expires_at", Reason: "must be in the future"})
+	}
+	if len(invalid) > 0 {
+		return &Error{Kind: ErrInvalidRequest, Message: "invalid api key", Fields: invalid}
+	}
+	return nil
+}
+
+// validateFieldAccess checks the field rules of a key against the mapping of
+// every index the key names exactly. Patterns cannot be resolved to indices
+// up front and indices that do not exist yet are skipped.
+func (es *ElasticsearchClient) validateFieldAccess(ctx context.Context, indices []string, access models.FieldAccess) error {
+	if len(access.AllowedFields) == 0 && len(access.DeniedFields) == 0 {
+		return nil
+	}
+	var invalid []FieldError
+	for _, index := range indices {
+		if strings.ContainsAny(index, "*?[") {
+			continue
+		}
+		qb, err := es.GetMappingBuilder(ctx, models.GetIndexInfo(models.IndexName{Index: index}))
+		if KindOf(err) == ErrIndexNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		invalid = append(invalid, unknownFields(&qb, "allowed_fields of "+index, access.AllowedFields)...)
+		invalid = append(invalid, unknownFields(&qb, "denied_fields of "+index, access.DeniedFields)...)
+	}
+	if len(invalid) > 0 {
+		return invalidFieldsError("invalid api key field rules", invalid)
+	}
+	return nil
+}
+
+func randomToken(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encode(b), nil
+}
+
+// ListAPIKeys returns every key, including revoked ones, without secrets.
+func (es *ElasticsearchClient) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	records, err := es.store.List(ctx, store.CollectionAPIKeys)
+	if err != nil {
+		return nil, fmt.Errorf("error listing api keys: %w", err)
+	}
+	keys := make([]models.APIKey, 0, len(records))
+	for _, rec := range records {
+		var key storedAPIKey
+		if err := json.Unmarshal(rec.Value, &key); err != nil {
+			return nil, fmt.Errorf("error decoding api key %s: %w", rec.Key, err)
+		}
+		keys = append(keys, key.APIKey)
+	}
+	return keys, nil
+}
+
+// GetAPIKey returns a single key without its secret.
+func (es *ElasticsearchClient) GetAPIKey(ctx context.Context, id string) (models.APIKey, error) {
+	rec, err := es.store.Get(ctx, store.CollectionAPIKeys, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return models.APIKey{}, &Error{Kind: ErrAPIKeyNotFound, Message: "api key " + id + " not found"}
+	}
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("error getting api key: %w", err)
+	}
+	var key storedAPIKey
+	if err := json.Unmarshal(rec.Value, &key); err != nil {
+		return models.APIKey{}, fmt.Errorf("error decoding api key %s: %w", id, err)
+	}
+	return key.APIKey, nil
+}
+
+// RevokeAPIKey disables a key. The record is kept so that its audit fields
+// remain available.
+func (es *ElasticsearchClient) RevokeAPIKey(ctx context.Context, id, revokedBy string) (models.APIKey, error) {
+	key, err := es.updateAPIKey(ctx, id, func(key *storedAPIKey) error {
+		if key.RevokedAt == nil {
+			now := time.Now().UTC()
+			key.RevokedAt = &now
+			key.RevokedBy = revokedBy
+		}
+		return nil
+	})
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	es.apiKeys.mu.Lock()
+	delete(es.apiKeys.keys, id)
+	es.apiKeys.mu.Unlock()
+	slog.InfoContext(ctx, "api key revoked", "api_key", id, "revoked_by", revokedBy)
+	return key.APIKey, nil
+}
+
+// updateAPIKey applies fn to the stored key, retrying on concurrent writes.
+func (es *ElasticsearchClient) updateAPIKey(ctx context.Context, id string, fn func(key *storedAPIKey) error) (storedAPIKey, error) {
+	var key storedAPIKey
+	_, err := store.Update(ctx, es.store, store.CollectionAPIKeys, id, func(current []byte) ([]byte, error) {
+		if current == nil {
+			return nil, &Error{Kind: ErrAPIKeyNotFound, Message: "api key " + id + " not found"}
+		}
+		key = storedAPIKey{}
+		if err := json.Unmarshal(current, &key); err != nil {
+			return nil, fmt.Errorf("error decoding api key %s: %w", id, err)
+		}
+		if err := fn(&key); err != nil {
+			return nil, err
+		}
+		return json.Marshal(key)
+	})
+	return key, err
+}
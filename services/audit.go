@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"elastic-search-config-service/models"
+	"elastic-search-config-service/store"
+)
+
+// SetAuditLog sets where configuration changes are recorded; nil disables
+// recording.
+func (es *ElasticsearchClient) SetAuditLog(l store.AuditLog) {
+	es.auditLog = l
+}
+
+// AuditSnapshot returns the configuration of a logical index as JSON, or nil
+// when it cannot be read, typically because the index does not exist.
+func (es *ElasticsearchClient) AuditSnapshot(ctx context.Context, index string) json.RawMessage {
+	if es.auditLog == nil {
+		return nil
+	}
+	cfg, err := es.IndexConfig(ctx, models.GetIndexInfo(models.IndexName{Index: index}))
+	if err != nil {
+		slog.DebugContext(ctx, "no configuration to audit", "index", index, "error", err)
+		return nil
+	}
+	snapshot, err := json.Marshal(cfg)
+	if err != nil {
+		return nil
+	}
+	return snapshot
+}
+
+// RecordAudit appends entry to the audit log. The change it describes has
+// already happened, so a failure to record it is only logged.
+func (es *ElasticsearchClient) RecordAudit(ctx context.Context, entry models.AuditEntry) {
+	if es.auditLog == nil {
+		return
+	}
+	if err := es.auditLog.Append(ctx, entry); err != nil {
+		slog.ErrorContext(ctx, "error recording audit entry",
+			"operation", entry.Operation, "index", entry.Index, "actor", entry.Actor, "error", err)
+	}
+}
+
+// QueryAudit returns the audit entries matching q, newest first.
+func (es *ElasticsearchClient) QueryAudit(ctx context.Context, q models.AuditQuery) ([]models.AuditEntry, error) {
+	if es.auditLog == nil {
+		return []models.AuditEntry{}, nil
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return nil, invalidRequestError("to must not be before from")
+	}
+	entries, err := es.auditLog.Query(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("error querying audit log: %w", err)
+	}
+	return entries, nil
+}
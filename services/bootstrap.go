@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"elastic-search-config-service/models"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// Bootstrap states reported by BootstrapStatus.
+const (
+	BootstrapPending   = "pending"
+	BootstrapRunning   = "running"
+	BootstrapCompleted = "completed"
+	BootstrapFailed    = "failed"
+	BootstrapDisabled  = "disabled"
+)
+
+// BootstrapReport summarises how the mapping registry was populated at startup.
+type BootstrapReport struct {
+	State           string            `json:"state"`
+	StartedAt       *time.Time        `json:"started_at,omitempty"`
+	FinishedAt      *time.Time        `json:"finished_at,omitempty"`
+	ImportedLegacy  int               `json:"imported_legacy"`
+	LoadedFromStore int               `json:"loaded_from_store"`
+	StoreLoaded     bool              `json:"store_loaded"`
+	Discovered      []string          `json:"discovered"`
+	Inferred        []string          `json:"inferred"`
+	Failed          map[string]string `json:"failed,omitempty"`
+	Error           string            `json:"error,omitempty"`
+	// InterruptedMigrations were left unfinished by a previous shutdown.
+	InterruptedMigrations []models.InterruptedMigration `json:"interrupted_migrations,omitempty"`
+}
+
+type bootstrapState struct {
+	mu     sync.RWMutex
+	report BootstrapReport
+}
+
+// BootstrapStatus returns a copy of the latest bootstrap report.
+func (es *ElasticsearchClient) BootstrapStatus() BootstrapReport {
+	es.bootstrap.mu.RLock()
+	defer es.bootstrap.mu.RUnlock()
+	report := es.bootstrap.report
+	report.Discovered = append([]string(nil), report.Discovered...)
+	report.Inferred = append([]string(nil), report.Inferred...)
+	report.InterruptedMigrations = append([]models.InterruptedMigration(nil), report.InterruptedMigrations...)
+	failed := make(map[string]string, len(report.Failed))
+	for k, v := range report.Failed {
+		failed[k] = v
+	}
+	report.Failed = failed
+	return report
+}
+
+func (es *ElasticsearchClient) updateBootstrap(fn func(r *BootstrapReport)) {
+	es.bootstrap.mu.Lock()
+	defer es.bootstrap.mu.Unlock()
+	fn(&es.bootstrap.report)
+}
+
+// Bootstrap populates the mapping registry: legacy mappings are imported into
+// the config store, every stored mapping is loaded and, when discover is set,
+// each *_ReadAlias alias in the cluster has its mapping inferred. Missing
+// legacy mappings are not an error; the service simply starts empty.
+func (es *ElasticsearchClient) Bootstrap(ctx context.Context, legacy map[string]models.MappingInfo, discover bool) error {
+	imported, err := es.ImportMappings(ctx, legacy)
+	if err != nil {
+		return err
+	}
+	loaded, err := es.LoadMappingsFromStore(ctx)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "bootstrap loaded mappings", "imported_legacy", imported, "loaded_from_store", loaded)
+
+	interrupted, err := es.InterruptedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range interrupted {
+		slog.WarnContext(ctx, "migration was interrupted by a shutdown",
+			"index", m.IndexName, "source", m.SourceIndex, "target", m.TargetIndex,
+			"journaled", len(m.JournaledIDs), "interrupted_at", m.InterruptedAt)
+	}
+	cleaned, err := es.CleanupAbandonedMigrations(ctx, interrupted)
+	if err != nil {
+		return err
+	}
+	if cleaned > 0 {
+		slog.InfoContext(ctx, "bootstrap cleaned up abandoned migrations", "migrations", cleaned)
+	}
+
+	es.updateBootstrap(func(r *BootstrapReport) {
+		r.InterruptedMigrations = interrupted
+		r.ImportedLegacy = imported
+		r.LoadedFromStore = loaded
+		r.StoreLoaded = true
+		r.State = BootstrapDisabled
+		if discover {
+			r.State = BootstrapPending
+		}
+	})
+	if discover {
+		go es.discoverIndices(ctx)
+	}
+	return nil
+}
+
+// discoverIndices infers and caches the mapping of every logical index found
+// through its read alias.
+func (es *ElasticsearchClient) discoverIndices(ctx context.Context) {
+	started := time.Now()
+	es.updateBootstrap(func(r *BootstrapReport) {
+		r.State = BootstrapRunning
+		r.StartedAt = &started
+	})
+
+	indices, err := es.DiscoverLogicalIndices(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "bootstrap alias discovery failed", "error", err)
+		finished := time.Now()
+		es.updateBootstrap(func(r *BootstrapReport) {
+			r.State = BootstrapFailed
+			r.Error = err.Error()
+			r.FinishedAt = &finished
+		})
+		return
+	}
+
+	var inferred []string
+	failed := make(map[string]string)
+	for _, name := range indices {
+		ind := models.GetIndexInfo(models.IndexName{Index: name})
+		info, err := es.InferMappingsFromES(ctx, ind.ReadAlias)
+		if err != nil {
+			failed[name] = err.Error()
+			continue
+		}
+		info.IndexName = name
+		version, err := es.saveMapping(ctx, *info)
+		if err != nil {
+			failed[name] = err.Error()
+			continue
+		}
+		es.mappings.Put(name, *info, MappingSourceElasticsearch, version)
+		inferred = append(inferred, name)
+	}
+
+	finished := time.Now()
+	slog.InfoContext(ctx, "bootstrap discovery finished",
+		"discovered", len(indices), "inferred", len(inferred), "failed", len(failed),
+		"duration_ms", finished.Sub(started).Milliseconds())
+	for name, reason := range failed {
+		slog.WarnContext(ctx, "bootstrap could not infer mapping", "index", name, "error", reason)
+	}
+	es.updateBootstrap(func(r *BootstrapReport) {
+		r.State = BootstrapCompleted
+		r.Discovered = indices
+		r.Inferred = inferred
+		r.Failed = failed
+		r.FinishedAt = &finished
+	})
+}
+
+// DiscoverLogicalIndices lists the logical indices managed by the service,
+// identified by their read alias.
+func (es *ElasticsearchClient) DiscoverLogicalIndices(ctx context.Context) ([]string, error) {
+	suffix := models.GetIndexInfo(models.IndexName{}).ReadAlias
+	req := esapi.IndicesGetAliasRequest{
+		Name: []string{"*" + suffix},
+	}
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		return nil, transportError("error discovering aliases", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if res.IsError() {
+		return nil, responseError("error discovering aliases", res)
+	}
+
+	var aliasResponse map[string]struct {
+		Aliases map[string]json.RawMessage `json:"aliases"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&aliasResponse); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	for _, index := range aliasResponse {
+		for alias := range index.Aliases {
+			if strings.HasSuffix(alias, suffix) {
+				seen[strings.TrimSuffix(alias, suffix)] = struct{}{}
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
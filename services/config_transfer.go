@@ -0,0 +1,337 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"elastic-search-config-service/models"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// ExportIndexConfig returns the configuration of a logical index as a single
+// document that ImportIndexConfig can apply to an index of any cluster.
+func (es *ElasticsearchClient) ExportIndexConfig(ctx context.Context, ind models.IndexInfo) (models.IndexConfigExport, error) {
+	writeIndices, err := es.aliasIndices(ctx, ind.WriteAlias)
+	if err != nil {
+		return models.IndexConfigExport{}, err
+	}
+	index := writeIndices[len(writeIndices)-1]
+	physical, err := es.physicalIndexSettings(ctx, index)
+	if err != nil {
+		return models.IndexConfigExport{}, err
+	}
+	mappings, err := es.physicalIndexMappings(ctx, index)
+	if err != nil {
+		return models.IndexConfigExport{}, err
+	}
+	settings, err := es.GetIndexSettings(ctx, ind)
+	if err != nil {
+		return models.IndexConfigExport{}, err
+	}
+	history, err := es.SettingsHistory(ctx, ind)
+	if err != nil {
+		return models.IndexConfigExport{}, err
+	}
+
+	export := models.IndexConfigExport{
+		FormatVersion: models.ConfigFormatVersion,
+		IndexName:     ind.IndexName,
+		ExportedAt:    time.Now().UTC(),
+		Schema:        schemaFromIndex(mappings, physical, settings),
+		Settings:      settings,
+		IndexSettings: dynamicSettingsOf(physical),
+	}
+	if len(history) > 0 {
+		export.SettingsVersion = history[len(history)-1].Version
+	}
+	return export, nil
+}
+
+// ImportIndexConfig brings a logical index in line with an exported
+// configuration: the index is created from the schema when missing, then
+// differing dynamic settings and attributes are applied, migrating the
+// mapping when searchable or facet attributes change. In plan mode nothing
+// is changed. Importing the same document twice changes nothing the second
+// time.
+func (es *ElasticsearchClient) ImportIndexConfig(ctx context.Context, ind models.IndexInfo, config models.IndexConfigExport, mode string) (models.ConfigImportPlan, error) {
+	if mode != models.ImportPlan && mode != models.ImportApply {
+		return models.ConfigImportPlan{}, invalidRequestError("mode must be plan or apply")
+	}
+	plan, err := es.planConfigImport(ctx, ind, config)
+	if err != nil {
+		return plan, err
+	}
+	plan.Mode = mode
+	if mode == models.ImportPlan || plan.Unchanged {
+		return plan, nil
+	}
+
+	if plan.CreateIndex {
+		if err := es.CreateIndexAndAliases(ctx, ind, &config.Schema); err != nil {
+			return plan, err
+		}
+	}
+	if len(plan.IndexSettings) > 0 {
+		if _, err := es.UpdateIndexSettings(ctx, ind, plan.IndexSettings); err != nil {
+			return plan, err
+		}
+	}
+	if plan.Remap {
+		migration, err := es.remapIndex(ctx, ind, config.Settings, nil)
+		if err != nil {
+			return plan, err
+		}
+		plan.Migration = &migration
+	}
+	if len(plan.Attributes) > 0 {
+		_, version, err := es.storeIndexSettings(ctx, ind.IndexName, 0, func(s *models.IndexSettings) {
+			*s = config.Settings
+		})
+		if err != nil {
+			return plan, err
+		}
+		plan.SettingsVersion = version.Version
+	}
+	return plan, nil
+}
+
+// planConfigImport validates config and compares it with the current state
+// of the index.
+func (es *ElasticsearchClient) planConfigImport(ctx context.Context, ind models.IndexInfo, config models.IndexConfigExport) (models.ConfigImportPlan, error) {
+	plan := models.ConfigImportPlan{IndexName: ind.IndexName}
+	if config.FormatVersion < 1 || config.FormatVersion > models.ConfigFormatVersion {
+		return plan, invalidRequestError(fmt.Sprintf("unsupported format_version %d", config.FormatVersion))
+	}
+	if err := validateSchema(&config.Schema); err != nil {
+		return plan, err
+	}
+	wanted := make(map[string]interface{})
+	flattenSettings("", config.IndexSettings, wanted)
+	if err := validateDynamicSettings(wanted); err != nil {
+		return plan, err
+	}
+
+	writeIndices, err := es.aliasIndices(ctx, ind.WriteAlias)
+	switch {
+	case KindOf(err) == ErrIndexNotFound:
+		if err := validateSchemaAttributes(&config.Schema, config.Settings); err != nil {
+			return plan, err
+		}
+		plan.CreateIndex = true
+		if len(wanted) > 0 {
+			plan.IndexSettings = wanted
+		}
+		plan.Attributes = diffSettings(models.IndexSettings{}, config.Settings)
+		// The schema already maps its searchable and facet fields; only
+		// attributes that differ from it need a remap
+		searchable, facet := schemaAttributes(&config.Schema)
+		plan.Remap = !sameAttributes(searchable, config.Settings.SearchableAttributes) ||
+			!sameAttributes(facet, config.Settings.FacetAttributes)
+		return plan, nil
+	case err != nil:
+		return plan, err
+	}
+
+	qb, err := es.GetMappingBuilder(ctx, ind)
+	if err != nil {
+		return plan, err
+	}
+	var invalid []FieldError
+	invalid = append(invalid, unknownFields(&qb, "searchable_attributes", config.Settings.SearchableAttributes)...)
+	invalid = append(invalid, unknownFields(&qb, "facet_attributes", config.Settings.FacetAttributes)...)
+	invalid = append(invalid, unknownFields(&qb, "displayed_attributes", config.Settings.DisplayedAttributes)...)
+	if len(invalid) > 0 {
+		return plan, invalidFieldsError("invalid index settings", invalid)
+	}
+
+	physical, err := es.physicalIndexSettings(ctx, writeIndices[len(writeIndices)-1])
+	if err != nil {
+		return plan, err
+	}
+	current := dynamicSettingsOf(physical)
+	for key, value := range wanted {
+		if have, ok := current[key]; !ok || fmt.Sprint(have) != fmt.Sprint(value) {
+			if plan.IndexSettings == nil {
+				plan.IndexSettings = make(map[string]interface{})
+			}
+			plan.IndexSettings[key] = value
+		}
+	}
+	plan.Warnings = staticSchemaWarnings(config.Schema, physical)
+
+	settings, err := es.GetIndexSettings(ctx, ind)
+	if err != nil {
+		return plan, err
+	}
+	plan.Attributes = diffSettings(settings, config.Settings)
+	for _, change := range plan.Attributes {
+		if change.Attribute != "displayed_attributes" {
+			plan.Remap = true
+		}
+	}
+	if plan.Remap && len(config.Settings.SearchableAttributes) == 0 && len(config.Settings.FacetAttributes) == 0 {
+		return plan, invalidRequestError("settings have no searchable or facet attributes to remap the index to")
+	}
+	plan.Unchanged = len(plan.IndexSettings) == 0 && len(plan.Attributes) == 0
+	return plan, nil
+}
+
+// sameAttributes reports whether a and b hold the same attributes in any order.
+func sameAttributes(a, b []string) bool {
+	return len(missingFrom(a, b)) == 0 && len(missingFrom(b, a)) == 0
+}
+
+// validateSchemaAttributes checks that the searchable and facet attributes
+// name fields declared by the schema the index is about to be created from,
+// since the mapping has to hold them before it can be remapped.
+func validateSchemaAttributes(schema *models.IndexSchema, settings models.IndexSettings) error {
+	var invalid []FieldError
+	check := func(name string, attributes []string) {
+		for _, attribute := range attributes {
+			if _, ok := schema.Fields[attribute]; !ok {
+				invalid = append(invalid, FieldError{Field: attribute, Reason: "not declared in schema (" + name + ")"})
+			}
+		}
+	}
+	check("searchable_attributes", settings.SearchableAttributes)
+	check("facet_attributes", settings.FacetAttributes)
+	if len(invalid) > 0 {
+		return invalidFieldsError("invalid index settings", invalid)
+	}
+	return nil
+}
+
+// staticSchemaWarnings lists the parts of schema that an existing index with
+// the given settings does not match and that cannot change without
+// recreating it.
+func staticSchemaWarnings(schema models.IndexSchema, physical map[string]interface{}) []string {
+	var warnings []string
+	if schema.Shards > 0 && fmt.Sprint(physical["number_of_shards"]) != strconv.Itoa(schema.Shards) {
+		warnings = append(warnings, fmt.Sprintf("number_of_shards is %v, not %d", physical["number_of_shards"], schema.Shards))
+	}
+	kinds := []string{"analyzer", "tokenizer", "filter", "char_filter", "normalizer"}
+	wanted := schemaAnalysis(&schema)
+	for _, kind := range kinds {
+		existing := analysisDefinitions(physical, kind)
+		names := make([]string, 0, len(wanted[kind]))
+		for name := range wanted[kind] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if _, ok := existing[name]; !ok {
+				warnings = append(warnings, strings.ReplaceAll(kind, "_", " ")+" "+name+" is not defined on the index")
+			}
+		}
+	}
+	return warnings
+}
+
+// physicalIndexMappings returns the mappings of a physical index.
+func (es *ElasticsearchClient) physicalIndexMappings(ctx context.Context, index string) (map[string]interface{}, error) {
+	req := esapi.IndicesGetMappingRequest{
+		Index: []string{index},
+	}
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		return nil, transportError("error getting index mapping", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, responseError("error getting index mapping", res)
+	}
+
+	var resp map[string]struct {
+		Mappings map[string]interface{} `json:"mappings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, err
+	}
+	return resp[index].Mappings, nil
+}
+
+// schemaFromIndex describes an existing index as the schema that would
+// create it. Facet and sortable produce the same mapping, so both come back
+// as facet; settings marks the facet attributes among other field types.
+func schemaFromIndex(mappings, physical map[string]interface{}, settings models.IndexSettings) models.IndexSchema {
+	schema := models.IndexSchema{
+		Analyzers:   analysisDefinitions(physical, "analyzer"),
+		Tokenizers:  analysisDefinitions(physical, "tokenizer"),
+		Filters:     analysisDefinitions(physical, "filter"),
+		CharFilters: analysisDefinitions(physical, "char_filter"),
+		Normalizers: analysisDefinitions(physical, "normalizer"),
+		Fields:      make(map[string]models.FieldSchema),
+	}
+	if dynamic, ok := mappings["dynamic"]; ok {
+		schema.Dynamic = fmt.Sprint(dynamic)
+	}
+	if shards, err := strconv.Atoi(fmt.Sprint(physical["number_of_shards"])); err == nil {
+		schema.Shards = shards
+	}
+	facets := make(map[string]struct{}, len(settings.FacetAttributes))
+	for _, attribute := range settings.FacetAttributes {
+		facets[attribute] = struct{}{}
+	}
+	properties, _ := mappings["properties"].(map[string]interface{})
+	schemaFields("", properties, facets, schema.Fields)
+	return schema
+}
+
+func schemaFields(prefix string, properties map[string]interface{}, facets map[string]struct{}, fields map[string]models.FieldSchema) {
+	for name, raw := range properties {
+		mapping, _ := raw.(map[string]interface{})
+		path := joinPath(prefix, name)
+		fieldType, _ := mapping["type"].(string)
+		if fieldType == "" {
+			fieldType = "object"
+		}
+		if _, ok := models.FieldTypes[fieldType]; !ok {
+			continue
+		}
+		indexed := fmt.Sprint(mapping["index"]) != "false"
+		_, facet := facets[path]
+
+		field := models.FieldSchema{Type: fieldType}
+		switch fieldType {
+		case "object", "nested":
+			children, _ := mapping["properties"].(map[string]interface{})
+			schemaFields(path, children, facets, fields)
+		case "text":
+			field.Searchable = indexed
+			field.Analyzer, _ = mapping["analyzer"].(string)
+			field.SearchAnalyzer, _ = mapping["search_analyzer"].(string)
+			multiFields, _ := mapping["fields"].(map[string]interface{})
+			_, keyword := multiFields["keyword"]
+			field.Facet = indexed && keyword
+		case "keyword":
+			field.Facet = indexed
+		default:
+			field.Searchable = indexed && !facet
+			field.Facet = indexed && facet
+		}
+		fields[path] = field
+	}
+}
+
+// analysisDefinitions returns the definitions of one section of the analysis
+// settings, such as "analyzer" or "filter", found in nested index settings.
+func analysisDefinitions(physical map[string]interface{}, kind string) map[string]map[string]interface{} {
+	analysis, _ := physical["analysis"].(map[string]interface{})
+	defined, _ := analysis[kind].(map[string]interface{})
+	if len(defined) == 0 {
+		return nil
+	}
+	definitions := make(map[string]map[string]interface{}, len(defined))
+	for name, raw := range defined {
+		if definition, ok := raw.(map[string]interface{}); ok {
+			definitions[name] = definition
+		}
+	}
+	return definitions
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"elastic-search-config-service/models"
+)
+
+var transferSchema = models.IndexSchema{
+	Shards: 2,
+	Analyzers: map[string]map[string]interface{}{
+		"folding": {"type": "custom", "tokenizer": "standard", "filter": []interface{}{"lowercase", "asciifolding"}},
+	},
+	Fields: map[string]models.FieldSchema{
+		"title":         {Type: "text", Searchable: true, Facet: true, Analyzer: "folding"},
+		"notes":         {Type: "text"},
+		"brand":         {Type: "keyword", Facet: true},
+		"sku":           {Type: "keyword", Sortable: true},
+		"price":         {Type: "float", Facet: true},
+		"stock":         {Type: "long", Searchable: true},
+		"supplier":      {Type: "nested"},
+		"supplier.name": {Type: "keyword", Facet: true},
+	},
+}
+
+func TestSchemaFromIndex(t *testing.T) {
+	built, err := buildIndexBody(&transferSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Elasticsearch returns the index as plain JSON.
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(marshalToJSONString(built)), &body); err != nil {
+		t.Fatal(err)
+	}
+	mappings := body["mappings"].(map[string]interface{})
+	// Unsupported types are left out of the schema.
+	mappings["properties"].(map[string]interface{})["location"] = map[string]interface{}{"type": "geo_point"}
+	physical := body["settings"].(map[string]interface{})
+	settings := models.IndexSettings{FacetAttributes: []string{"title", "brand", "price", "supplier.name"}}
+
+	got := schemaFromIndex(mappings, physical, settings)
+	if got.Shards != 2 {
+		t.Errorf("shards = %d, want 2", got.Shards)
+	}
+	if !reflect.DeepEqual(got.Analyzers, transferSchema.Analyzers) {
+		t.Errorf("analyzers = %v, want %v", got.Analyzers, transferSchema.Analyzers)
+	}
+	want := make(map[string]models.FieldSchema, len(transferSchema.Fields))
+	for path, field := range transferSchema.Fields {
+		// Sortable maps like facet and comes back as facet.
+		if field.Sortable {
+			field.Sortable, field.Facet = false, true
+		}
+		want[path] = field
+	}
+	if !reflect.DeepEqual(got.Fields, want) {
+		t.Errorf("fields = %+v, want %+v", got.Fields, want)
+	}
+}
+
+// clusterTransport answers requests by method and path, and 404 otherwise.
+type clusterTransport map[string]string
+
+func (c clusterTransport) Perform(req *http.Request) (*http.Response, error) {
+	body, ok := c[req.Method+" "+req.URL.Path]
+	code := http.StatusOK
+	if !ok {
+		code, body = http.StatusNotFound, `{"error":"not found","status":404}`
+	}
+	return &http.Response{StatusCode: code, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func TestImportIndexConfigPlan(t *testing.T) {
+	existing := clusterTransport{
+		"GET /_alias/products-write": `{"products-000001":{"aliases":{"products-write":{}}}}`,
+		"GET /products-000001/_settings": `{"products-000001":{"settings":{"index":{
+			"number_of_shards":"1","number_of_replicas":"1","refresh_interval":"1s"
+		}}}}`,
+	}
+	config := models.IndexConfigExport{
+		FormatVersion: models.ConfigFormatVersion,
+		IndexName:     "products",
+		Schema:        transferSchema,
+		Settings: models.IndexSettings{
+			SearchableAttributes: []string{"title", "stock"},
+			FacetAttributes:      []string{"title", "brand", "price", "supplier.name"},
+			DisplayedAttributes:  []string{"title", "brand", "price"},
+		},
+		IndexSettings: map[string]interface{}{"index": map[string]interface{}{"refresh_interval": "30s", "number_of_replicas": "1"}},
+	}
+
+	tests := []struct {
+		name      string
+		cluster   clusterTransport
+		displayed []string
+		edit      func(c *models.IndexConfigExport)
+		mode      string
+		// wantKind is the zero ErrInternal for a valid import.
+		wantKind ErrorKind
+		want     models.ConfigImportPlan
+	}{
+		{
+			name: "missing index",
+			want: models.ConfigImportPlan{
+				CreateIndex:   true,
+				IndexSettings: map[string]interface{}{"refresh_interval": "30s", "number_of_replicas": "1"},
+				Attributes: []models.AttributeChange{
+					{Attribute: "searchable_attributes", Added: []string{"title", "stock"}},
+					{Attribute: "facet_attributes", Added: []string{"title", "brand", "price", "supplier.name"}},
+					{Attribute: "displayed_attributes", Added: []string{"title", "brand", "price"}},
+				},
+			},
+		},
+		{
+			name: "missing index with attributes beyond the schema",
+			edit: func(c *models.IndexConfigExport) {
+				c.Settings.SearchableAttributes = []string{"title", "brand"}
+			},
+			want: models.ConfigImportPlan{
+				CreateIndex:   true,
+				IndexSettings: map[string]interface{}{"refresh_interval": "30s", "number_of_replicas": "1"},
+				Attributes: []models.AttributeChange{
+					{Attribute: "searchable_attributes", Added: []string{"title", "brand"}},
+					{Attribute: "facet_attributes", Added: []string{"title", "brand", "price", "supplier.name"}},
+					{Attribute: "displayed_attributes", Added: []string{"title", "brand", "price"}},
+				},
+				Remap: true,
+			},
+		},
+		{
+			name: "missing index with an undeclared attribute",
+			edit: func(c *models.IndexConfigExport) {
+				c.Settings.FacetAttributes = []string{"colour"}
+			},
+			wantKind: ErrInvalidField,
+		},
+		{
+			name:    "existing index",
+			cluster: existing,
+			edit: func(c *models.IndexConfigExport) {
+				c.Settings = models.IndexSettings{DisplayedAttributes: []string{"title", "brand"}}
+			},
+			want: models.ConfigImportPlan{
+				IndexSettings: map[string]interface{}{"refresh_interval": "30s"},
+				Attributes:    []models.AttributeChange{{Attribute: "displayed_attributes", Added: []string{"title", "brand"}}},
+				Warnings:      []string{"number_of_shards is 1, not 2", "analyzer folding is not defined on the index"},
+			},
+		},
+		{
+			name:      "existing index in line",
+			cluster:   existing,
+			displayed: []string{"title", "brand"},
+			edit: func(c *models.IndexConfigExport) {
+				c.Schema = models.IndexSchema{}
+				c.Settings = models.IndexSettings{DisplayedAttributes: []string{"brand", "title"}}
+				c.IndexSettings = map[string]interface{}{"refresh_interval": "1s"}
+			},
+			want: models.ConfigImportPlan{Attributes: []models.AttributeChange{}, Unchanged: true},
+		},
+		{
+			name:    "existing index with an unmapped attribute",
+			cluster: existing,
+			edit: func(c *models.IndexConfigExport) {
+				c.Settings = models.IndexSettings{DisplayedAttributes: []string{"colour"}}
+			},
+			wantKind: ErrInvalidField,
+		},
+		{
+			name:     "unsupported format version",
+			edit:     func(c *models.IndexConfigExport) { c.FormatVersion = models.ConfigFormatVersion + 1 },
+			wantKind: ErrInvalidRequest,
+		},
+		{
+			name:     "static index setting",
+			edit:     func(c *models.IndexConfigExport) { c.IndexSettings = map[string]interface{}{"number_of_shards": 3} },
+			wantKind: ErrInvalidField,
+		},
+		{
+			name:     "unknown mode",
+			mode:     "dry-run",
+			wantKind: ErrInvalidRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es := newFieldAccessClient(t, tt.displayed)
+			cluster := tt.cluster
+			if cluster == nil {
+				cluster = clusterTransport{}
+			}
+			es.transport = newResilientTransport(cluster, ResilienceConfig{})
+			c := config
+			if tt.edit != nil {
+				tt.edit(&c)
+			}
+			mode := tt.mode
+			if mode == "" {
+				mode = models.ImportPlan
+			}
+
+			got, err := es.ImportIndexConfig(context.Background(), models.IndexInfo{IndexName: "products", WriteAlias: "products-write"}, c, mode)
+			if tt.wantKind != ErrInternal {
+				if KindOf(err) != tt.wantKind {
+					t.Fatalf("err = %v, want kind %v", err, tt.wantKind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.IndexName, tt.want.Mode = "products", models.ImportPlan
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("plan = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"elastic-search-config-service/models"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// maxMultiGetIDs bounds a single multi-get request.
+const maxMultiGetIDs = 1000
+
+type documentWriteResponse struct {
+	ID          string `json:"_id"`
+	Result      string `json:"result"`
+	SeqNo       int    `json:"_seq_no"`
+	PrimaryTerm int    `json:"_primary_term"`
+}
+
+func (r documentWriteResponse) toResult() models.DocumentWriteResult {
+	return models.DocumentWriteResult{
+		ID:      r.ID,
+		Result:  r.Result,
+		Version: models.DocumentVersion{SeqNo: r.SeqNo, PrimaryTerm: r.PrimaryTerm},
+	}
+}
+
+// GetDocument reads a single document through the read alias, returning
+// only the fields access and the displayed attributes of the index permit.
+func (es *ElasticsearchClient) GetDocument(ctx context.Context, ind models.IndexInfo, id string, access models.FieldAccess) (models.StoredDocument, error) {
+	perms, err := es.documentPermissions(ctx, ind, access)
+	if err != nil {
+		return models.StoredDocument{}, err
+	}
+	req := esapi.GetRequest{
+		Index:      ind.ReadAlias,
+		DocumentID: id,
+	}
+	req.Source, req.SourceIncludes, req.SourceExcludes = perms.sourceParams()
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		return models.StoredDocument{}, transportError("error getting document", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return models.StoredDocument{}, documentError("error getting document", id, res)
+	}
+
+	var getResponse struct {
+		ID          string          `json:"_id"`
+		SeqNo       int             `json:"_seq_no"`
+		PrimaryTerm int             `json:"_primary_term"`
+		Source      models.Document `json:"_source"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&getResponse); err != nil {
+		return models.StoredDocument{}, err
+	}
+	return models.StoredDocument{
+		ID:      getResponse.ID,
+		Content: getResponse.Source.Content,
+		Version: models.DocumentVersion{SeqNo: getResponse.SeqNo, PrimaryTerm: getResponse.PrimaryTerm},
+	}, nil
+}
+
+// PutDocument creates or replaces a document through the write alias.
+func (es *ElasticsearchClient) PutDocument(ctx context.Context, ind models.IndexInfo, id string, content interface{}, cond models.WriteCondition) (models.DocumentWriteResult, error) {
+	done, err := es.migrations.beginWrite(ctx, ind.IndexName, id)
+	if err != nil {
+		return models.DocumentWriteResult{}, err
+	}
+	defer done()
+
+	body, err := json.Marshal(models.Document{ID: id, Content: content})
+	if err != nil {
+		return models.DocumentWriteResult{}, err
+	}
+	req := esapi.IndexRequest{
+		Index:      ind.WriteAlias,
+		DocumentID: id,
+		Body:       bytes.NewReader(body),
+		Refresh:    "true",
+	}
+	if cond.IfMatch != nil {
+		req.IfSeqNo = &cond.IfMatch.SeqNo
+		req.IfPrimaryTerm = &cond.IfMatch.PrimaryTerm
+	}
+	if cond.IfNoneMatch {
+		req.OpType = "create"
+	}
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		return models.DocumentWriteResult{}, transportError("error indexing document", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return models.DocumentWriteResult{}, documentError("error indexing document", id, res)
+	}
+
+	var writeResponse documentWriteResponse
+	if err := json.NewDecoder(res.Body).Decode(&writeResponse); err != nil {
+		return models.DocumentWriteResult{}, err
+	}
+	return writeResponse.toResult(), nil
+}
+
+// UpdateDocument merges partial into the content of an existing document.
+// With upsert set, a missing document is created from partial instead.
+func (es *ElasticsearchClient) UpdateDocument(ctx context.Context, ind models.IndexInfo, id string, partial interface{}, upsert bool, cond models.WriteCondition) (models.DocumentWriteResult, error) {
+	done, err := es.migrations.beginWrite(ctx, ind.IndexName, id)
+	if err != nil {
+		return models.DocumentWriteResult{}, err
+	}
+	defer done()
+
+	update := map[string]interface{}{
+		"doc": map[string]interface{}{"content": partial},
+	}
+	if upsert {
+		update["upsert"] = models.Document{ID: id, Content: partial}
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(update); err != nil {
+		return models.DocumentWriteResult{}, err
+	}
+	req := esapi.UpdateRequest{
+		Index:      ind.WriteAlias,
+		DocumentID: id,
+		Body:       &buf,
+		Refresh:    "true",
+	}
+	if cond.IfMatch != nil {
+		req.IfSeqNo = &cond.IfMatch.SeqNo
+		req.IfPrimaryTerm = &cond.IfMatch.PrimaryTerm
+	}
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		return models.DocumentWriteResult{}, transportError("error updating document", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return models.DocumentWriteResult{}, documentError("error updating document", id, res)
+	}
+
+	var writeResponse documentWriteResponse
+	if err := json.NewDecoder(res.Body).Decode(&writeResponse); err != nil {
+		return models.DocumentWriteResult{}, err
+	}
+	return writeResponse.toResult(), nil
+}
+
+// DeleteDocument removes a document through the write alias.
+func (es *ElasticsearchClient) DeleteDocument(ctx context.Context, ind models.IndexInfo, id string, cond models.WriteCondition) (models.DocumentWriteResult, error) {
+	done, err := es.migrations.beginWrite(ctx, ind.IndexName, id)
+	if err != nil {
+		return models.DocumentWriteResult{}, err
+	}
+	defer done()
+
+	req := esapi.DeleteRequest{
+		Index:      ind.WriteAlias,
+		DocumentID: id,
+		Refresh:    "true",
+	}
+	if cond.IfMatch != nil {
+		req.IfSeqNo = &cond.IfMatch.SeqNo
+		req.IfPrimaryTerm = &cond.IfMatch.PrimaryTerm
+	}
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		return models.DocumentWriteResult{}, transportError("error deleting document", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return models.DocumentWriteResult{}, documentError("error deleting document", id, res)
+	}
+
+	var writeResponse documentWriteResponse
+	if err := json.NewDecoder(res.Body).Decode(&writeResponse); err != nil {
+		return models.DocumentWriteResult{}, err
+	}
+	return writeResponse.toResult(), nil
+}
+
+// MultiGetDocuments reads several documents at once through the read alias,
+// restricted to the fields GetDocument would return.
+func (es *ElasticsearchClient) MultiGetDocuments(ctx context.Context, ind models.IndexInfo, ids []string, access models.FieldAccess) (models.MultiGetResponse, error) {
+	if len(ids) == 0 {
+		return models.MultiGetResponse{}, invalidRequestError("ids must not be empty")
+	}
+	if len(ids) > maxMultiGetIDs {
+		return models.MultiGetResponse{}, invalidRequestError("too many ids in a single request")
+	}
+
+	perms, err := es.documentPermissions(ctx, ind, access)
+	if err != nil {
+		return models.MultiGetResponse{}, err
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{"ids": ids}); err != nil {
+		return models.MultiGetResponse{}, err
+	}
+	req := esapi.MgetRequest{
+		Index: ind.ReadAlias,
+		Body:  &buf,
+	}
+	req.Source, req.SourceIncludes, req.SourceExcludes = perms.sourceParams()
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		return models.MultiGetResponse{}, transportError("error getting documents", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return models.MultiGetResponse{}, responseError("error getting documents", res)
+	}
+
+	var mgetResponse struct {
+		Docs []struct {
+			ID          string          `json:"_id"`
+			Found       bool            `json:"found"`
+			SeqNo       int             `json:"_seq_no"`
+			PrimaryTerm int             `json:"_primary_term"`
+			Source      models.Document `json:"_source"`
+		} `json:"docs"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&mgetResponse); err != nil {
+		return models.MultiGetResponse{}, err
+	}
+
+	response := models.MultiGetResponse{
+		Documents: make([]models.StoredDocument, 0, len(mgetResponse.Docs)),
+		Missing:   []string{},
+	}
+	for _, doc := range mgetResponse.Docs {
+		if !doc.Found {
+			response.Missing = append(response.Missing, doc.ID)
+			continue
+		}
+		response.Documents = append(response.Documents, models.StoredDocument{
+			ID:      doc.ID,
+			Content: doc.Source.Content,
+			Version: models.DocumentVersion{SeqNo: doc.SeqNo, PrimaryTerm: doc.PrimaryTerm},
+		})
+	}
+	return response, nil
+}
+
+// DeleteDocumentsByQuery deletes every document matching filter. An empty
+// filter is rejected rather than wiping the index. It is refused while a
+// migration runs, since the affected IDs cannot be journaled.
+func (es *ElasticsearchClient) DeleteDocumentsByQuery(ctx context.Context, ind models.IndexInfo, filter models.Filter) (models.DeleteByQueryResponse, error) {
+	if len(filter) == 0 {
+		return models.DeleteByQueryResponse{}, invalidRequestError("filter must not be empty")
+	}
+
+	done, err := es.migrations.beginQueryWrite(ctx, ind.IndexName)
+	if err != nil {
+		return models.DeleteByQueryResponse{}, err
+	}
+	defer done()
+
+	query, err := es.filterQuery(ctx, ind, filter)
+	if err != nil {
+		return models.DeleteByQueryResponse{}, err
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{"query": query}); err != nil {
+		return models.DeleteByQueryResponse{}, err
+	}
+	refresh := true
+	req := esapi.DeleteByQueryRequest{
+		Index:     []string{ind.WriteAlias},
+		Body:      &buf,
+		Conflicts: "proceed",
+		Refresh:   &refresh,
+	}
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		return models.DeleteByQueryResponse{}, transportError("error deleting documents by query", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return models.DeleteByQueryResponse{}, responseError("error deleting documents by query", res)
+	}
+
+	var deleteResponse struct {
+		Deleted          int64 `json:"deleted"`
+		VersionConflicts int64 `json:"version_conflicts"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&deleteResponse); err != nil {
+		return models.DeleteByQueryResponse{}, err
+	}
+	return models.DeleteByQueryResponse{
+		Deleted:          deleteResponse.Deleted,
+		VersionConflicts: deleteResponse.VersionConflicts,
+	}, nil
+}
+
+// filterQuery turns the service's filter model into a query matching every
+// document the filter selects.
+func (es *ElasticsearchClient) filterQuery(ctx context.Context, ind models.IndexInfo, filter models.Filter) (map[string]interface{}, error) {
+	qb, err := es.GetMappingBuilder(ctx, ind)
+	if err != nil {
+		return nil, err
+	}
+	esFilter, err := generateElasticsearchFilter(&qb, filter)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{"filter": esFilter},
+	}, nil
+}
+
+// documentError classifies an error response for a single document request,
+// telling a missing document apart from a missing index.
+func documentError(op, id string, res *esapi.Response) error {
+	err := responseError(op, res)
+	var svcErr *Error
+	if errors.As(err, &svcErr) && res.StatusCode == http.StatusNotFound &&
+		svcErr.Upstream.Type != "index_not_found_exception" {
+		return &Error{Kind: ErrDocumentNotFound, Message: "document " + id + " not found"}
+	}
+	return err
+}
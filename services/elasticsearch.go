@@ -6,25 +6,48 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"elastic-search-config-service/metrics"
 	"elastic-search-config-service/models"
+	"elastic-search-config-service/store"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
 )
 
 type ElasticsearchClient struct {
-	client *elasticsearch.Client
+	client     *elasticsearch.Client
+	transport  *resilientTransport
+	mappings   *MappingRegistry
+	store      store.ConfigStore
+	bootstrap  bootstrapState
+	migrations *migrationTracker
+	scripts    *scriptManager
+	apiKeys    *apiKeyring
+	settings   *settingsCache
+	quotas     quotaState
+	queryLog   map[string]struct{}
+	auditLog   store.AuditLog
+	// tenantSecret signs tenant tokens; empty disables them.
+	tenantSecret []byte
+	// shuttingDown fails readiness once the server starts draining.
+	shuttingDown atomic.Bool
 }
 
-// TODO: have proper versioning name support instead of just _new suffix
-func NewElasticsearchClient(url string) (*ElasticsearchClient, error) {
+func NewElasticsearchClient(url string, resilience ResilienceConfig) (*ElasticsearchClient, error) {
 	cfg := elasticsearch.Config{
 		Addresses: []string{url},
-		Password:  "2Il=zpAuWSseDPLb+d7+",
-		Username:  "elastic",
+		// Retries are handled by the resilience layer, which knows which
+		// requests are safe to repeat.
+		DisableRetry: true,
+		Password:     "2Il=zpAuWSseDPLb+d7+",
+		Username:     "elastic",
 		Transport: &http.Transport{
 			TLSClientConfig: &tls.Config{
 				InsecureSkipVerify: true,
@@ -36,24 +59,88 @@ func NewElasticsearchClient(url string) (*ElasticsearchClient, error) {
 		return nil, err
 	}
 	res, err := client.Ping()
-	fmt.Println("ping res", res)
-	fmt.Println("ping err", err)
-	return &ElasticsearchClient{client: client}, nil
+	if err != nil {
+		slog.Warn("elasticsearch is not reachable", "url", url, "error", err)
+	} else {
+		res.Body.Close()
+		slog.Info("connected to elasticsearch", "url", url, "status", res.StatusCode)
+	}
+	es := &ElasticsearchClient{
+		client:     client,
+		transport:  newResilientTransport(client, resilience),
+		mappings:   NewMappingRegistry(DefaultMappingTTL),
+		migrations: newMigrationTracker(),
+		scripts:    newScriptManager(),
+		apiKeys:    newAPIKeyring(),
+		settings:   newSettingsCache(),
+	}
+	es.bootstrap.report.State = BootstrapPending
+	return es, nil
+}
+
+// Mappings returns the registry caching field mappings per logical index.
+func (es *ElasticsearchClient) Mappings() *MappingRegistry {
+	return es.mappings
+}
+
+// Transport exposes the underlying transport for components, such as the
+// Elasticsearch config store, that issue their own requests.
+func (es *ElasticsearchClient) Transport() esapi.Transport {
+	return es.transport
+}
+
+// SetConfigStore sets where index configuration and mapping metadata are
+// persisted. It must be called before the client serves requests.
+func (es *ElasticsearchClient) SetConfigStore(s store.ConfigStore) {
+	es.store = s
+	es.migrations.store = s
 }
 
-func (es *ElasticsearchClient) CreateIndexAndAliases(index models.IndexInfo) error {
+// SetQueryLogging logs the Elasticsearch queries generated for the given
+// logical indices, and only those. Values of redacted fields are masked by
+// the logger.
+func (es *ElasticsearchClient) SetQueryLogging(indices []string) {
+	es.queryLog = make(map[string]struct{}, len(indices))
+	for _, index := range indices {
+		es.queryLog[index] = struct{}{}
+	}
+}
+
+func (es *ElasticsearchClient) logQuery(ctx context.Context, index, op string, query interface{}) {
+	if _, ok := es.queryLog[index]; !ok {
+		return
+	}
+	slog.InfoContext(ctx, "elasticsearch query", "index", index, "op", op, "query", query)
+}
+
+// CreateIndexAndAliases creates the index with its read and write aliases.
+// A nil schema leaves field types to Elasticsearch's dynamic mapping.
+func (es *ElasticsearchClient) CreateIndexAndAliases(ctx context.Context, index models.IndexInfo, schema *models.IndexSchema) error {
+	defer es.mappings.Invalidate(index.IndexName)
+
 	req := esapi.IndicesCreateRequest{
 		Index: index.IndexName,
 	}
-	res, err := req.Do(context.Background(), es.client)
+	if schema != nil {
+		body, err := buildIndexBody(schema)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+		req.Body = &buf
+	}
+	res, err := req.Do(ctx, es.transport)
 	if err != nil {
-		return err
+		return transportError("error creating index", err)
 	}
 	defer res.Body.Close()
 	if res.IsError() {
-		return fmt.Errorf("error creating index: %s", res.String())
+		return responseError("error creating index", res)
 	}
-	fmt.Println(res)
+	slog.InfoContext(ctx, "index created", "index", index.IndexName)
 
 	// TODO: make this api idempotent see case when index created but alias not created
 	aliasBody := fmt.Sprintf(`{
@@ -66,80 +153,87 @@ func (es *ElasticsearchClient) CreateIndexAndAliases(index models.IndexInfo) err
 	aliasReq := esapi.IndicesUpdateAliasesRequest{
 		Body: strings.NewReader(aliasBody),
 	}
-	aliasRes, err := aliasReq.Do(context.Background(), es.client)
+	aliasRes, err := aliasReq.Do(ctx, es.transport)
 	if err != nil {
-		return err
+		return transportError("error creating aliases", err)
 	}
 	defer aliasRes.Body.Close()
 	if aliasRes.IsError() {
-		return fmt.Errorf("error creating aliases: %s", aliasRes.String())
+		return responseError("error creating aliases", aliasRes)
+	}
+	slog.InfoContext(ctx, "aliases created", "index", index.IndexName, "read_alias", index.ReadAlias, "write_alias", index.WriteAlias)
+
+	// Remember the schema flags so that later mapping changes start from them
+	if schema != nil {
+		searchable, facet := schemaAttributes(schema)
+		if len(searchable) > 0 || len(facet) > 0 {
+			_, err := es.saveIndexSettings(ctx, index.IndexName, func(s *models.IndexSettings) {
+				s.SearchableAttributes = searchable
+				s.FacetAttributes = facet
+			})
+			return err
+		}
 	}
-	fmt.Println("Aliases created:", aliasRes)
 	return nil
 }
 
-func (es *ElasticsearchClient) UpdateIndexSettings(settings map[string]interface{}) error {
-	var buf bytes.Buffer
-	if err := json.NewEncoder(&buf).Encode(settings); err != nil {
-		return err
-	}
-	req := esapi.IndicesPutSettingsRequest{
-		Body: &buf,
+// IndexDocuments indexes documents one by one through the write alias.
+func (es *ElasticsearchClient) IndexDocuments(ctx context.Context, ind models.IndexInfo, documents []models.Document) error {
+	ids := make([]string, len(documents))
+	for i, doc := range documents {
+		ids[i] = doc.ID
 	}
-	res, err := req.Do(context.Background(), es.client)
+	done, err := es.migrations.beginWrite(ctx, ind.IndexName, ids...)
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
-	if res.IsError() {
-		return fmt.Errorf("error creating index: %s", res.String())
-	}
-	fmt.Println(res)
-	return err
-}
+	defer done()
+
+	written := make([]string, 0, len(documents))
 
-// TODO: retry on writes
-func (es *ElasticsearchClient) IndexDocuments(indexName string, documents []models.Document) error {
 	//TODO: remarks use bulk api here
 	for _, doc := range documents {
+		written = append(written, doc.ID)
 		body, err := json.Marshal(doc)
 		if err != nil {
 			return err
 		}
-		fmt.Println(body)
 		req := esapi.IndexRequest{
-			Index:      indexName,
+			Index:      ind.WriteAlias,
 			DocumentID: doc.ID,
 			Body:       bytes.NewReader(body),
 			Refresh:    "true",
 		}
-		res, err := req.Do(context.Background(), es.client)
+		res, err := req.Do(ctx, es.transport)
 		if err != nil {
-			return err
+			metrics.CountBulkDocuments("documents", len(written)-1, 1)
+			return transportError("error indexing document "+doc.ID, err)
 		}
 		defer res.Body.Close()
 		if res.IsError() {
-			return fmt.Errorf("error creating index: %s", res.String())
+			metrics.CountBulkDocuments("documents", len(written)-1, 1)
+			return responseError("error indexing document "+doc.ID, res)
 		}
-		fmt.Println(res)
+		slog.DebugContext(ctx, "document indexed", "index", ind.IndexName, "id", doc.ID)
 	}
+	metrics.CountBulkDocuments("documents", len(written), 0)
 	return nil
 }
 
 //tag:info https://stackoverflow.com/questions/41382627/do-you-need-to-delete-elasticsearch-aliases
-func (es *ElasticsearchClient) GetIndexAttributes(ind models.IndexInfo) ([]string, error) {
+func (es *ElasticsearchClient) GetIndexAttributes(ctx context.Context, ind models.IndexInfo) ([]string, error) {
 	req := esapi.IndicesGetMappingRequest{
 		Index: []string{ind.ReadAlias},
 	}
 
-	res, err := req.Do(context.Background(), es.client)
+	res, err := req.Do(ctx, es.transport)
 	if err != nil {
-		return nil, err
+		return nil, transportError("error getting index mapping", err)
 	}
 	defer res.Body.Close()
 
 	if res.IsError() {
-		return nil, fmt.Errorf("error getting index mapping: %s", res.String())
+		return nil, responseError("error getting index mapping", res)
 	}
 
 	var response map[string]interface{}
@@ -193,142 +287,468 @@ func extractProperties(properties map[string]interface{}, prefix string) []strin
 }
 
 // TODO: add support for custom analyzers
-func (es *ElasticsearchClient) ChangeMappings(indexInfo models.IndexInfo, settings models.IndexSettings) error {
-	// Step 1: Get the current index from the read alias
-	getAliasReq := esapi.IndicesGetAliasRequest{
-		Name: []string{indexInfo.ReadAlias},
-	}
-	getAliasRes, err := getAliasReq.Do(context.Background(), es.client)
-	if err != nil {
-		return err
+// ChangeMappings remaps the index so that the given attributes become
+// searchable or facetable, adding the new fields of change. Additive changes
+// are applied in place on the current index; anything else creates a new
+// index and reindexes into it.
+func (es *ElasticsearchClient) ChangeMappings(ctx context.Context, indexInfo models.IndexInfo, change models.MappingChange) (models.MappingChangeResult, error) {
+	settings := change.IndexSettings
+	if len(settings.SearchableAttributes) == 0 && len(settings.FacetAttributes) == 0 {
+		// A change that only adds fields keeps the attributes in effect.
+		current, err := es.GetIndexSettings(ctx, indexInfo)
+		if err != nil {
+			return models.MappingChangeResult{}, err
+		}
+		settings.SearchableAttributes = append(models.SearchableAttributes(nil), current.SearchableAttributes...)
+		settings.FacetAttributes = append(models.FacetsAttributes(nil), current.FacetAttributes...)
 	}
-	defer getAliasRes.Body.Close()
-	if getAliasRes.IsError() {
-		return fmt.Errorf("error getting alias: %s", getAliasRes.String())
+	for _, path := range sortedFieldPaths(change.Fields) {
+		field := change.Fields[path]
+		if field.Searchable && !containsString(settings.SearchableAttributes, path) {
+			settings.SearchableAttributes = append(settings.SearchableAttributes, path)
+		}
+		if field.Facet && !containsString(settings.FacetAttributes, path) {
+			settings.FacetAttributes = append(settings.FacetAttributes, path)
+		}
 	}
 
-	var aliasResponse map[string]interface{}
-	if err := json.NewDecoder(getAliasRes.Body).Decode(&aliasResponse); err != nil {
-		return err
+	result, err := es.remapIndex(ctx, indexInfo, settings, change.Fields)
+	if err != nil {
+		return result, err
 	}
 
-	var currentIndex string
-	for index := range aliasResponse {
-		currentIndex = index
-		break
+	// Step 10: Remember the attributes alongside the other index settings
+	_, err = es.saveIndexSettings(ctx, indexInfo.IndexName, func(s *models.IndexSettings) {
+		s.SearchableAttributes = settings.SearchableAttributes
+		s.FacetAttributes = settings.FacetAttributes
+	})
+	return result, err
+}
+
+// remapIndex brings the mapping of the index in line with the searchable
+// and facet attributes of settings and adds fields to it, without storing
+// the settings.
+func (es *ElasticsearchClient) remapIndex(ctx context.Context, indexInfo models.IndexInfo, settings models.IndexSettings, fields map[string]models.FieldSchema) (models.MappingChangeResult, error) {
+	defer es.mappings.Invalidate(indexInfo.IndexName)
+
+	// Step 1: Get the current index from the read alias
+	indices, err := es.aliasIndices(ctx, indexInfo.ReadAlias)
+	if err != nil {
+		return models.MappingChangeResult{}, err
 	}
+	currentIndex := indices[0]
 
 	// Step 2: Get the current mappings for the index
 	getMappingReq := esapi.IndicesGetMappingRequest{
 		Index: []string{currentIndex},
 	}
-	getMappingRes, err := getMappingReq.Do(context.Background(), es.client)
+	getMappingRes, err := getMappingReq.Do(ctx, es.transport)
 	if err != nil {
-		return err
+		return models.MappingChangeResult{}, transportError("error getting index mappings", err)
 	}
 	defer getMappingRes.Body.Close()
 	if getMappingRes.IsError() {
-		return fmt.Errorf("error getting index mappings: %s", getMappingRes.String())
+		return models.MappingChangeResult{}, responseError("error getting index mappings", getMappingRes)
 	}
 
 	var mappingResponse map[string]interface{}
 	if err := json.NewDecoder(getMappingRes.Body).Decode(&mappingResponse); err != nil {
-		return err
+		return models.MappingChangeResult{}, err
 	}
 
-	fmt.Println(marshalToJSONString(mappingResponse))
+	slog.DebugContext(ctx, "current mapping", "index", currentIndex, "mapping", mappingResponse)
 
-	properties, _ := createDynamicMapping(currentIndex, mappingResponse, settings)
+	if err := validateNewFields(currentIndex, mappingResponse, fields); err != nil {
+		return models.MappingChangeResult{}, err
+	}
+	if err := validateSettingsFields(currentIndex, mappingResponse, settings, fields); err != nil {
+		return models.MappingChangeResult{}, err
+	}
 
 	newMappings := map[string]interface{}{
-		"properties": properties["properties"].(map[string]interface{}),
+		"properties": remappedProperties(currentIndex, mappingResponse, settings, fields),
+	}
+
+	// Step 3: Decide whether the change can be applied to the current index
+	var desiredProperties map[string]interface{}
+	if err := json.Unmarshal([]byte(marshalToJSONString(newMappings["properties"])), &desiredProperties); err != nil {
+		return models.MappingChangeResult{}, err
+	}
+	currentMappings := mappingResponse[currentIndex].(map[string]interface{})["mappings"].(map[string]interface{})
+	currentProperties := currentMappings["properties"].(map[string]interface{})
+	diff := diffProperties("", currentProperties, desiredProperties)
+
+	result := models.MappingChangeResult{
+		SourceIndex:     currentIndex,
+		TargetIndex:     currentIndex,
+		Changes:         diff.Additions,
+		BreakingChanges: diff.Breaking,
+	}
+	switch {
+	case diff.empty():
+		result.Strategy = models.MigrationUnchanged
+	case diff.additive():
+		result.Strategy = models.MigrationInPlace
+		result.UpdatedDocuments, err = es.applyMappingInPlace(ctx, indexInfo, currentIndex, newMappings)
+	default:
+		result.Strategy = models.MigrationReindex
+		// The new generation keeps dynamic and the other root parameters
+		reindexMappings := make(map[string]interface{}, len(currentMappings))
+		for param, value := range currentMappings {
+			reindexMappings[param] = value
+		}
+		reindexMappings["properties"] = newMappings["properties"]
+		result.TargetIndex, result.ReplayedDocuments, err = es.reindexWithMappings(ctx, indexInfo, currentIndex, reindexMappings)
+	}
+	return result, err
+}
+
+// applyMappingInPlace adds new fields to the mapping of index and runs an
+// update by query so that existing documents get indexed into them. It holds
+// the migration lease of the logical index meanwhile, so that no reindex and
+// no other write by query runs at the same time.
+func (es *ElasticsearchClient) applyMappingInPlace(ctx context.Context, indexInfo models.IndexInfo, index string, newMappings map[string]interface{}) (int64, error) {
+	abandoned, err := es.migrations.start(ctx, indexInfo.IndexName, index, index)
+	if err != nil {
+		return 0, err
+	}
+	defer es.migrations.stop(context.WithoutCancel(ctx), indexInfo.IndexName)
+	if abandoned != "" {
+		es.dropUnusedGeneration(ctx, abandoned)
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(newMappings); err != nil {
+		return 0, err
+	}
+	putMappingReq := esapi.IndicesPutMappingRequest{
+		Index: []string{index},
+		Body:  &buf,
+	}
+	putMappingRes, err := putMappingReq.Do(ctx, es.transport)
+	if err != nil {
+		return 0, transportError("error updating index mapping", err)
+	}
+	defer putMappingRes.Body.Close()
+	if putMappingRes.IsError() {
+		return 0, responseError("error updating index mapping", putMappingRes)
+	}
+
+	waitForCompletion := true
+	refresh := true
+	updateReq := esapi.UpdateByQueryRequest{
+		Index:             []string{index},
+		Conflicts:         "proceed",
+		Refresh:           &refresh,
+		WaitForCompletion: &waitForCompletion,
+	}
+	updateRes, err := updateReq.Do(ctx, es.transport)
+	if err != nil {
+		return 0, transportError("error updating existing documents", err)
+	}
+	defer updateRes.Body.Close()
+	if updateRes.IsError() {
+		return 0, responseError("error updating existing documents", updateRes)
+	}
+
+	var updateResponse struct {
+		Updated int64 `json:"updated"`
+	}
+	if err := json.NewDecoder(updateRes.Body).Decode(&updateResponse); err != nil {
+		return 0, err
+	}
+	return updateResponse.Updated, nil
+}
+
+// reindexWithMappings creates a new generation of the index with
+// newMappings, copies every document of currentIndex into it, replays writes
+// made in the meantime and then moves both aliases over in a single step. It
+// returns the name of the new index and how many journaled documents were
+// replayed. When anything fails the new index is deleted again.
+func (es *ElasticsearchClient) reindexWithMappings(ctx context.Context, indexInfo models.IndexInfo, currentIndex string, newMappings map[string]interface{}) (_ string, replayed int64, err error) {
+	newIndexName, err := es.nextGeneration(ctx, indexInfo)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Step 4: Journal writes on every replica while the write alias stays on
+	// the current index, from before the new index exists
+	abandoned, err := es.migrations.start(ctx, indexInfo.IndexName, currentIndex, newIndexName)
+	if err != nil {
+		return "", 0, err
 	}
+	defer es.migrations.stop(context.WithoutCancel(ctx), indexInfo.IndexName)
+	if abandoned != "" {
+		es.dropUnusedGeneration(ctx, abandoned)
+	}
+	created := false
+	defer func() {
+		if err != nil && created {
+			es.dropUnusedGeneration(context.WithoutCancel(ctx), newIndexName)
+		}
+	}()
 
-	// Step 4: Create a new index with the updated mappings
-	fmt.Println(marshalToJSONString(newMappings))
-	newIndexName := indexInfo.IndexName + "_new"
+	// Step 5: Create the new index with the updated mappings and the
+	// settings of the current one
+	settings, err := es.generationSettings(ctx, currentIndex)
+	if err != nil {
+		return "", 0, err
+	}
+	slog.DebugContext(ctx, "reindexing with new mapping", "index", indexInfo.IndexName, "target", newIndexName, "mapping", newMappings)
 	var buf bytes.Buffer
 	query := map[string]interface{}{
+		"settings": settings,
 		"mappings": newMappings,
 	}
 	if err := json.NewEncoder(&buf).Encode(query); err != nil {
-		return err
+		return "", 0, err
 	}
 	createIndexReq := esapi.IndicesCreateRequest{
 		Index: newIndexName,
 		Body:  &buf,
 	}
-	createIndexRes, err := createIndexReq.Do(context.Background(), es.client)
+	createIndexRes, err := createIndexReq.Do(ctx, es.transport)
 	if err != nil {
-		return err
+		return "", 0, transportError("error creating new index", err)
 	}
 	defer createIndexRes.Body.Close()
 	if createIndexRes.IsError() {
-		return fmt.Errorf("error creating new index: %s", createIndexRes.String())
+		return "", 0, responseError("error creating new index", createIndexRes)
 	}
+	created = true
 
-	// TODO: explore if what would happen if we point read alias to two indices
-	// Step 5: Point write alias to new index
-	updateAliasReq := esapi.IndicesUpdateAliasesRequest{
-		Body: strings.NewReader(fmt.Sprintf(`{
-			"actions": [
-				{"remove": {"index": "%s", "alias": "%s"}},
-				{"add": {"index": "%s", "alias": "%s"}}
-			]
-		}`, currentIndex, indexInfo.WriteAlias, newIndexName, indexInfo.WriteAlias)),
-	}
-	updateAliasRes, err := updateAliasReq.Do(context.Background(), es.client)
-	if err != nil {
-		return err
-	}
-	defer updateAliasRes.Body.Close()
-	if updateAliasRes.IsError() {
-		return fmt.Errorf("error updating aliases: %s", updateAliasRes.String())
-	}
-
-	// Step 6: Reindex documents to the new index
+	// Step 6: Reindex documents to the new index, keeping source versions so
+	// that replayed writes always win over the reindexed copy
 	waitForCompletion := true
 	reindexReq := esapi.ReindexRequest{
 		Body: strings.NewReader(fmt.Sprintf(`{
+			"conflicts": "proceed",
 			"source": {"index": "%s"},
-			"dest": {"index": "%s"}
+			"dest": {"index": "%s", "version_type": "external"}
 		}`, currentIndex, newIndexName)),
 		WaitForCompletion: &waitForCompletion,
 	}
-	reindexRes, err := reindexReq.Do(context.Background(), es.client)
+	reindexRes, err := reindexReq.Do(ctx, es.transport)
 	if err != nil {
-		return err
+		return "", 0, transportError("error during reindexing", err)
 	}
 	defer reindexRes.Body.Close()
 	if reindexRes.IsError() {
-		return fmt.Errorf("error during reindexing: %s", reindexRes.String())
+		return "", 0, responseError("error during reindexing", reindexRes)
+	}
+
+	// Step 7: Replay journaled writes while new writes keep flowing
+	for round := 0; round < catchUpRounds; round++ {
+		ids, err := es.migrations.drain(ctx, indexInfo.IndexName)
+		if err != nil {
+			return "", replayed, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		n, err := es.replayDocuments(ctx, currentIndex, newIndexName, ids)
+		replayed += n
+		if err != nil {
+			return "", replayed, err
+		}
 	}
 
-	// Step 7: Update read alias to point to the new index
-	finalUpdateAliasReq := esapi.IndicesUpdateAliasesRequest{
+	// Step 8: Block writes on every replica, replay what is left and flip
+	// both aliases at once. Writes through this process wait at the gate,
+	// writes through other replicas fail until the aliases have moved.
+	gate := es.migrations.gate(indexInfo.IndexName)
+	gate.Lock()
+	defer gate.Unlock()
+	if err := es.blockWrites(ctx, currentIndex); err != nil {
+		return "", replayed, err
+	}
+	defer func() {
+		if err != nil {
+			es.unblockWrites(context.WithoutCancel(ctx), currentIndex)
+		}
+	}()
+	select {
+	case <-time.After(cutoverSettle):
+	case <-ctx.Done():
+		return "", replayed, ctx.Err()
+	}
+	if err := es.migrations.verify(ctx, indexInfo.IndexName); err != nil {
+		return "", replayed, err
+	}
+
+	ids, err := es.migrations.drain(ctx, indexInfo.IndexName)
+	if err != nil {
+		return "", replayed, err
+	}
+	n, err := es.replayDocuments(ctx, currentIndex, newIndexName, ids)
+	replayed += n
+	if err != nil {
+		return "", replayed, err
+	}
+
+	// TODO: explore if what would happen if we point read alias to two indices
+	updateAliasReq := esapi.IndicesUpdateAliasesRequest{
 		Body: strings.NewReader(fmt.Sprintf(`{
 			"actions": [
 				{"remove": {"index": "%s", "alias": "%s"}},
+				{"remove": {"index": "%s", "alias": "%s"}},
+				{"add": {"index": "%s", "alias": "%s"}},
 				{"add": {"index": "%s", "alias": "%s"}}
 			]
-		}`, currentIndex, indexInfo.ReadAlias, newIndexName, indexInfo.ReadAlias)),
+		}`, currentIndex, indexInfo.WriteAlias, currentIndex, indexInfo.ReadAlias,
+			newIndexName, indexInfo.WriteAlias, newIndexName, indexInfo.ReadAlias)),
 	}
-	finalUpdateAliasRes, err := finalUpdateAliasReq.Do(context.Background(), es.client)
+	updateAliasRes, err := updateAliasReq.Do(ctx, es.transport)
 	if err != nil {
-		return err
+		return "", replayed, transportError("error updating aliases", err)
 	}
-	defer finalUpdateAliasRes.Body.Close()
-	if finalUpdateAliasRes.IsError() {
-		return fmt.Errorf("error updating read alias: %s", finalUpdateAliasRes.String())
+	defer updateAliasRes.Body.Close()
+	if updateAliasRes.IsError() {
+		return "", replayed, responseError("error updating aliases", updateAliasRes)
 	}
 
-	// Step 8: Log the new mappings
-	fmt.Printf("New mappings for index %s: %v\n", newIndexName, properties)
+	// Step 9: Log the switch
+	slog.InfoContext(ctx, "aliases moved to reindexed index", "index", indexInfo.IndexName, "from", currentIndex, "to", newIndexName, "replayed", replayed)
+	es.clearInterruptedMigration(ctx, indexInfo.IndexName)
 
 	// TODO: setup pipelines for cleaning up old indexes
+	return newIndexName, replayed, nil
+}
+
+// validateSettingsFields makes sure every searchable and facet attribute
+// refers to a leaf field present in the current mapping or among the new
+// fields.
+func validateSettingsFields(index string, existingMapping map[string]interface{}, settings models.IndexSettings, fields map[string]models.FieldSchema) error {
+	known := make(map[string]struct{})
+	for _, attr := range flattenMappings(map[string]interface{}{index: existingMapping[index]}) {
+		known[attr] = struct{}{}
+	}
+	for path, field := range fields {
+		if field.Type != "object" && field.Type != "nested" {
+			known[path] = struct{}{}
+		}
+	}
+
+	var invalid []FieldError
+	check := func(fields []string, kind string) {
+		for _, field := range fields {
+			if _, ok := known[field]; !ok {
+				invalid = append(invalid, FieldError{Field: field, Reason: kind + " attribute does not exist in index mapping"})
+			}
+		}
+	}
+	check(settings.SearchableAttributes, "searchable")
+	check(settings.FacetAttributes, "facet")
+
+	if len(invalid) > 0 {
+		return invalidFieldsError("invalid index settings", invalid)
+	}
 	return nil
 }
 
+// remappedProperties rebuilds the mapping properties of index for the
+// searchable and facet attributes of settings and adds fields to them. New
+// fields keep their type, analyzers and sortable flag; the attributes decide
+// whether they are searchable or facets.
+func remappedProperties(index string, existingMapping map[string]interface{}, settings models.IndexSettings, fields map[string]models.FieldSchema) map[string]interface{} {
+	mapping, _ := createDynamicMapping(index, existingMapping, settings)
+	properties := mapping["properties"].(map[string]interface{})
+	for _, path := range sortedFieldPaths(fields) {
+		field := fields[path]
+		field.Searchable = containsString(settings.SearchableAttributes, path)
+		field.Facet = containsString(settings.FacetAttributes, path)
+		insertField(properties, path, fieldSchemaMapping(field))
+	}
+	return properties
+}
+
+// validateNewFields checks fields the way a schema is checked and makes sure
+// none of them is mapped yet and each lies below an object or nested field.
+func validateNewFields(index string, existingMapping map[string]interface{}, fields map[string]models.FieldSchema) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	if err := validateSchema(&models.IndexSchema{Fields: fields}); err != nil {
+		return err
+	}
+
+	properties := existingMapping[index].(map[string]interface{})["mappings"].(map[string]interface{})["properties"].(map[string]interface{})
+	var invalid []FieldError
+	for _, path := range sortedFieldPaths(fields) {
+		segments := strings.Split(path, ".")
+		node := properties
+		for i, segment := range segments {
+			field, ok := node[segment].(map[string]interface{})
+			if !ok {
+				break
+			}
+			if i == len(segments)-1 {
+				invalid = append(invalid, FieldError{Field: path, Reason: "field already exists in index mapping"})
+				break
+			}
+			children, ok := field["properties"].(map[string]interface{})
+			if fieldType, _ := field["type"].(string); !ok && fieldType != "object" && fieldType != "nested" {
+				invalid = append(invalid, FieldError{Field: path, Reason: "parent " + strings.Join(segments[:i+1], ".") + " is not an object or nested field"})
+				break
+			}
+			node = children
+		}
+	}
+	if len(invalid) > 0 {
+		return invalidFieldsError("invalid new fields", invalid)
+	}
+	return nil
+}
+
+func containsString(list []string, item string) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedFieldPaths(fields map[string]models.FieldSchema) []string {
+	paths := make([]string, 0, len(fields))
+	for path := range fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// aliasIndices returns the physical indices an alias points to, sorted by
+// name. A missing or dangling alias is reported as ErrIndexNotFound.
+func (es *ElasticsearchClient) aliasIndices(ctx context.Context, alias string) ([]string, error) {
+	getAliasReq := esapi.IndicesGetAliasRequest{
+		Name: []string{alias},
+	}
+	getAliasRes, err := getAliasReq.Do(ctx, es.transport)
+	if err != nil {
+		return nil, transportError("error getting alias", err)
+	}
+	defer getAliasRes.Body.Close()
+	if getAliasRes.IsError() {
+		return nil, responseError("error getting alias", getAliasRes)
+	}
+
+	var aliasResponse map[string]interface{}
+	if err := json.NewDecoder(getAliasRes.Body).Decode(&aliasResponse); err != nil {
+		return nil, err
+	}
+
+	indices := make([]string, 0, len(aliasResponse))
+	for index := range aliasResponse {
+		indices = append(indices, index)
+	}
+	if len(indices) == 0 {
+		return nil, &Error{Kind: ErrIndexNotFound, Message: "no index behind alias " + alias}
+	}
+	sort.Strings(indices)
+	return indices, nil
+}
+
 func createDynamicMapping(index string, existingMapping map[string]interface{}, settings models.IndexSettings) (map[string]interface{}, error) {
 	newMapping := make(map[string]interface{})
 
@@ -353,38 +773,26 @@ func createDynamicMapping(index string, existingMapping map[string]interface{},
 		return false
 	}
 
-	// Helper function to create field mapping
-	createFieldMapping := func(fieldName string, fieldType string) map[string]interface{} {
-		mapping := map[string]interface{}{}
+	mappings := existingMapping[index].(map[string]interface{})["mappings"].(map[string]interface{})
+	declared := hasDeclaredSchema(mappings)
 
+	// Helper function to create field mapping. For an index created from a
+	// schema the flags decide how the field is indexed, exactly as for the
+	// schema, and its type stays; the types of any other index were guessed
+	// by Elasticsearch, so searchable fields become text and facets keyword.
+	// Every other parameter of the current mapping, such as analyzers, is
+	// carried over as long as the field keeps its type.
+	createFieldMapping := func(fieldName string, current map[string]interface{}) map[string]interface{} {
+		fieldType, _ := current["type"].(string)
 		isSearchable := contains(settings.SearchableAttributes, fieldName)
 		isFilterable := contains(settings.FacetAttributes, fieldName)
-
-		if isSearchable && isFilterable {
-			mapping["type"] = "text"
-			mapping["fields"] = map[string]interface{}{
-				"keyword": map[string]interface{}{
-					"type":         "keyword",
-					"ignore_above": 256,
-				},
-			}
-		} else if isSearchable {
-			mapping["type"] = "text"
-		} else if isFilterable { //TODO: see if we can use inherent data types, will be more suitable with range
-			mapping["type"] = "keyword"
+		var mapping map[string]interface{}
+		if declared {
+			mapping = fieldSchemaMapping(models.FieldSchema{Type: fieldType, Searchable: isSearchable, Facet: isFilterable})
 		} else {
-			//TODO: add support for range based queries ref: https://stackoverflow.com/questions/47542363/should-i-choose-datatype-of-keyword-or-long-integer-for-document-personid-in-e
-			// https://www.elastic.co/guide/en/elasticsearch/reference/current/tune-for-search-speed.html#map-ids-as-keyword
-			if fieldType == "text" {
-				mapping["type"] = fieldType
-				mapping["index"] = false
-			} else {
-				mapping["type"] = fieldType
-				mapping["index"] = false
-				mapping["doc_values"] = false
-			}
+			mapping = guessedFieldMapping(fieldType, isSearchable, isFilterable)
 		}
-
+		keepFieldParams(current, mapping)
 		return mapping
 	}
 
@@ -395,20 +803,24 @@ func createDynamicMapping(index string, existingMapping map[string]interface{},
 
 		for key, value := range fields {
 			fullPath := prefix + key
-			if subProperties, ok := value.(map[string]interface{})["properties"]; ok {
-				if hasSearchableOrFilterableChild(fullPath+".", subProperties.(map[string]interface{})) {
-					result[key] = map[string]interface{}{
-						"type":       "nested",
-						"properties": processFields(fullPath+".", subProperties.(map[string]interface{})),
-					}
-				} else {
-					result[key] = map[string]interface{}{
-						"properties": processFields(fullPath+".", subProperties.(map[string]interface{})),
+			current := value.(map[string]interface{})
+			if subProperties, ok := current["properties"]; ok {
+				container := map[string]interface{}{
+					"properties": processFields(fullPath+".", subProperties.(map[string]interface{})),
+				}
+				for param, v := range current {
+					if param != "properties" {
+						container[param] = v
 					}
 				}
+				// Objects mapped dynamically become nested once a child is
+				// searchable; a declared object or nested type is kept
+				if _, declared := current["type"]; !declared && hasSearchableOrFilterableChild(fullPath+".", subProperties.(map[string]interface{})) {
+					container["type"] = "nested"
+				}
+				result[key] = container
 			} else {
-				fieldType := value.(map[string]interface{})["type"].(string)
-				result[key] = createFieldMapping(fullPath, fieldType)
+				result[key] = createFieldMapping(fullPath, current)
 			}
 		}
 
@@ -416,13 +828,86 @@ func createDynamicMapping(index string, existingMapping map[string]interface{},
 	}
 
 	// Process the root level fields
-	rootFields := existingMapping[index].(map[string]interface{})["mappings"].(map[string]interface{})["properties"].(map[string]interface{})
+	rootFields := mappings["properties"].(map[string]interface{})
 	properties := processFields("", rootFields)
 
 	newMapping["properties"] = properties
 	return newMapping, nil
 }
 
+// guessedFieldMapping returns the mapping of a field of an index created
+// without a schema, whose type Elasticsearch guessed from the first document.
+func guessedFieldMapping(fieldType string, isSearchable, isFilterable bool) map[string]interface{} {
+	mapping := map[string]interface{}{}
+
+	if isSearchable && isFilterable {
+		mapping["type"] = "text"
+		mapping["fields"] = map[string]interface{}{
+			"keyword": map[string]interface{}{
+				"type":         "keyword",
+				"ignore_above": 256,
+			},
+		}
+	} else if isSearchable {
+		mapping["type"] = "text"
+	} else if isFilterable { //TODO: see if we can use inherent data types, will be more suitable with range
+		mapping["type"] = "keyword"
+	} else {
+		//TODO: add support for range based queries ref: https://stackoverflow.com/questions/47542363/should-i-choose-datatype-of-keyword-or-long-integer-for-document-personid-in-e
+		// https://www.elastic.co/guide/en/elasticsearch/reference/current/tune-for-search-speed.html#map-ids-as-keyword
+		if fieldType == "text" {
+			mapping["type"] = fieldType
+			mapping["index"] = false
+		} else {
+			mapping["type"] = fieldType
+			mapping["index"] = false
+			mapping["doc_values"] = false
+		}
+	}
+
+	return mapping
+}
+
+// Parameters fieldSchemaMapping decides on; every other one is carried over.
+var indexingParams = map[string]struct{}{
+	"type":       {},
+	"index":      {},
+	"doc_values": {},
+	"fields":     {},
+}
+
+// keepFieldParams copies the parameters of the current mapping of a field
+// that are not about how it is indexed into its rebuilt mapping. When the
+// type changes only type independent parameters survive. Multi-fields other
+// than the keyword one the flags control are kept as well.
+func keepFieldParams(current, mapping map[string]interface{}) {
+	sameType := current["type"] == mapping["type"]
+	for param, value := range current {
+		if _, ok := indexingParams[param]; ok {
+			continue
+		}
+		if sameType || param == "copy_to" || param == "meta" {
+			mapping[param] = value
+		}
+	}
+	currentFields, _ := current["fields"].(map[string]interface{})
+	if !sameType || len(currentFields) == 0 {
+		return
+	}
+	fields, _ := mapping["fields"].(map[string]interface{})
+	if fields == nil {
+		fields = make(map[string]interface{})
+	}
+	for name, sub := range currentFields {
+		if _, managed := fields[name]; !managed && name != "keyword" {
+			fields[name] = sub
+		}
+	}
+	if len(fields) > 0 {
+		mapping["fields"] = fields
+	}
+}
+
 // Helper function to marshal properties to JSON string
 func marshalToJSONString(data interface{}) string {
 	bytes, err := json.Marshal(data)
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// ErrorKind classifies failures returned by the services layer so handlers
+// can translate them into the right response without inspecting strings.
+type ErrorKind int
+
+const (
+	// ErrInternal is anything we could not classify more precisely.
+	ErrInternal ErrorKind = iota
+	// ErrIndexNotFound means the logical index (or its aliases) does not exist.
+	ErrIndexNotFound
+	// ErrIndexExists means an index or alias we tried to create already exists.
+	ErrIndexExists
+	// ErrDocumentNotFound means the requested document does not exist.
+	ErrDocumentNotFound
+	// ErrAPIKeyNotFound means no API key exists with the given ID.
+	ErrAPIKeyNotFound
+	// ErrSettingsVersionNotFound means the logical index has no settings
+	// version with the given number.
+	ErrSettingsVersionNotFound
+	// ErrVersionConflict means a conditional write did not match the current
+	// version of the document.
+	ErrVersionConflict
+	// ErrConflict means the operation clashes with work already in progress.
+	ErrConflict
+	// ErrInvalidRequest means the request failed validation before reaching
+	// Elasticsearch.
+	ErrInvalidRequest
+	// ErrInvalidField means the request referenced fields unknown to the
+	// mapping or unusable for the requested operation.
+	ErrInvalidField
+	// ErrUpstreamUnavailable means Elasticsearch could not be reached or
+	// answered with a retryable/server side failure.
+	ErrUpstreamUnavailable
+	// ErrUpstreamRejected means Elasticsearch refused the request itself.
+	ErrUpstreamRejected
+	// ErrTimeout means the request deadline passed before Elasticsearch
+	// answered.
+	ErrTimeout
+	// ErrCanceled means the caller went away before the request finished.
+	ErrCanceled
+	// ErrQuotaExceeded means the caller used up its daily document quota.
+	ErrQuotaExceeded
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrIndexNotFound:
+		return "index_not_found"
+	case ErrIndexExists:
+		return "index_already_exists"
+	case ErrDocumentNotFound:
+		return "document_not_found"
+	case ErrAPIKeyNotFound:
+		return "api_key_not_found"
+	case ErrSettingsVersionNotFound:
+		return "settings_version_not_found"
+	case ErrVersionConflict:
+		return "version_conflict"
+	case ErrConflict:
+		return "conflict"
+	case ErrInvalidRequest:
+		return "invalid_request"
+	case ErrInvalidField:
+		return "invalid_field"
+	case ErrUpstreamUnavailable:
+		return "upstream_unavailable"
+	case ErrUpstreamRejected:
+		return "upstream_rejected"
+	case ErrTimeout:
+		return "timeout"
+	case ErrCanceled:
+		return "canceled"
+	case ErrQuotaExceeded:
+		return "quota_exceeded"
+	default:
+		return "internal"
+	}
+}
+
+// FieldError describes a single offending field in a request.
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// UpstreamError is the structured part of an Elasticsearch error response.
+type UpstreamError struct {
+	Status    int         `json:"status"`
+	Type      string      `json:"type,omitempty"`
+	Reason    string      `json:"reason,omitempty"`
+	RootCause []RootCause `json:"root_cause,omitempty"`
+}
+
+// RootCause is a single entry of the root_cause array returned by Elasticsearch.
+type RootCause struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// Error is the typed error returned by ElasticsearchClient methods.
+type Error struct {
+	Kind     ErrorKind
+	Message  string
+	Fields   []FieldError
+	Upstream *UpstreamError
+	Err      error
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if len(e.Fields) > 0 {
+		parts := make([]string, 0, len(e.Fields))
+		for _, f := range e.Fields {
+			parts = append(parts, f.Field+": "+f.Reason)
+		}
+		msg += " (" + strings.Join(parts, "; ") + ")"
+	}
+	if e.Upstream != nil && e.Upstream.Reason != "" {
+		msg += ": " + e.Upstream.Reason
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the ErrorKind of err, or ErrInternal if err is not a
+// services error.
+func KindOf(err error) ErrorKind {
+	var svcErr *Error
+	if errors.As(err, &svcErr) {
+		return svcErr.Kind
+	}
+	return ErrInternal
+}
+
+func invalidRequestError(msg string) error {
+	return &Error{Kind: ErrInvalidRequest, Message: msg}
+}
+
+func invalidFieldsError(msg string, fields []FieldError) error {
+	return &Error{Kind: ErrInvalidField, Message: msg, Fields: fields}
+}
+
+// transportError wraps a failure to talk to Elasticsearch at all. Failures
+// caused by the request context are reported as such rather than blamed on
+// the cluster.
+func transportError(op string, err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Kind: ErrTimeout, Message: op, Err: err}
+	case errors.Is(err, context.Canceled):
+		return &Error{Kind: ErrCanceled, Message: op, Err: err}
+	}
+	return &Error{Kind: ErrUpstreamUnavailable, Message: op, Err: err}
+}
+
+// responseError classifies a non-2xx Elasticsearch response using the error
+// type reported in its body, falling back to the HTTP status.
+func responseError(op string, res *esapi.Response) error {
+	upstream := parseUpstreamError(res)
+
+	kind := ErrUpstreamRejected
+	switch {
+	case upstream.Type == "index_not_found_exception" || res.StatusCode == http.StatusNotFound:
+		kind = ErrIndexNotFound
+	case upstream.Type == "resource_already_exists_exception" || upstream.Type == "invalid_alias_name_exception":
+		kind = ErrIndexExists
+	case upstream.Type == "version_conflict_engine_exception":
+		kind = ErrVersionConflict
+	case res.StatusCode == http.StatusConflict:
+		kind = ErrConflict
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 ||
+		upstream.Type == "cluster_block_exception":
+		// A write block is lifted again once a migration cuts over.
+		kind = ErrUpstreamUnavailable
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		// Authentication against the cluster is our problem, not the caller's.
+		kind = ErrInternal
+	}
+	return &Error{Kind: kind, Message: op, Upstream: upstream}
+}
+
+// parseUpstreamError decodes the error body of an Elasticsearch response.
+// The "error" member is usually an object but a few APIs (e.g. get alias)
+// return a bare string.
+func parseUpstreamError(res *esapi.Response) *UpstreamError {
+	upstream := &UpstreamError{Status: res.StatusCode}
+
+	var body struct {
+		Error json.RawMessage `json:"error"`
+	}
+	data, err := io.ReadAll(res.Body)
+	if err != nil || json.Unmarshal(data, &body) != nil || len(body.Error) == 0 {
+		upstream.Reason = strings.TrimSpace(string(data))
+		return upstream
+	}
+
+	var reason string
+	if json.Unmarshal(body.Error, &reason) == nil {
+		upstream.Reason = reason
+		return upstream
+	}
+	json.Unmarshal(body.Error, upstream)
+	return upstream
+}
@@ -3,21 +3,25 @@ package services
 import (
 	"bytes"
 	"context"
+	"elastic-search-config-service/metrics"
 	"elastic-search-config-service/models"
 	"encoding/json"
-	"fmt"
-	"log"
+	"time"
 
 	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func generateFacetAggregations(facetReq models.FacetListingRequest, qb *models.QueryBuilder) map[string]interface{} {
+func generateFacetAggregations(facetReq models.FacetListingRequest, qb *models.QueryBuilder) (map[string]interface{}, error) {
 	aggregations := make(map[string]interface{})
+	var invalid []FieldError
 
 	for _, facet := range facetReq.Facets {
 		fieldMapping, ok := qb.FieldMappings[facet.Field]
 		if !ok {
-			// Skip fields that do not exist in the field mappings
+			invalid = append(invalid, FieldError{Field: facet.Field, Reason: "field does not exist in index mapping"})
 			continue
 		}
 
@@ -31,7 +35,7 @@ func generateFacetAggregations(facetReq models.FacetListingRequest, qb *models.Q
 		}
 
 		if !aggregatable {
-			// Skip fields that are not aggregatable
+			invalid = append(invalid, FieldError{Field: facet.Field, Reason: "field is not aggregatable"})
 			continue
 		}
 
@@ -73,17 +77,43 @@ func generateFacetAggregations(facetReq models.FacetListingRequest, qb *models.Q
 			}
 		}
 	}
-	return aggregations
+	if len(invalid) > 0 {
+		return nil, invalidFieldsError("invalid facet fields", invalid)
+	}
+	return aggregations, nil
 }
 
 // TODO: Test nested within nested search , filtering and faceting
-func (es *ElasticsearchClient) FetchFacetData(ind models.IndexInfo, facetReq models.FacetListingRequest, qb *models.QueryBuilder) (*models.DynamicFacetResponse, error) {
+func (es *ElasticsearchClient) FetchFacetData(ctx context.Context, ind models.IndexInfo, facetReq models.FacetListingRequest, qb *models.QueryBuilder) (*models.DynamicFacetResponse, error) {
 	// Construct Elasticsearch request payload
-	aggregations := generateFacetAggregations(facetReq, qb)
+	buildStarted := time.Now()
+	_, span := tracer.Start(ctx, "generateFacetAggregations", trace.WithAttributes(attribute.String("index", ind.IndexName)))
+	aggregations, err := generateFacetAggregations(facetReq, qb)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return nil, err
+	}
+	tenantFilter, err := generateElasticsearchFilter(qb, facetReq.TenantFilter)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return nil, err
+	}
+	span.End()
+	metrics.ObserveQueryBuild("facets", time.Since(buildStarted))
 	reqBody := map[string]interface{}{
 		"size":         0, // Set size to 0 since we only need aggregations
 		"aggregations": aggregations,
 	}
+	if tenantFilter != nil {
+		reqBody["query"] = map[string]interface{}{
+			"bool": map[string]interface{}{"filter": tenantFilter},
+		}
+	}
+	es.logQuery(ctx, ind.IndexName, "facets", reqBody)
 	var buf bytes.Buffer
 
 	if err := json.NewEncoder(&buf).Encode(reqBody); err != nil {
@@ -91,27 +121,32 @@ func (es *ElasticsearchClient) FetchFacetData(ind models.IndexInfo, facetReq mod
 	}
 
 	req := esapi.SearchRequest{
-		Index: []string{ind.ReadAlias},
-		Body:  &buf,
+		Index:   []string{ind.ReadAlias},
+		Body:    &buf,
+		Timeout: searchTimeout(ctx),
 	}
-	res, err := req.Do(context.Background(), es.client)
+	started := time.Now()
+	res, err := req.Do(ctx, es.transport)
 	if err != nil {
-		return nil, err
+		return nil, transportError("error fetching facet data", err)
 	}
 	defer res.Body.Close()
 	if res.IsError() {
-		return nil, fmt.Errorf("error creating index: %s", res.String())
+		return nil, responseError("error fetching facet data", res)
 	}
-	fmt.Println(res)
 
 	var esResp models.FacetResponse
 	// var response map[string]interface{}
 	if err := json.NewDecoder(res.Body).Decode(&esResp); err != nil {
 		return nil, err
 	}
+	metrics.ObserveSearch("facets", esResp.Took, time.Since(started))
 
 	// Construct dynamic response structure
-	dynamicResponse := &models.DynamicFacetResponse{FacetData: make(map[string][]models.FacetValue)}
+	dynamicResponse := &models.DynamicFacetResponse{
+		FacetData: make(map[string][]models.FacetValue),
+		TimedOut:  esResp.TimedOut,
+	}
 
 	keyToFieldMap := make(map[string]string)
 	for _, facet := range facetReq.Facets {
@@ -164,11 +199,25 @@ func (es *ElasticsearchClient) FetchFacetData(ind models.IndexInfo, facetReq mod
 	return dynamicResponse, nil
 }
 
-func (es *ElasticsearchClient) GetFacetListing(ind models.IndexInfo, reqPayload models.FacetListingRequest) (models.DynamicFacetResponse, error) {
-	queryBuilder, _ := es.GetMappingBuilder(ind)
-	facetResponse, err := es.FetchFacetData(ind, reqPayload, &queryBuilder)
+func (es *ElasticsearchClient) GetFacetListing(ctx context.Context, ind models.IndexInfo, reqPayload models.FacetListingRequest) (models.DynamicFacetResponse, error) {
+	queryBuilder, err := es.GetMappingBuilder(ctx, ind)
+	if err != nil {
+		return models.DynamicFacetResponse{}, err
+	}
+	perms, err := es.fieldPermissions(ctx, ind, &queryBuilder, reqPayload.FieldAccess)
+	if err != nil {
+		return models.DynamicFacetResponse{}, err
+	}
+	fields := make([]string, len(reqPayload.Facets))
+	for i, facet := range reqPayload.Facets {
+		fields[i] = facet.Field
+	}
+	if hidden := perms.hidden(fields); len(hidden) > 0 {
+		return models.DynamicFacetResponse{}, invalidFieldsError("invalid facet fields", hidden)
+	}
+	facetResponse, err := es.FetchFacetData(ctx, ind, reqPayload, &queryBuilder)
 	if err != nil {
-		log.Fatalf("Error fetching facet data: %v", err)
+		return models.DynamicFacetResponse{}, err
 	}
-	return *facetResponse, err
+	return *facetResponse, nil
 }
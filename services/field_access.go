@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+
+	"elastic-search-config-service/models"
+)
+
+// fieldPermissions is the resolved view of the fields a caller may get back
+// from an index.
+type fieldPermissions struct {
+	// includes lists every permitted mapped field; nil permits all fields.
+	includes []string
+	// excludes holds denied field patterns.
+	excludes []string
+}
+
+// fieldPermissions combines the displayed attributes of the index with the
+// field rules of the caller. Displayed and allowed fields are expanded into
+// the mapped leaf fields they cover, so that the two can be intersected.
+func (es *ElasticsearchClient) fieldPermissions(ctx context.Context, ind models.IndexInfo, qb *models.QueryBuilder, access models.FieldAccess) (fieldPermissions, error) {
+	settings, err := es.GetIndexSettings(ctx, ind)
+	if err != nil {
+		return fieldPermissions{}, err
+	}
+
+	var permitted map[string]struct{}
+	restrict := func(patterns []string) {
+		fields := expandFields(qb, patterns)
+		if permitted == nil {
+			permitted = fields
+			return
+		}
+		for field := range permitted {
+			if _, ok := fields[field]; !ok {
+				delete(permitted, field)
+			}
+		}
+	}
+	if len(settings.DisplayedAttributes) > 0 {
+		restrict(settings.DisplayedAttributes)
+	}
+	if len(access.AllowedFields) > 0 {
+		restrict(access.AllowedFields)
+	}
+
+	perms := fieldPermissions{excludes: access.DeniedFields}
+	if permitted != nil {
+		perms.includes = make([]string, 0, len(permitted))
+		for field := range permitted {
+			if !matchesAnyField(access.DeniedFields, field) {
+				perms.includes = append(perms.includes, field)
+			}
+		}
+		sort.Strings(perms.includes)
+	}
+	return perms, nil
+}
+
+// allows reports whether field may be returned to the caller.
+func (p fieldPermissions) allows(field string) bool {
+	if matchesAnyField(p.excludes, field) {
+		return false
+	}
+	if p.includes == nil {
+		return true
+	}
+	i := sort.SearchStrings(p.includes, field)
+	return i < len(p.includes) && p.includes[i] == field
+}
+
+// hidden reports every one of fields the caller may not read. Filtering or
+// faceting on such a field would reveal its values through the results.
+func (p fieldPermissions) hidden(fields []string) []FieldError {
+	var invalid []FieldError
+	for _, field := range fields {
+		if !p.allows(field) {
+			invalid = append(invalid, FieldError{Field: field, Reason: "field is not displayed"})
+		}
+	}
+	return invalid
+}
+
+// source returns the _source parameter enforcing p, or nil when every field
+// is permitted.
+func (p fieldPermissions) source() interface{} {
+	if p.includes == nil && len(p.excludes) == 0 {
+		return nil
+	}
+	if p.includes != nil && len(p.includes) == 0 {
+		// Empty includes would return the whole document.
+		return false
+	}
+	source := make(map[string]interface{})
+	if p.includes != nil {
+		source["includes"] = p.includes
+	}
+	if len(p.excludes) > 0 {
+		source["excludes"] = p.excludes
+	}
+	return source
+}
+
+// sourceParams returns the _source, _source_includes and _source_excludes
+// parameters of a get or multi-get request enforcing p.
+func (p fieldPermissions) sourceParams() (source, includes, excludes []string) {
+	if p.includes != nil && len(p.includes) == 0 {
+		return []string{"false"}, nil, nil
+	}
+	return nil, p.includes, p.excludes
+}
+
+// documentPermissions is fieldPermissions for reading documents by ID.
+func (es *ElasticsearchClient) documentPermissions(ctx context.Context, ind models.IndexInfo, access models.FieldAccess) (fieldPermissions, error) {
+	qb, err := es.GetMappingBuilder(ctx, ind)
+	if err != nil {
+		return fieldPermissions{}, err
+	}
+	return es.fieldPermissions(ctx, ind, &qb, access)
+}
+
+// matchesField reports whether pattern covers field: the field itself, an
+// object containing it or a wildcard pattern matching it.
+func matchesField(pattern, field string) bool {
+	if pattern == field || strings.HasPrefix(field, pattern+".") {
+		return true
+	}
+	ok, _ := path.Match(pattern, field)
+	return ok
+}
+
+func matchesAnyField(patterns []string, field string) bool {
+	for _, pattern := range patterns {
+		if matchesField(pattern, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandFields returns the mapped leaf fields covered by patterns.
+func expandFields(qb *models.QueryBuilder, patterns []string) map[string]struct{} {
+	fields := make(map[string]struct{})
+	for field := range qb.FieldMappings {
+		if matchesAnyField(patterns, field) {
+			fields[field] = struct{}{}
+		}
+	}
+	return fields
+}
+
+// unknownFields reports every pattern that covers no mapped field.
+func unknownFields(qb *models.QueryBuilder, name string, patterns []string) []FieldError {
+	var invalid []FieldError
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			invalid = append(invalid, FieldError{Field: pattern, Reason: "invalid pattern in " + name})
+			continue
+		}
+		if len(expandFields(qb, []string{pattern})) == 0 {
+			invalid = append(invalid, FieldError{Field: pattern, Reason: "matches no field in index mapping (" + name + ")"})
+		}
+	}
+	return invalid
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"elastic-search-config-service/models"
+	"elastic-search-config-service/store"
+)
+
+// newFieldAccessClient returns a client whose products index maps a few
+// fields and displays attributes, without an Elasticsearch cluster.
+func newFieldAccessClient(t *testing.T, attributes []string) *ElasticsearchClient {
+	t.Helper()
+	es := &ElasticsearchClient{mappings: NewMappingRegistry(0), migrations: newMigrationTracker(), settings: newSettingsCache()}
+	es.SetConfigStore(store.NewFileStore(filepath.Join(t.TempDir(), "config.json")))
+	es.mappings.Put("products", models.MappingInfo{
+		IndexName: "products",
+		FieldMappings: map[string]models.FieldMapping{
+			"title":          {DataType: []string{"text"}},
+			"brand":          {DataType: []string{"keyword"}},
+			"price":          {DataType: []string{"float"}},
+			"cost":           {DataType: []string{"float"}},
+			"tenant":         {DataType: []string{"keyword"}},
+			"supplier.name":  {Path: "supplier", DataType: []string{"keyword"}, IsNested: true},
+			"supplier.email": {Path: "supplier", DataType: []string{"keyword"}, IsNested: true},
+		},
+	}, MappingSourceElasticsearch, 1)
+	if len(attributes) > 0 {
+		if _, err := es.saveIndexSettings(context.Background(), "products", displayed(attributes...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return es
+}
+
+func TestFieldPermissions(t *testing.T) {
+	tests := []struct {
+		name        string
+		displayed   []string
+		access      models.FieldAccess
+		wantAllowed []string
+		// wantSource, wantIncludes and wantExcludes are the get parameters.
+		wantSource   []string
+		wantIncludes []string
+		wantExcludes []string
+	}{
+		{
+			name:        "no rules",
+			wantAllowed: []string{"brand", "cost", "price", "supplier.email", "supplier.name", "tenant", "title"},
+		},
+		{
+			name:         "displayed attributes",
+			displayed:    []string{"title", "supplier"},
+			wantAllowed:  []string{"supplier.email", "supplier.name", "title"},
+			wantIncludes: []string{"supplier.email", "supplier.name", "title"},
+		},
+		{
+			name:         "allowed fields narrow the displayed ones",
+			displayed:    []string{"title", "price", "supplier"},
+			access:       models.FieldAccess{AllowedFields: []string{"title", "supplier.n*", "brand"}},
+			wantAllowed:  []string{"supplier.name", "title"},
+			wantIncludes: []string{"supplier.name", "title"},
+		},
+		{
+			name:         "denied fields",
+			access:       models.FieldAccess{DeniedFields: []string{"cost", "supplier.email"}},
+			wantAllowed:  []string{"brand", "price", "supplier.name", "tenant", "title"},
+			wantExcludes: []string{"cost", "supplier.email"},
+		},
+		{
+			name:         "denied fields among the allowed ones",
+			access:       models.FieldAccess{AllowedFields: []string{"title", "cost"}, DeniedFields: []string{"cost"}},
+			wantAllowed:  []string{"title"},
+			wantIncludes: []string{"title"},
+			wantExcludes: []string{"cost"},
+		},
+		{
+			name:       "nothing left",
+			displayed:  []string{"title"},
+			access:     models.FieldAccess{AllowedFields: []string{"price"}},
+			wantSource: []string{"false"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			es := newFieldAccessClient(t, tt.displayed)
+			perms, err := es.documentPermissions(ctx, models.IndexInfo{IndexName: "products"}, tt.access)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var allowed []string
+			for _, field := range []string{"brand", "cost", "price", "supplier.email", "supplier.name", "tenant", "title"} {
+				if perms.allows(field) {
+					allowed = append(allowed, field)
+				}
+			}
+			if !reflect.DeepEqual(allowed, tt.wantAllowed) {
+				t.Errorf("allowed = %q, want %q", allowed, tt.wantAllowed)
+			}
+			source, includes, excludes := perms.sourceParams()
+			if !reflect.DeepEqual(source, tt.wantSource) || !reflect.DeepEqual(includes, tt.wantIncludes) || !reflect.DeepEqual(excludes, tt.wantExcludes) {
+				t.Errorf("source params = %q %q %q, want %q %q %q", source, includes, excludes, tt.wantSource, tt.wantIncludes, tt.wantExcludes)
+			}
+		})
+	}
+}
+
+func TestSearchFilterFieldAccess(t *testing.T) {
+	tests := []struct {
+		name         string
+		filter       string
+		tenantFilter string
+		access       models.FieldAccess
+		wantHidden   []string
+	}{
+		{
+			name:   "displayed field",
+			filter: `[{"field":"brand","values":["acme"]}]`,
+		},
+		{
+			name:       "field outside the displayed attributes",
+			filter:     `[{"field":"cost","values":["10"]}]`,
+			wantHidden: []string{"cost"},
+		},
+		{
+			name:       "denied field",
+			filter:     `[{"field":"brand","values":["acme"]},{"field":"supplier.email","values":["a@example.com"]}]`,
+			access:     models.FieldAccess{DeniedFields: []string{"supplier.email"}},
+			wantHidden: []string{"supplier.email"},
+		},
+		{
+			name:       "field outside the allowed fields",
+			filter:     `[{"field":"brand","values":["acme"]}]`,
+			access:     models.FieldAccess{AllowedFields: []string{"title"}},
+			wantHidden: []string{"brand"},
+		},
+		{
+			name:         "tenant filter on a hidden field",
+			filter:       `[{"field":"brand","values":["acme"]}]`,
+			tenantFilter: `[{"field":"tenant","values":["acme"]}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			es := newFieldAccessClient(t, []string{"title", "brand", "price", "supplier"})
+			req := models.SearchReq{IndexName: "products", PageSize: 10, FieldAccess: tt.access}
+			if err := json.Unmarshal([]byte(tt.filter), &req.Filter); err != nil {
+				t.Fatal(err)
+			}
+			if tt.tenantFilter != "" {
+				if err := json.Unmarshal([]byte(tt.tenantFilter), &req.TenantFilter); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := es.buildSearchQuery(ctx, req)
+			assertHiddenFields(t, err, tt.wantHidden)
+		})
+	}
+}
+
+func TestFacetFieldAccess(t *testing.T) {
+	ctx := context.Background()
+	es := newFieldAccessClient(t, []string{"title", "brand"})
+	_, err := es.GetFacetListing(ctx, models.IndexInfo{IndexName: "products"}, models.FacetListingRequest{
+		Facets: []models.FacetInfo{{Key: "brands", Field: "brand"}, {Key: "costs", Field: "cost"}},
+	})
+	assertHiddenFields(t, err, []string{"cost"})
+}
+
+func assertHiddenFields(t *testing.T, err error, want []string) {
+	t.Helper()
+	if len(want) == 0 {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	serviceErr, ok := err.(*Error)
+	if !ok || serviceErr.Kind != ErrInvalidField {
+		t.Fatalf("err = %v, want invalid fields %q", err, want)
+	}
+	var got []string
+	for _, field := range serviceErr.Fields {
+		got = append(got, field.Field)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hidden fields = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"elastic-search-config-service/models"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// readinessTimeout bounds the Elasticsearch check of a readiness probe so a
+// hanging cluster fails the probe instead of stalling it.
+const readinessTimeout = 2 * time.Second
+
+type clusterHealth struct {
+	ClusterName  string `json:"cluster_name"`
+	Status       string `json:"status"`
+	PendingTasks int    `json:"number_of_pending_tasks"`
+}
+
+func (es *ElasticsearchClient) clusterHealth(ctx context.Context) (clusterHealth, error) {
+	req := esapi.ClusterHealthRequest{}
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		return clusterHealth{}, transportError("error getting cluster health", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return clusterHealth{}, responseError("error getting cluster health", res)
+	}
+
+	var health clusterHealth
+	if err := json.NewDecoder(res.Body).Decode(&health); err != nil {
+		return clusterHealth{}, err
+	}
+	return health, nil
+}
+
+// BeginShutdown makes readiness fail from now on, so that load balancers stop
+// sending requests to an instance that is draining.
+func (es *ElasticsearchClient) BeginShutdown() {
+	es.shuttingDown.Store(true)
+}
+
+// Readiness reports whether the instance can serve requests: it must not be
+// shutting down, Elasticsearch must answer with a cluster health other than
+// red and the mappings kept in the config store must have been loaded.
+func (es *ElasticsearchClient) Readiness(ctx context.Context) models.Readiness {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	checks := make(map[string]models.HealthCheck)
+	health, err := es.clusterHealth(ctx)
+	switch {
+	case err != nil:
+		checks["elasticsearch"] = models.HealthCheck{Status: models.CheckFail, Message: err.Error()}
+	case health.Status == "red":
+		checks["elasticsearch"] = models.HealthCheck{Status: models.CheckFail, Message: "cluster health is red"}
+	default:
+		checks["elasticsearch"] = models.HealthCheck{Status: models.CheckOK, Message: "cluster health is " + health.Status}
+	}
+
+	if es.BootstrapStatus().StoreLoaded {
+		checks["mapping_store"] = models.HealthCheck{Status: models.CheckOK}
+	} else {
+		checks["mapping_store"] = models.HealthCheck{Status: models.CheckFail, Message: "mappings not loaded from config store yet"}
+	}
+
+	if es.shuttingDown.Load() {
+		checks["shutdown"] = models.HealthCheck{Status: models.CheckFail, Message: "shutting down"}
+	}
+
+	ready := true
+	for _, check := range checks {
+		if check.Status != models.CheckOK {
+			ready = false
+		}
+	}
+	return models.Readiness{Ready: ready, Checks: checks}
+}
+
+// ClusterStatus describes the cluster and every logical index found through
+// its aliases.
+func (es *ElasticsearchClient) ClusterStatus(ctx context.Context) (models.ClusterStatus, error) {
+	var status models.ClusterStatus
+
+	infoReq := esapi.InfoRequest{}
+	infoRes, err := infoReq.Do(ctx, es.transport)
+	if err != nil {
+		return status, transportError("error getting cluster info", err)
+	}
+	defer infoRes.Body.Close()
+	if infoRes.IsError() {
+		return status, responseError("error getting cluster info", infoRes)
+	}
+	var info struct {
+		ClusterName string `json:"cluster_name"`
+		Version     struct {
+			Number string `json:"number"`
+		} `json:"version"`
+	}
+	if err := json.NewDecoder(infoRes.Body).Decode(&info); err != nil {
+		return status, err
+	}
+	status.ClusterName = info.ClusterName
+	status.Version = info.Version.Number
+
+	health, err := es.clusterHealth(ctx)
+	if err != nil {
+		return status, err
+	}
+	status.Health = health.Status
+	status.PendingTasks = health.PendingTasks
+
+	status.RunningTasks, err = es.runningTasks(ctx)
+	if err != nil {
+		return status, err
+	}
+	status.RunningMigrations, _ = es.migrations.depth()
+
+	status.Indices, err = es.logicalIndexStatuses(ctx)
+	if err != nil {
+		return status, err
+	}
+	return status, nil
+}
+
+// runningTasks counts reindex and by-query tasks running in the cluster.
+func (es *ElasticsearchClient) runningTasks(ctx context.Context) (int, error) {
+	req := esapi.TasksListRequest{
+		Actions: []string{"*reindex", "*byquery"},
+	}
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		return 0, transportError("error listing tasks", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return 0, responseError("error listing tasks", res)
+	}
+
+	var tasksResponse struct {
+		Nodes map[string]struct {
+			Tasks map[string]json.RawMessage `json:"tasks"`
+		} `json:"nodes"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&tasksResponse); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, node := range tasksResponse.Nodes {
+		count += len(node.Tasks)
+	}
+	return count, nil
+}
+
+func (es *ElasticsearchClient) logicalIndexStatuses(ctx context.Context) ([]models.LogicalIndexStatus, error) {
+	suffixes := models.GetIndexInfo(models.IndexName{})
+	aliasReq := esapi.IndicesGetAliasRequest{
+		Name: []string{"*" + suffixes.ReadAlias, "*" + suffixes.WriteAlias},
+	}
+	aliasRes, err := aliasReq.Do(ctx, es.transport)
+	if err != nil {
+		return nil, transportError("error getting aliases", err)
+	}
+	defer aliasRes.Body.Close()
+	if aliasRes.StatusCode == http.StatusNotFound {
+		return []models.LogicalIndexStatus{}, nil
+	}
+	if aliasRes.IsError() {
+		return nil, responseError("error getting aliases", aliasRes)
+	}
+
+	var aliasResponse map[string]struct {
+		Aliases map[string]json.RawMessage `json:"aliases"`
+	}
+	if err := json.NewDecoder(aliasRes.Body).Decode(&aliasResponse); err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*models.LogicalIndexStatus)
+	entry := func(name string) *models.LogicalIndexStatus {
+		st, ok := byName[name]
+		if !ok {
+			ind := models.GetIndexInfo(models.IndexName{Index: name})
+			st = &models.LogicalIndexStatus{
+				Name:       name,
+				ReadAlias:  models.AliasTopology{Name: ind.ReadAlias, Indices: []string{}},
+				WriteAlias: models.AliasTopology{Name: ind.WriteAlias, Indices: []string{}},
+				Migrating:  es.migrations.active(ctx, name),
+			}
+			byName[name] = st
+		}
+		return st
+	}
+	var physical []string
+	for index, aliases := range aliasResponse {
+		physical = append(physical, index)
+		for alias := range aliases.Aliases {
+			switch {
+			case strings.HasSuffix(alias, suffixes.ReadAlias):
+				st := entry(strings.TrimSuffix(alias, suffixes.ReadAlias))
+				st.ReadAlias.Indices = append(st.ReadAlias.Indices, index)
+			case strings.HasSuffix(alias, suffixes.WriteAlias):
+				st := entry(strings.TrimSuffix(alias, suffixes.WriteAlias))
+				st.WriteAlias.Indices = append(st.WriteAlias.Indices, index)
+			}
+		}
+	}
+
+	docCounts, err := es.docCounts(ctx, physical)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]models.LogicalIndexStatus, 0, len(byName))
+	for _, st := range byName {
+		sort.Strings(st.ReadAlias.Indices)
+		sort.Strings(st.WriteAlias.Indices)
+		st.Generation = strings.Join(st.ReadAlias.Indices, ",")
+		for _, index := range st.ReadAlias.Indices {
+			st.DocCount += docCounts[index]
+		}
+		statuses = append(statuses, *st)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses, nil
+}
+
+// docCounts returns the number of documents of each physical index.
+func (es *ElasticsearchClient) docCounts(ctx context.Context, indices []string) (map[string]int64, error) {
+	counts := make(map[string]int64, len(indices))
+	if len(indices) == 0 {
+		return counts, nil
+	}
+	req := esapi.CatIndicesRequest{
+		Index:  indices,
+		Format: "json",
+		H:      []string{"index", "docs.count"},
+	}
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		return nil, transportError("error getting document counts", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, responseError("error getting document counts", res)
+	}
+
+	var rows []struct {
+		Index     string `json:"index"`
+		DocsCount string `json:"docs.count"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		// Closed indices report no count.
+		n, _ := strconv.ParseInt(row.DocsCount, 10, 64)
+		counts[row.Index] = n
+	}
+	return counts, nil
+}
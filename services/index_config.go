@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+
+	"elastic-search-config-service/models"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// IndexConfig gathers the whole configuration of a logical index: the
+// physical indices behind its aliases, its stored settings, the dynamic
+// Elasticsearch settings of its write index and its field mappings.
+func (es *ElasticsearchClient) IndexConfig(ctx context.Context, ind models.IndexInfo) (models.IndexConfig, error) {
+	readIndices, err := es.aliasIndices(ctx, ind.ReadAlias)
+	if err != nil {
+		return models.IndexConfig{}, err
+	}
+	writeIndices, err := es.aliasIndices(ctx, ind.WriteAlias)
+	if err != nil {
+		return models.IndexConfig{}, err
+	}
+	settings, err := es.GetIndexSettings(ctx, ind)
+	if err != nil {
+		return models.IndexConfig{}, err
+	}
+	dynamic, err := es.dynamicIndexSettings(ctx, writeIndices[len(writeIndices)-1])
+	if err != nil {
+		return models.IndexConfig{}, err
+	}
+	qb, err := es.GetMappingBuilder(ctx, ind)
+	if err != nil {
+		return models.IndexConfig{}, err
+	}
+
+	return models.IndexConfig{
+		IndexName:     ind.IndexName,
+		ReadIndices:   readIndices,
+		WriteIndices:  writeIndices,
+		Settings:      settings,
+		IndexSettings: dynamic,
+		FieldMappings: qb.FieldMappings,
+	}, nil
+}
+
+// dynamicIndexSettings returns the settings of index that can be changed
+// through UpdateIndexSettings, keyed without the "index." prefix.
+func (es *ElasticsearchClient) dynamicIndexSettings(ctx context.Context, index string) (map[string]interface{}, error) {
+	settings, err := es.physicalIndexSettings(ctx, index)
+	if err != nil {
+		return nil, err
+	}
+	return dynamicSettingsOf(settings), nil
+}
+
+// physicalIndexSettings returns the settings of a physical index as nested
+// maps below the "index" level, with values as Elasticsearch reports them.
+func (es *ElasticsearchClient) physicalIndexSettings(ctx context.Context, index string) (map[string]interface{}, error) {
+	req := esapi.IndicesGetSettingsRequest{
+		Index: []string{index},
+	}
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		return nil, transportError("error getting index settings", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, responseError("error getting index settings", res)
+	}
+
+	var resp map[string]struct {
+		Settings struct {
+			Index map[string]interface{} `json:"index"`
+		} `json:"settings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, err
+	}
+	return resp[index].Settings.Index, nil
+}
+
+// staticGenerationSettings are the static settings a new generation of an
+// index inherits from the current one.
+var staticGenerationSettings = []string{"number_of_shards", "number_of_replicas", "analysis", "similarity"}
+
+// generationSettings returns the settings a new generation of index is
+// created with, so that a migration keeps its shards, replicas, analysis and
+// the dynamic settings applied through UpdateIndexSettings.
+func (es *ElasticsearchClient) generationSettings(ctx context.Context, index string) (map[string]interface{}, error) {
+	current, err := es.physicalIndexSettings(ctx, index)
+	if err != nil {
+		return nil, err
+	}
+	settings := make(map[string]interface{})
+	for _, key := range staticGenerationSettings {
+		if value, ok := current[key]; ok {
+			settings[key] = value
+		}
+	}
+	for key, value := range dynamicSettingsOf(current) {
+		if _, ok := settings[key]; !ok {
+			settings[key] = value
+		}
+	}
+	return settings, nil
+}
+
+// dynamicSettingsOf keeps the dynamic entries of nested index settings,
+// flattened into dotted keys.
+func dynamicSettingsOf(settings map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{})
+	flattenSettings("", settings, flat)
+	dynamic := make(map[string]interface{})
+	for key, value := range flat {
+		if isDynamicSetting(key) {
+			dynamic[key] = value
+		}
+	}
+	return dynamic
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"elastic-search-config-service/models"
+	"elastic-search-config-service/store"
+)
+
+// indexSettingsCacheTTL bounds how long a settings change made on another
+// replica takes to reach searches served by this one.
+const indexSettingsCacheTTL = 30 * time.Second
+
+type cachedIndexSettings struct {
+	settings models.IndexSettings
+	loadedAt time.Time
+}
+
+// settingsCache keeps the stored settings of each logical index, read on
+// every search.
+type settingsCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedIndexSettings
+}
+
+func newSettingsCache() *settingsCache {
+	return &settingsCache{entries: make(map[string]cachedIndexSettings)}
+}
+
+// GetIndexSettings returns the settings stored for a logical index. An index
+// without stored settings has empty ones.
+func (es *ElasticsearchClient) GetIndexSettings(ctx context.Context, ind models.IndexInfo) (models.IndexSettings, error) {
+	es.settings.mu.Lock()
+	cached, ok := es.settings.entries[ind.IndexName]
+	es.settings.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < indexSettingsCacheTTL {
+		return cached.settings, nil
+	}
+
+	var settings models.IndexSettings
+	rec, err := es.store.Get(ctx, store.CollectionSettings, ind.IndexName)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+	case err != nil:
+		return models.IndexSettings{}, fmt.Errorf("error getting index settings: %w", err)
+	default:
+		if err := json.Unmarshal(rec.Value, &settings); err != nil {
+			return models.IndexSettings{}, fmt.Errorf("error decoding index settings of %s: %w", ind.IndexName, err)
+		}
+	}
+
+	es.settings.mu.Lock()
+	es.settings.entries[ind.IndexName] = cachedIndexSettings{settings: settings, loadedAt: time.Now()}
+	es.settings.mu.Unlock()
+	return settings, nil
+}
+
+// UpdateDisplayedAttributes sets the fields returned by search and facets on
+// a logical index. Every entry must match at least one mapped field; an
+// empty list returns every field again.
+func (es *ElasticsearchClient) UpdateDisplayedAttributes(ctx context.Context, ind models.IndexInfo, attributes []string) (models.IndexSettings, error) {
+	qb, err := es.GetMappingBuilder(ctx, ind)
+	if err != nil {
+		return models.IndexSettings{}, err
+	}
+	if invalid := unknownFields(&qb, "displayed_attributes", attributes); len(invalid) > 0 {
+		return models.IndexSettings{}, invalidFieldsError("invalid displayed attributes", invalid)
+	}
+	return es.saveIndexSettings(ctx, ind.IndexName, func(s *models.IndexSettings) {
+		s.DisplayedAttributes = attributes
+	})
+}
+
+// saveIndexSettings applies fn to the stored settings of index and records
+// the result in the settings history.
+func (es *ElasticsearchClient) saveIndexSettings(ctx context.Context, index string, fn func(s *models.IndexSettings)) (models.IndexSettings, error) {
+	settings, _, err := es.storeIndexSettings(ctx, index, 0, fn)
+	return settings, err
+}
+
+// storeIndexSettings is saveIndexSettings for a change that restores version
+// restoredFrom, or any other change when it is zero. It also returns the
+// history version the result was recorded as, zero if it was not.
+func (es *ElasticsearchClient) storeIndexSettings(ctx context.Context, index string, restoredFrom int64, fn func(s *models.IndexSettings)) (models.IndexSettings, models.IndexSettingsVersion, error) {
+	var previous, settings models.IndexSettings
+	_, err := store.Update(ctx, es.store, store.CollectionSettings, index, func(current []byte) ([]byte, error) {
+		previous, settings = models.IndexSettings{}, models.IndexSettings{}
+		if current != nil {
+			if err := json.Unmarshal(current, &previous); err != nil {
+				return nil, fmt.Errorf("error decoding index settings of %s: %w", index, err)
+			}
+			json.Unmarshal(current, &settings)
+		}
+		fn(&settings)
+		return json.Marshal(settings)
+	})
+	if err != nil {
+		return models.IndexSettings{}, models.IndexSettingsVersion{}, fmt.Errorf("error saving index settings: %w", err)
+	}
+
+	es.settings.mu.Lock()
+	es.settings.entries[index] = cachedIndexSettings{settings: settings, loadedAt: time.Now()}
+	es.settings.mu.Unlock()
+
+	// The settings are in effect by now, but a change missing from the
+	// history could neither be diffed nor restored, so it fails the request.
+	// Saving the same settings again records them then.
+	version, err := es.recordSettingsVersion(ctx, index, previous, settings, restoredFrom)
+	if err != nil {
+		return settings, models.IndexSettingsVersion{}, fmt.Errorf("error recording settings history: %w", err)
+	}
+	return settings, version, nil
+}
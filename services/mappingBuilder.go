@@ -2,32 +2,17 @@ package services
 
 import (
 	"context"
-	"elastic-search-config-service/globals"
 	"elastic-search-config-service/models"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
 	"strings"
-	"sync"
+
+	"elastic-search-config-service/store"
 
 	"github.com/elastic/go-elasticsearch/v8/esapi"
 )
 
-// LoadMappingsFromFile loads the mappings from a JSON file
-func LoadMappingsFromFile(filename string) (map[string]models.MappingInfo, error) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf("error reading mappings file: %w", err)
-	}
-
-	var mappings map[string]models.MappingInfo
-	if err := json.Unmarshal(data, &mappings); err != nil {
-		return nil, fmt.Errorf("error unmarshaling mappings: %w", err)
-	}
-
-	return mappings, nil
-}
-
 // processMapping recursively processes the Elasticsearch mapping
 func processMapping(properties map[string]interface{}, prefix string, fieldMappings map[string]models.FieldMapping) error {
 	for field, mapping := range properties {
@@ -82,18 +67,18 @@ func updateNestedStatus(nestedPath string, fieldMappings map[string]models.Field
 }
 
 // InferMappingsFromES creates MappingInfo from Elasticsearch mapping
-func (es *ElasticsearchClient) InferMappingsFromES(indexName string) (*models.MappingInfo, error) {
+func (es *ElasticsearchClient) InferMappingsFromES(ctx context.Context, indexName string) (*models.MappingInfo, error) {
 	getMappingReq := esapi.IndicesGetMappingRequest{
 		Index: []string{indexName},
 	}
 
-	getMappingRes, err := getMappingReq.Do(context.Background(), es.client)
+	getMappingRes, err := getMappingReq.Do(ctx, es.transport)
 	if err != nil {
-		return nil, err
+		return nil, transportError("error getting index mapping", err)
 	}
 	defer getMappingRes.Body.Close()
 	if getMappingRes.IsError() {
-		return nil, fmt.Errorf("error creating index: %s", getMappingRes.String())
+		return nil, responseError("error getting index mapping", getMappingRes)
 	}
 
 	var mappingResponse map[string]interface{}
@@ -117,94 +102,77 @@ func (es *ElasticsearchClient) InferMappingsFromES(indexName string) (*models.Ma
 	}, nil
 }
 
-// Thread-safe file operations
-var fileMutex sync.Mutex
-
-// createBackup creates a backup of the existing file
-func createBackup(filename string) error {
-	backupName := filename + ".backup"
-	input, err := os.ReadFile(filename)
+// LoadMappingsFromStore seeds the mapping registry with every mapping kept in
+// the config store and returns how many were loaded.
+func (es *ElasticsearchClient) LoadMappingsFromStore(ctx context.Context) (int, error) {
+	records, err := es.store.List(ctx, store.CollectionMappings)
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("error loading mappings from config store: %w", err)
 	}
-
-	err = os.WriteFile(backupName, input, 0644)
-	if err != nil {
-		return err
+	for _, rec := range records {
+		var info models.MappingInfo
+		if err := json.Unmarshal(rec.Value, &info); err != nil {
+			return 0, fmt.Errorf("error unmarshaling mapping %s: %w", rec.Key, err)
+		}
+		es.mappings.Put(rec.Key, info, MappingSourceStore, rec.Version)
 	}
-
-	return nil
+	return len(records), nil
 }
 
-// SaveMappingsToFile saves the mappings to a JSON file, appending new entries
-// and updating existing ones
-func SaveMappingsToFile(newMappings map[string]models.MappingInfo, filename string) error {
-	fileMutex.Lock()
-	defer fileMutex.Unlock()
-
-	// Create file if it doesn't exist
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		return saveToFile(newMappings, filename)
-	}
-
-	// Load existing mappings
-	existingMappings, err := LoadMappingsFromFile(filename)
-	if err != nil {
-		// If there's an error reading the file (e.g., corrupted JSON),
-		// backup the existing file and create a new one
-		if err := createBackup(filename); err != nil {
-			return fmt.Errorf("error creating backup: %w", err)
+// ImportMappings writes mappings into the config store unless a record for
+// the index already exists, and returns how many were imported.
+func (es *ElasticsearchClient) ImportMappings(ctx context.Context, mappings map[string]models.MappingInfo) (int, error) {
+	imported := 0
+	for key, info := range mappings {
+		data, err := json.Marshal(info)
+		if err != nil {
+			return imported, err
 		}
-		return saveToFile(newMappings, filename)
-	}
-
-	// Merge new mappings with existing ones
-	for indexName, mapping := range newMappings {
-		existingMappings[indexName] = mapping
+		_, err = es.store.Put(ctx, store.CollectionMappings, logicalIndexName(key), data, 0)
+		if errors.Is(err, store.ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return imported, err
+		}
+		imported++
 	}
-
-	// Save merged mappings back to file
-	return saveToFile(existingMappings, filename)
+	return imported, nil
 }
 
-// saveToFile handles the actual file writing
-func saveToFile(mappings map[string]models.MappingInfo, filename string) error {
-	data, err := json.MarshalIndent(mappings, "", "    ")
+// saveMapping persists the mapping of a logical index, overwriting whatever
+// version is currently stored.
+func (es *ElasticsearchClient) saveMapping(ctx context.Context, info models.MappingInfo) (int64, error) {
+	data, err := json.Marshal(info)
 	if err != nil {
-		return fmt.Errorf("error marshaling mappings: %w", err)
+		return 0, err
 	}
-
-	if err := os.WriteFile(filename, data, 0644); err != nil {
-		return fmt.Errorf("error writing mappings file: %w", err)
-	}
-
-	return nil
+	return store.Update(ctx, es.store, store.CollectionMappings, info.IndexName, func([]byte) ([]byte, error) {
+		return data, nil
+	})
 }
 
-func (es *ElasticsearchClient) GetQueryBuilder(indexName string) (*models.QueryBuilder, error) {
-	mappingInfo, exists := globals.ESIndexMappings[indexName]
-	if !exists {
-		mappingInfo, err := es.InferMappingsFromES(indexName)
+// GetQueryBuilder returns a QueryBuilder for the logical index, loading its
+// mapping from Elasticsearch through the read alias when it is not cached.
+func (es *ElasticsearchClient) GetQueryBuilder(ctx context.Context, ind models.IndexInfo) (*models.QueryBuilder, error) {
+	mappingInfo, err := es.mappings.Get(ind.IndexName, func() (models.MappingInfo, int64, error) {
+		// The load is shared with concurrent callers, so it must not be cut
+		// short when only the first of them goes away.
+		ctx := context.WithoutCancel(ctx)
+		inferred, err := es.InferMappingsFromES(ctx, ind.ReadAlias)
 		if err != nil {
-			return nil, err
-		}
-
-		// Store mappings in a map with index name as key
-		allMappings := map[string]models.MappingInfo{
-			mappingInfo.IndexName: *mappingInfo,
+			return models.MappingInfo{}, 0, err
 		}
+		inferred.IndexName = ind.IndexName
 
-		globals.ESIndexMappings = allMappings
-
-		// Save mappings to file
-		if err := SaveMappingsToFile(allMappings, "es_mappings.json"); err != nil {
-			return nil, err
+		version, err := es.saveMapping(ctx, *inferred)
+		if err != nil {
+			return models.MappingInfo{}, 0, err
 		}
-	}
-
-	mappingInfo, exists = globals.ESIndexMappings[indexName]
-	if !exists {
-		return nil, fmt.Errorf("no mapping found for index: %s", indexName)
+		return *inferred, version, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &models.QueryBuilder{
@@ -212,10 +180,10 @@ func (es *ElasticsearchClient) GetQueryBuilder(indexName string) (*models.QueryB
 	}, nil
 }
 
-func (es *ElasticsearchClient) GetMappingBuilder(ind models.IndexInfo) (models.QueryBuilder, error) {
-	queryBuilder, err := es.GetQueryBuilder(ind.ReadAlias)
+func (es *ElasticsearchClient) GetMappingBuilder(ctx context.Context, ind models.IndexInfo) (models.QueryBuilder, error) {
+	queryBuilder, err := es.GetQueryBuilder(ctx, ind)
 	if err != nil {
-		return models.QueryBuilder{}, fmt.Errorf("some error occurred while retrieving mappings info")
+		return models.QueryBuilder{}, fmt.Errorf("error retrieving mappings info for %s: %w", ind.IndexName, err)
 	}
 
 	return *queryBuilder, nil
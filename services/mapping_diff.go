@@ -0,0 +1,149 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// mappingDiff lists the differences between two sets of mapping properties.
+// Additions can be applied to a live index with the put mapping API;
+// anything in Breaking requires a reindex into a new index.
+type mappingDiff struct {
+	Additions []string
+	Breaking  []string
+}
+
+func (d mappingDiff) empty() bool {
+	return len(d.Additions) == 0 && len(d.Breaking) == 0
+}
+
+func (d mappingDiff) additive() bool {
+	return len(d.Additions) > 0 && len(d.Breaking) == 0
+}
+
+// diffProperties compares the "properties" of the current mapping with the
+// desired one. New fields, new multi-fields and new copy_to targets are
+// additions; any other change is breaking, since a put mapping request cannot
+// express it. That includes a field missing from the desired mapping. Both
+// sides must have been decoded from JSON so that values compare equal
+// regardless of how they were built.
+func diffProperties(prefix string, current, desired map[string]interface{}) mappingDiff {
+	var diff mappingDiff
+
+	for _, name := range sortedKeys(desired) {
+		path := joinPath(prefix, name)
+		desiredField, _ := desired[name].(map[string]interface{})
+		currentField, exists := current[name].(map[string]interface{})
+		if !exists {
+			diff.Additions = append(diff.Additions, "added field "+path)
+			continue
+		}
+		diff.merge(diffField(path, currentField, desiredField))
+	}
+	for _, name := range sortedKeys(current) {
+		if _, ok := desired[name]; !ok {
+			diff.Breaking = append(diff.Breaking, "removed field "+joinPath(prefix, name))
+		}
+	}
+	return diff
+}
+
+func diffField(path string, current, desired map[string]interface{}) mappingDiff {
+	var diff mappingDiff
+
+	for _, param := range sortedKeys(desired) {
+		desiredValue := desired[param]
+		currentValue, exists := current[param]
+
+		switch param {
+		case "properties":
+			currentProps, _ := currentValue.(map[string]interface{})
+			desiredProps, _ := desiredValue.(map[string]interface{})
+			diff.merge(diffProperties(path, currentProps, desiredProps))
+		case "fields":
+			currentFields, _ := currentValue.(map[string]interface{})
+			desiredFields, _ := desiredValue.(map[string]interface{})
+			for _, sub := range sortedKeys(desiredFields) {
+				subPath := path + "." + sub
+				currentSub, ok := currentFields[sub]
+				switch {
+				case !ok:
+					diff.Additions = append(diff.Additions, "added multi-field "+subPath)
+				case !reflect.DeepEqual(currentSub, desiredFields[sub]):
+					diff.Breaking = append(diff.Breaking, "changed multi-field "+subPath)
+				}
+			}
+			for _, sub := range sortedKeys(currentFields) {
+				if _, ok := desiredFields[sub]; !ok {
+					diff.Breaking = append(diff.Breaking, "removed multi-field "+path+"."+sub)
+				}
+			}
+		case "copy_to":
+			currentTargets := stringSet(currentValue)
+			desiredTargets := stringSet(desiredValue)
+			for _, target := range sortedKeys(currentTargets) {
+				if _, ok := desiredTargets[target]; !ok {
+					diff.Breaking = append(diff.Breaking, fmt.Sprintf("removed copy_to target %s from %s", target, path))
+				}
+			}
+			for _, target := range sortedKeys(desiredTargets) {
+				if _, ok := currentTargets[target]; !ok {
+					diff.Additions = append(diff.Additions, fmt.Sprintf("added copy_to target %s to %s", target, path))
+				}
+			}
+		default:
+			if !exists || !reflect.DeepEqual(currentValue, desiredValue) {
+				diff.Breaking = append(diff.Breaking, fmt.Sprintf("changed %s of %s from %v to %v", param, path, currentValue, desiredValue))
+			}
+		}
+	}
+	for _, param := range sortedKeys(current) {
+		if _, ok := desired[param]; ok {
+			continue
+		}
+		diff.Breaking = append(diff.Breaking, fmt.Sprintf("removed %s from %s", param, path))
+	}
+	return diff
+}
+
+func (d *mappingDiff) merge(other mappingDiff) {
+	d.Additions = append(d.Additions, other.Additions...)
+	d.Breaking = append(d.Breaking, other.Breaking...)
+}
+
+// stringSet accepts copy_to as either a single string or a list.
+func stringSet(v interface{}) map[string]interface{} {
+	set := make(map[string]interface{})
+	switch t := v.(type) {
+	case string:
+		set[t] = struct{}{}
+	case []interface{}:
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				set[s] = struct{}{}
+			}
+		}
+	case []string:
+		for _, s := range t {
+			set[s] = struct{}{}
+		}
+	}
+	return set
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"elastic-search-config-service/models"
+)
+
+func TestDiffProperties(t *testing.T) {
+	tests := []struct {
+		name          string
+		current       string
+		desired       string
+		wantAdditions []string
+		wantBreaking  []string
+	}{
+		{
+			name:    "identical",
+			current: `{"title":{"type":"text","fields":{"raw":{"type":"keyword"}}}}`,
+			desired: `{"title":{"type":"text","fields":{"raw":{"type":"keyword"}}}}`,
+		},
+		{
+			name:          "added multi-field",
+			current:       `{"title":{"type":"text"}}`,
+			desired:       `{"title":{"type":"text","fields":{"raw":{"type":"keyword"}}}}`,
+			wantAdditions: []string{"added multi-field title.raw"},
+		},
+		{
+			name:         "changed multi-field",
+			current:      `{"title":{"type":"text","fields":{"raw":{"type":"keyword"}}}}`,
+			desired:      `{"title":{"type":"text","fields":{"raw":{"type":"keyword","ignore_above":256}}}}`,
+			wantBreaking: []string{"changed multi-field title.raw"},
+		},
+		{
+			name:         "removed multi-field",
+			current:      `{"title":{"type":"text","fields":{"raw":{"type":"keyword"}}}}`,
+			desired:      `{"title":{"type":"text","fields":{}}}`,
+			wantBreaking: []string{"removed multi-field title.raw"},
+		},
+		{
+			name:          "added copy_to target",
+			current:       `{"title":{"type":"text","copy_to":"all"}}`,
+			desired:       `{"title":{"type":"text","copy_to":["all","suggest"]}}`,
+			wantAdditions: []string{"added copy_to target suggest to title"},
+		},
+		{
+			name:         "removed copy_to target",
+			current:      `{"title":{"type":"text","copy_to":["all","suggest"]}}`,
+			desired:      `{"title":{"type":"text","copy_to":["all"]}}`,
+			wantBreaking: []string{"removed copy_to target suggest from title"},
+		},
+		{
+			name:         "changed type",
+			current:      `{"price":{"type":"keyword"}}`,
+			desired:      `{"price":{"type":"float"}}`,
+			wantBreaking: []string{"changed type of price from keyword to float"},
+		},
+		{
+			name:         "added parameter",
+			current:      `{"title":{"type":"text"}}`,
+			desired:      `{"title":{"type":"text","analyzer":"english"}}`,
+			wantBreaking: []string{"changed analyzer of title from <nil> to english"},
+		},
+		{
+			name:         "removed parameter",
+			current:      `{"title":{"type":"text","analyzer":"english"}}`,
+			desired:      `{"title":{"type":"text"}}`,
+			wantBreaking: []string{"removed analyzer from title"},
+		},
+		{
+			name:          "added field",
+			current:       `{"title":{"type":"text"}}`,
+			desired:       `{"title":{"type":"text"},"price":{"type":"float"}}`,
+			wantAdditions: []string{"added field price"},
+		},
+		{
+			name:          "added object field",
+			current:       `{"title":{"type":"text"}}`,
+			desired:       `{"title":{"type":"text"},"dimensions":{"properties":{"width":{"type":"float"}}}}`,
+			wantAdditions: []string{"added field dimensions"},
+		},
+		{
+			name:          "added child of an object",
+			current:       `{"dimensions":{"properties":{"width":{"type":"float"}}}}`,
+			desired:       `{"dimensions":{"properties":{"height":{"type":"float"},"width":{"type":"float"}}}}`,
+			wantAdditions: []string{"added field dimensions.height"},
+		},
+		{
+			name:         "removed field",
+			current:      `{"title":{"type":"text"}}`,
+			desired:      `{}`,
+			wantBreaking: []string{"removed field title"},
+		},
+		{
+			name:          "changes inside an object",
+			current:       `{"author":{"properties":{"name":{"type":"text"},"age":{"type":"integer"}}}}`,
+			desired:       `{"author":{"properties":{"name":{"type":"text","fields":{"raw":{"type":"keyword"}}},"age":{"type":"long"}}}}`,
+			wantAdditions: []string{"added multi-field author.name.raw"},
+			wantBreaking:  []string{"changed type of author.age from integer to long"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var current, desired map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.current), &current); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.desired), &desired); err != nil {
+				t.Fatal(err)
+			}
+
+			diff := diffProperties("", current, desired)
+			if !reflect.DeepEqual(diff.Additions, tt.wantAdditions) {
+				t.Errorf("additions = %q, want %q", diff.Additions, tt.wantAdditions)
+			}
+			if !reflect.DeepEqual(diff.Breaking, tt.wantBreaking) {
+				t.Errorf("breaking = %q, want %q", diff.Breaking, tt.wantBreaking)
+			}
+		})
+	}
+}
+
+func TestRemapNewFields(t *testing.T) {
+	const current = `{"products_v1":{"mappings":{"_meta":{"declared_schema":true},"properties":{
+		"title":{"type":"text"},
+		"dimensions":{"properties":{"width":{"type":"float","index":false,"doc_values":false}}},
+		"price":{"type":"float","index":false,"doc_values":false}
+	}}}}`
+	tests := []struct {
+		name          string
+		settings      models.IndexSettings
+		fields        map[string]models.FieldSchema
+		wantAdditions []string
+		wantBreaking  []string
+		wantInvalid   []string
+	}{
+		{
+			name:          "new field",
+			settings:      models.IndexSettings{SearchableAttributes: []string{"title", "brand"}},
+			fields:        map[string]models.FieldSchema{"brand": {Type: "text"}},
+			wantAdditions: []string{"added field brand"},
+		},
+		{
+			name:          "new child of an object",
+			settings:      models.IndexSettings{SearchableAttributes: []string{"title"}, FacetAttributes: []string{"dimensions.height"}},
+			fields:        map[string]models.FieldSchema{"dimensions.height": {Type: "float"}},
+			wantAdditions: []string{"added field dimensions.height"},
+		},
+		{
+			name:          "new object",
+			settings:      models.IndexSettings{SearchableAttributes: []string{"title"}},
+			fields:        map[string]models.FieldSchema{"seller": {Type: "object"}, "seller.name": {Type: "keyword", Sortable: true}},
+			wantAdditions: []string{"added field seller"},
+		},
+		{
+			name:          "new field next to a breaking change",
+			settings:      models.IndexSettings{SearchableAttributes: []string{"title", "brand"}, FacetAttributes: []string{"price"}},
+			fields:        map[string]models.FieldSchema{"brand": {Type: "text"}},
+			wantAdditions: []string{"added field brand"},
+			wantBreaking:  []string{"removed doc_values from price", "removed index from price"},
+		},
+		{
+			name:        "field already mapped",
+			settings:    models.IndexSettings{SearchableAttributes: []string{"title"}},
+			fields:      map[string]models.FieldSchema{"price": {Type: "float"}},
+			wantInvalid: []string{"price"},
+		},
+		{
+			name:        "field below a leaf",
+			settings:    models.IndexSettings{SearchableAttributes: []string{"title"}},
+			fields:      map[string]models.FieldSchema{"title.raw": {Type: "keyword"}},
+			wantInvalid: []string{"title.raw"},
+		},
+		{
+			name:        "unsupported type",
+			settings:    models.IndexSettings{SearchableAttributes: []string{"title"}},
+			fields:      map[string]models.FieldSchema{"location": {Type: "geo_point"}},
+			wantInvalid: []string{"location"},
+		},
+		{
+			name:        "attribute naming a new object",
+			settings:    models.IndexSettings{SearchableAttributes: []string{"title", "seller"}},
+			fields:      map[string]models.FieldSchema{"seller": {Type: "object"}},
+			wantInvalid: []string{"seller"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mapping map[string]interface{}
+			if err := json.Unmarshal([]byte(current), &mapping); err != nil {
+				t.Fatal(err)
+			}
+
+			err := validateNewFields("products_v1", mapping, tt.fields)
+			if err == nil {
+				err = validateSettingsFields("products_v1", mapping, tt.settings, tt.fields)
+			}
+			if tt.wantInvalid != nil {
+				var serviceErr *Error
+				if !errors.As(err, &serviceErr) {
+					t.Fatalf("err = %v, want invalid fields %q", err, tt.wantInvalid)
+				}
+				var got []string
+				for _, field := range serviceErr.Fields {
+					got = append(got, field.Field)
+				}
+				if !reflect.DeepEqual(got, tt.wantInvalid) {
+					t.Errorf("invalid fields = %q, want %q", got, tt.wantInvalid)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var desired map[string]interface{}
+			remapped := remappedProperties("products_v1", mapping, tt.settings, tt.fields)
+			if err := json.Unmarshal([]byte(marshalToJSONString(remapped)), &desired); err != nil {
+				t.Fatal(err)
+			}
+			currentProperties := mapping["products_v1"].(map[string]interface{})["mappings"].(map[string]interface{})["properties"].(map[string]interface{})
+			diff := diffProperties("", currentProperties, desired)
+			if !reflect.DeepEqual(diff.Additions, tt.wantAdditions) {
+				t.Errorf("additions = %q, want %q", diff.Additions, tt.wantAdditions)
+			}
+			if !reflect.DeepEqual(diff.Breaking, tt.wantBreaking) {
+				t.Errorf("breaking = %q, want %q", diff.Breaking, tt.wantBreaking)
+			}
+		})
+	}
+}
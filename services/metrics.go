@@ -0,0 +1,63 @@
+package services
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collectors exposes client state that is read when metrics are scraped:
+// the mapping cache, migrations waiting on replays and the resilience layer.
+func (es *ElasticsearchClient) Collectors() []prometheus.Collector {
+	const namespace = "config_service"
+	counter := func(name, help string, labels prometheus.Labels, fn func() uint64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace, Name: name, Help: help, ConstLabels: labels,
+		}, func() float64 { return float64(fn()) })
+	}
+	gauge := func(name, help string, fn func() float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace, Name: name, Help: help,
+		}, fn)
+	}
+
+	return []prometheus.Collector{
+		counter("mapping_cache_hits_total", "Mapping lookups served from the cache.", nil, func() uint64 {
+			hits, _ := es.mappings.Stats()
+			return hits
+		}),
+		counter("mapping_cache_misses_total", "Mapping lookups that loaded the mapping.", nil, func() uint64 {
+			_, misses := es.mappings.Stats()
+			return misses
+		}),
+		gauge("mapping_cache_hit_ratio", "Share of mapping lookups served from the cache since startup.", func() float64 {
+			hits, misses := es.mappings.Stats()
+			if hits+misses == 0 {
+				return 0
+			}
+			return float64(hits) / float64(hits+misses)
+		}),
+		gauge("migrations_in_progress", "Reindex migrations currently running.", func() float64 {
+			running, _ := es.migrations.depth()
+			return float64(running)
+		}),
+		gauge("migration_journal_depth", "Journaled document IDs waiting to be replayed into a new index.", func() float64 {
+			_, journaled := es.migrations.depth()
+			return float64(journaled)
+		}),
+		counter("elasticsearch_retries_total", "Retried Elasticsearch requests by reason.", prometheus.Labels{"reason": "rate_limited"},
+			es.transport.retriesRateLimited.Load),
+		counter("elasticsearch_retries_total", "Retried Elasticsearch requests by reason.", prometheus.Labels{"reason": "unavailable"},
+			es.transport.retriesUnavailable.Load),
+		counter("elasticsearch_retries_total", "Retried Elasticsearch requests by reason.", prometheus.Labels{"reason": "connection"},
+			es.transport.retriesConnection.Load),
+		counter("elasticsearch_retries_exhausted_total", "Elasticsearch requests that failed after every retry.", nil,
+			es.transport.retriesExhausted.Load),
+		counter("elasticsearch_short_circuited_total", "Requests failed fast by the open circuit breaker.", nil,
+			es.transport.shortCircuited.Load),
+		gauge("elasticsearch_circuit_open", "1 while the circuit breaker rejects requests.", func() float64 {
+			if es.transport.stats().CircuitState == CircuitOpen {
+				return 1
+			}
+			return 0
+		}),
+	}
+}
@@ -0,0 +1,791 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"elastic-search-config-service/metrics"
+	"elastic-search-config-service/models"
+	"elastic-search-config-service/store"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+const (
+	// catchUpBatchSize bounds the number of document IDs replayed per bulk request.
+	catchUpBatchSize = 500
+	// catchUpRounds is how many replay rounds run while writes are still
+	// flowing before the final, write-blocking round.
+	catchUpRounds = 3
+	// leaseCacheTTL bounds how long a replica trusts what it last read about
+	// the migration lease of an index.
+	leaseCacheTTL = 500 * time.Millisecond
+	// leaseNotice is how long a migration waits after taking its lease before
+	// it starts copying, so that every replica journals writes by then.
+	leaseNotice = 2 * leaseCacheTTL
+	// leaseHeartbeat is how often a running migration refreshes its lease.
+	leaseHeartbeat = 10 * time.Second
+	// leaseExpiry is how long a lease survives without a heartbeat before
+	// its migration is considered dead and the index may be migrated again.
+	leaseExpiry = time.Minute
+	// cutoverSettle is how long the cutover waits, with writes blocked in
+	// Elasticsearch, for replicas to journal writes that finished just before.
+	cutoverSettle = 2 * time.Second
+)
+
+// migrationTracker coordinates document writes with mapping migrations
+// across every replica sharing the config store.
+//
+// A migration holds a lease on its logical index in the config store. While
+// the lease exists its write alias keeps pointing to the old generation and
+// every replica journals the IDs of the documents it writes or deletes in the
+// config store, one record per write request, before the write when it already knows about the lease and
+// after it otherwise. Once the reindex finishes the journaled IDs are
+// replayed from the old generation into the new one. The final replay runs
+// with writes to the old generation blocked in Elasticsearch, so the aliases
+// only flip once both generations agree.
+type migrationTracker struct {
+	store store.ConfigStore
+	// owner identifies this process in the leases it takes.
+	owner string
+
+	mu        sync.Mutex
+	gates     map[string]*sync.RWMutex
+	leases    map[string]cachedLease
+	tasks     map[string]*migrationTask
+	journaled map[string]int
+}
+
+// migrationLease is stored under the logical index name while a migration
+// of that index runs.
+type migrationLease struct {
+	Source      string    `json:"source"`
+	Target      string    `json:"target"`
+	Owner       string    `json:"owner"`
+	StartedAt   time.Time `json:"started_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+	// Tainted says why the migration can no longer account for every write,
+	// e.g. because documents were changed by query while it ran.
+	Tainted string `json:"tainted,omitempty"`
+}
+
+func (l migrationLease) expired(now time.Time) bool {
+	return now.Sub(l.HeartbeatAt) > leaseExpiry
+}
+
+type cachedLease struct {
+	active    bool
+	fetchedAt time.Time
+}
+
+// migrationTask is a migration run by this process.
+type migrationTask struct {
+	source    string
+	target    string
+	startedAt time.Time
+	// stopHeartbeat ends the goroutine keeping the lease alive.
+	stopHeartbeat context.CancelFunc
+}
+
+func newMigrationTracker() *migrationTracker {
+	owner, _ := os.Hostname()
+	if suffix, err := randomToken(4, hex.EncodeToString); err == nil {
+		owner += "-" + suffix
+	}
+	return &migrationTracker{
+		owner:     owner,
+		gates:     make(map[string]*sync.RWMutex),
+		leases:    make(map[string]cachedLease),
+		tasks:     make(map[string]*migrationTask),
+		journaled: make(map[string]int),
+	}
+}
+
+func (t *migrationTracker) gate(index string) *sync.RWMutex {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	g, ok := t.gates[index]
+	if !ok {
+		g = &sync.RWMutex{}
+		t.gates[index] = g
+	}
+	return g
+}
+
+// journalEntry is the journal record of one write request, stored under
+// journalKey.
+type journalEntry struct {
+	IDs []string `json:"ids"`
+}
+
+// journalKey names the journal record of a write request to index. Keys of
+// the same index share the index name and a slash as prefix.
+func journalKey(index, entry string) string {
+	return index + "/" + entry
+}
+
+// readLease returns the lease of index as stored right now, with its record
+// version, or store.ErrNotFound.
+func (t *migrationTracker) readLease(ctx context.Context, index string) (migrationLease, int64, error) {
+	rec, err := t.store.Get(ctx, store.CollectionMigrationLeases, index)
+	if err != nil {
+		return migrationLease{}, 0, err
+	}
+	var lease migrationLease
+	if err := json.Unmarshal(rec.Value, &lease); err != nil {
+		return migrationLease{}, 0, fmt.Errorf("error decoding migration lease of %s: %w", index, err)
+	}
+	t.cacheLease(index, true)
+	return lease, rec.Version, nil
+}
+
+func (t *migrationTracker) cacheLease(index string, active bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.leases[index] = cachedLease{active: active, fetchedAt: time.Now()}
+}
+
+// leaseActive reports whether a migration of index holds a lease, reading the
+// config store at most once per leaseCacheTTL.
+func (t *migrationTracker) leaseActive(ctx context.Context, index string) (bool, error) {
+	t.mu.Lock()
+	cached, ok := t.leases[index]
+	t.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < leaseCacheTTL {
+		return cached.active, nil
+	}
+	_, _, err := t.readLease(ctx, index)
+	if errors.Is(err, store.ErrNotFound) {
+		t.cacheLease(index, false)
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// beginWrite must wrap every write of the documents ids to a logical index.
+// It waits while a migration run by this process is cutting over and
+// journals ids if a migration is known to run. The returned function must be
+// called once the write finished: it journals ids if a migration started in
+// the meantime and releases the gate.
+func (t *migrationTracker) beginWrite(ctx context.Context, index string, ids ...string) (func(), error) {
+	g := t.gate(index)
+	g.RLock()
+	journaled, err := t.journalIfActive(ctx, index, ids)
+	if err != nil {
+		g.RUnlock()
+		return nil, fmt.Errorf("error journaling write to %s: %w", index, err)
+	}
+	return func() {
+		defer g.RUnlock()
+		if journaled {
+			return
+		}
+		ctx := context.WithoutCancel(ctx)
+		if _, err := t.journalIfActive(ctx, index, ids); err != nil {
+			slog.ErrorContext(ctx, "error journaling write during migration", "index", index, "error", err)
+			t.taint(ctx, index, "a write could not be journaled")
+		}
+	}, nil
+}
+
+// beginQueryWrite must wrap writes to a logical index whose document IDs are
+// not known up front. They are refused while a migration runs, and a
+// migration starting before they finish is tainted.
+func (t *migrationTracker) beginQueryWrite(ctx context.Context, index string) (func(), error) {
+	g := t.gate(index)
+	g.RLock()
+	_, _, err := t.readLease(ctx, index)
+	if err == nil {
+		g.RUnlock()
+		return nil, &Error{Kind: ErrConflict, Message: "a migration is running for index " + index}
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		g.RUnlock()
+		return nil, err
+	}
+	t.cacheLease(index, false)
+	return func() {
+		defer g.RUnlock()
+		t.taint(context.WithoutCancel(ctx), index, "documents were changed by query")
+	}, nil
+}
+
+func (t *migrationTracker) journalIfActive(ctx context.Context, index string, ids []string) (bool, error) {
+	active, err := t.leaseActive(ctx, index)
+	if err != nil || !active {
+		return false, err
+	}
+	if len(ids) == 0 {
+		return true, nil
+	}
+	entry, err := randomToken(12, hex.EncodeToString)
+	if err != nil {
+		return false, err
+	}
+	data, err := json.Marshal(journalEntry{IDs: ids})
+	if err != nil {
+		return false, err
+	}
+	if _, err := t.store.Put(ctx, store.CollectionMigrationJournal, journalKey(index, entry), data, 0); err != nil {
+		return false, err
+	}
+	t.mu.Lock()
+	t.journaled[index] += len(ids)
+	t.mu.Unlock()
+	return true, nil
+}
+
+// start takes the migration lease of index for reindexing source into
+// target, then waits until every replica journals its writes. A lease left
+// behind by a migration that stopped sending heartbeats is taken over; the
+// target of that migration is returned so that the caller can drop it.
+func (t *migrationTracker) start(ctx context.Context, index, source, target string) (abandoned string, err error) {
+	now := time.Now()
+	data, err := json.Marshal(migrationLease{
+		Source:      source,
+		Target:      target,
+		Owner:       t.owner,
+		StartedAt:   now,
+		HeartbeatAt: now,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	_, err = t.store.Put(ctx, store.CollectionMigrationLeases, index, data, 0)
+	if errors.Is(err, store.ErrVersionConflict) {
+		current, version, readErr := t.readLease(ctx, index)
+		switch {
+		case errors.Is(readErr, store.ErrNotFound):
+			_, err = t.store.Put(ctx, store.CollectionMigrationLeases, index, data, 0)
+		case readErr != nil:
+			return "", readErr
+		case !current.expired(now):
+			return "", &Error{Kind: ErrConflict, Message: "a migration is already running for index " + index}
+		default:
+			slog.WarnContext(ctx, "taking over expired migration lease", "index", index, "owner", current.Owner, "target", current.Target)
+			abandoned = current.Target
+			_, err = t.store.Put(ctx, store.CollectionMigrationLeases, index, data, version)
+		}
+	}
+	if errors.Is(err, store.ErrVersionConflict) {
+		return "", &Error{Kind: ErrConflict, Message: "a migration is already running for index " + index}
+	}
+	if err != nil {
+		return "", fmt.Errorf("error taking migration lease of %s: %w", index, err)
+	}
+	t.cacheLease(index, true)
+
+	// Entries left by an abandoned migration must not be replayed into ours
+	if _, err := t.drain(ctx, index); err != nil {
+		t.stop(context.WithoutCancel(ctx), index)
+		return "", err
+	}
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(context.WithoutCancel(ctx))
+	t.mu.Lock()
+	t.tasks[index] = &migrationTask{source: source, target: target, startedAt: now, stopHeartbeat: stopHeartbeat}
+	t.mu.Unlock()
+	go t.heartbeat(heartbeatCtx, index)
+
+	select {
+	case <-time.After(leaseNotice):
+	case <-ctx.Done():
+		t.stop(context.WithoutCancel(ctx), index)
+		return "", ctx.Err()
+	}
+	return abandoned, nil
+}
+
+func (t *migrationTracker) heartbeat(ctx context.Context, index string) {
+	ticker := time.NewTicker(leaseHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		_, err := store.Update(ctx, t.store, store.CollectionMigrationLeases, index, func(current []byte) ([]byte, error) {
+			var lease migrationLease
+			if current == nil || json.Unmarshal(current, &lease) != nil || lease.Owner != t.owner {
+				return nil, errLeaseLost
+			}
+			lease.HeartbeatAt = time.Now()
+			return json.Marshal(lease)
+		})
+		if errors.Is(err, errLeaseLost) {
+			slog.WarnContext(ctx, "migration lease was taken over", "index", index)
+			return
+		}
+		if err != nil && ctx.Err() == nil {
+			slog.WarnContext(ctx, "error refreshing migration lease", "index", index, "error", err)
+		}
+	}
+}
+
+var errLeaseLost = errors.New("migration lease was lost")
+
+// taint marks a running migration of index, if there is one, as unable to
+// account for every write, which makes it fail at cutover.
+func (t *migrationTracker) taint(ctx context.Context, index, reason string) {
+	_, err := store.Update(ctx, t.store, store.CollectionMigrationLeases, index, func(current []byte) ([]byte, error) {
+		if current == nil {
+			return nil, store.ErrNotFound
+		}
+		var lease migrationLease
+		if err := json.Unmarshal(current, &lease); err != nil {
+			return nil, err
+		}
+		lease.Tainted = reason
+		return json.Marshal(lease)
+	})
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		slog.ErrorContext(ctx, "error marking migration as incomplete", "index", index, "reason", reason, "error", err)
+	}
+}
+
+// verify fails unless the lease of index is still held by this process and
+// no write escaped the journal.
+func (t *migrationTracker) verify(ctx context.Context, index string) error {
+	lease, _, err := t.readLease(ctx, index)
+	switch {
+	case errors.Is(err, store.ErrNotFound) || (err == nil && lease.Owner != t.owner):
+		return &Error{Kind: ErrConflict, Message: "the migration lease of index " + index + " was lost"}
+	case err != nil:
+		return err
+	case lease.Tainted != "":
+		return &Error{Kind: ErrConflict, Message: "migration of index " + index + " abandoned: " + lease.Tainted}
+	}
+	return nil
+}
+
+// drain returns the IDs journaled so far and removes them from the journal.
+// Writes made after an ID is removed journal it again.
+func (t *migrationTracker) drain(ctx context.Context, index string) ([]string, error) {
+	records, err := t.journal(ctx, index)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := journaledIDs(index, records)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		err := t.store.Delete(ctx, store.CollectionMigrationJournal, rec.Key, rec.Version)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return nil, fmt.Errorf("error draining migration journal of %s: %w", index, err)
+		}
+	}
+	t.mu.Lock()
+	t.journaled[index] = 0
+	t.mu.Unlock()
+	return ids, nil
+}
+
+// journal lists the journal records of index.
+func (t *migrationTracker) journal(ctx context.Context, index string) ([]store.Record, error) {
+	records, err := t.store.ListPrefix(ctx, store.CollectionMigrationJournal, journalKey(index, ""))
+	if err != nil {
+		return nil, fmt.Errorf("error reading migration journal of %s: %w", index, err)
+	}
+	return records, nil
+}
+
+// journaledIDs returns the sorted, distinct document IDs of journal records.
+func journaledIDs(index string, records []store.Record) ([]string, error) {
+	seen := make(map[string]struct{})
+	ids := []string{}
+	for _, rec := range records {
+		var entry journalEntry
+		if err := json.Unmarshal(rec.Value, &entry); err != nil {
+			return nil, fmt.Errorf("error decoding migration journal of %s: %w", index, err)
+		}
+		for _, id := range entry.IDs {
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// active reports whether a migration of index is running on any replica.
+func (t *migrationTracker) active(ctx context.Context, index string) bool {
+	active, err := t.leaseActive(ctx, index)
+	return err == nil && active
+}
+
+// depth returns how many migrations this process runs and how many document
+// IDs it journaled that are waiting to be replayed.
+func (t *migrationTracker) depth() (running, journaled int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, n := range t.journaled {
+		journaled += n
+	}
+	return len(t.tasks), journaled
+}
+
+// unfinished returns the state of every migration run by this process, with
+// the IDs journaled but not replayed yet.
+func (t *migrationTracker) unfinished(ctx context.Context) []models.InterruptedMigration {
+	t.mu.Lock()
+	tasks := make(map[string]migrationTask, len(t.tasks))
+	for index, task := range t.tasks {
+		tasks[index] = *task
+	}
+	t.mu.Unlock()
+
+	now := time.Now()
+	migrations := make([]models.InterruptedMigration, 0, len(tasks))
+	for index, task := range tasks {
+		ids := []string{}
+		records, err := t.journal(ctx, index)
+		if err == nil {
+			ids, err = journaledIDs(index, records)
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "error reading journal of unfinished migration", "index", index, "error", err)
+		}
+		migrations = append(migrations, models.InterruptedMigration{
+			IndexName:     index,
+			SourceIndex:   task.source,
+			TargetIndex:   task.target,
+			StartedAt:     task.startedAt,
+			InterruptedAt: now,
+			JournaledIDs:  ids,
+		})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].IndexName < migrations[j].IndexName })
+	return migrations
+}
+
+// stop releases the lease of index, if this process holds it, and clears
+// the journal.
+func (t *migrationTracker) stop(ctx context.Context, index string) {
+	t.mu.Lock()
+	task, ok := t.tasks[index]
+	delete(t.tasks, index)
+	delete(t.journaled, index)
+	delete(t.leases, index)
+	t.mu.Unlock()
+	if ok {
+		task.stopHeartbeat()
+	}
+
+	lease, version, err := t.readLease(ctx, index)
+	if err == nil && lease.Owner == t.owner {
+		err = t.store.Delete(ctx, store.CollectionMigrationLeases, index, version)
+		if err == nil {
+			_, err = t.drain(ctx, index)
+		}
+	}
+	t.cacheLease(index, false)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		slog.WarnContext(ctx, "error releasing migration lease", "index", index, "error", err)
+	}
+}
+
+// abandon gives up the lease this process holds on index as it shuts down
+// with the migration unfinished, so that the next start of any replica can
+// clean up after it without waiting for the lease to expire.
+func (t *migrationTracker) abandon(ctx context.Context, index string) error {
+	_, err := store.Update(ctx, t.store, store.CollectionMigrationLeases, index, func(current []byte) ([]byte, error) {
+		var lease migrationLease
+		if current == nil || json.Unmarshal(current, &lease) != nil || lease.Owner != t.owner {
+			return nil, errLeaseLost
+		}
+		lease.HeartbeatAt = time.Time{}
+		return json.Marshal(lease)
+	})
+	if errors.Is(err, errLeaseLost) {
+		return nil
+	}
+	return err
+}
+
+// expiredLeases returns the leases whose migration stopped sending
+// heartbeats, with their record versions, and the indices whose migration
+// is still alive.
+func (t *migrationTracker) expiredLeases(ctx context.Context) (expired map[string]store.Record, live map[string]struct{}, err error) {
+	records, err := t.store.List(ctx, store.CollectionMigrationLeases)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing migration leases: %w", err)
+	}
+	now := time.Now()
+	expired = make(map[string]store.Record)
+	live = make(map[string]struct{})
+	for _, rec := range records {
+		var lease migrationLease
+		if err := json.Unmarshal(rec.Value, &lease); err != nil {
+			return nil, nil, fmt.Errorf("error decoding migration lease of %s: %w", rec.Key, err)
+		}
+		if lease.expired(now) {
+			expired[rec.Key] = rec
+		} else {
+			live[rec.Key] = struct{}{}
+		}
+	}
+	return expired, live, nil
+}
+
+// clear removes an expired lease, read at the given record, and the journal
+// of its migration.
+func (t *migrationTracker) clear(ctx context.Context, index string, version int64) error {
+	if err := t.store.Delete(ctx, store.CollectionMigrationLeases, index, version); err != nil {
+		return err
+	}
+	t.cacheLease(index, false)
+	_, err := t.drain(ctx, index)
+	return err
+}
+
+// blockWrites makes index read-only in Elasticsearch, for every replica at
+// once. It returns once writes already accepted have completed.
+func (es *ElasticsearchClient) blockWrites(ctx context.Context, index string) error {
+	req := esapi.IndicesAddBlockRequest{
+		Index: []string{index},
+		Block: "write",
+	}
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		return transportError("error blocking writes", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return responseError("error blocking writes", res)
+	}
+	return nil
+}
+
+// unblockWrites lifts the block set by blockWrites.
+func (es *ElasticsearchClient) unblockWrites(ctx context.Context, index string) {
+	req := esapi.IndicesPutSettingsRequest{
+		Index: []string{index},
+		Body:  strings.NewReader(`{"index.blocks.write": null}`),
+	}
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		slog.ErrorContext(ctx, "error lifting write block", "index", index, "error", err)
+		return
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		slog.ErrorContext(ctx, "error lifting write block", "index", index, "error", responseError("", res))
+	}
+}
+
+// nextGeneration names the physical index a migration of ind creates:
+// <name>_v<N>, one past the highest generation found in the cluster, so an
+// index left behind by an earlier migration never stands in the way.
+func (es *ElasticsearchClient) nextGeneration(ctx context.Context, ind models.IndexInfo) (string, error) {
+	req := esapi.CatIndicesRequest{
+		Index:  []string{ind.IndexName + "_v*"},
+		Format: "json",
+		H:      []string{"index"},
+	}
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		return "", transportError("error listing index generations", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
+		return "", responseError("error listing index generations", res)
+	}
+
+	var rows []struct {
+		Index string `json:"index"`
+	}
+	if res.StatusCode != http.StatusNotFound {
+		if err := json.NewDecoder(res.Body).Decode(&rows); err != nil {
+			return "", err
+		}
+	}
+	// The index created by POST /index is the first generation.
+	highest := 1
+	for _, row := range rows {
+		if n, ok := generationNumber(ind.IndexName, row.Index); ok && n > highest {
+			highest = n
+		}
+	}
+	return fmt.Sprintf("%s_v%d", ind.IndexName, highest+1), nil
+}
+
+// generationNumber returns N for a physical index named <name>_v<N>.
+func generationNumber(name, index string) (int, bool) {
+	suffix, ok := strings.CutPrefix(index, name+"_v")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(suffix)
+	return n, err == nil && n > 0
+}
+
+// dropUnusedGeneration deletes a physical index created by a migration that
+// did not complete. An index that carries any alias is in use and kept.
+func (es *ElasticsearchClient) dropUnusedGeneration(ctx context.Context, index string) {
+	aliasReq := esapi.IndicesGetAliasRequest{
+		Index: []string{index},
+	}
+	aliasRes, err := aliasReq.Do(ctx, es.transport)
+	if err != nil {
+		slog.WarnContext(ctx, "error checking aliases of abandoned index", "index", index, "error", err)
+		return
+	}
+	defer aliasRes.Body.Close()
+	if aliasRes.StatusCode == http.StatusNotFound {
+		return
+	}
+	if aliasRes.IsError() {
+		slog.WarnContext(ctx, "error checking aliases of abandoned index", "index", index, "error", responseError("", aliasRes))
+		return
+	}
+	var aliasResponse map[string]struct {
+		Aliases map[string]json.RawMessage `json:"aliases"`
+	}
+	if err := json.NewDecoder(aliasRes.Body).Decode(&aliasResponse); err != nil {
+		slog.WarnContext(ctx, "error checking aliases of abandoned index", "index", index, "error", err)
+		return
+	}
+	if len(aliasResponse[index].Aliases) > 0 {
+		return
+	}
+
+	deleteReq := esapi.IndicesDeleteRequest{
+		Index: []string{index},
+	}
+	deleteRes, err := deleteReq.Do(ctx, es.transport)
+	if err != nil {
+		slog.WarnContext(ctx, "error deleting abandoned index", "index", index, "error", err)
+		return
+	}
+	defer deleteRes.Body.Close()
+	if deleteRes.IsError() && deleteRes.StatusCode != http.StatusNotFound {
+		slog.WarnContext(ctx, "error deleting abandoned index", "index", index, "error", responseError("", deleteRes))
+		return
+	}
+	slog.InfoContext(ctx, "deleted index of failed migration", "index", index)
+}
+
+// replayDocuments copies the current state of ids from source into target:
+// documents still present are indexed with their source version, documents
+// gone from source are deleted from target. It returns how many documents it
+// replayed.
+func (es *ElasticsearchClient) replayDocuments(ctx context.Context, source, target string, ids []string) (int64, error) {
+	var replayed int64
+	for start := 0; start < len(ids); start += catchUpBatchSize {
+		end := start + catchUpBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		n, err := es.replayBatch(ctx, source, target, ids[start:end])
+		replayed += n
+		if err != nil {
+			return replayed, err
+		}
+	}
+	return replayed, nil
+}
+
+func (es *ElasticsearchClient) replayBatch(ctx context.Context, source, target string, ids []string) (int64, error) {
+	var mgetBody bytes.Buffer
+	if err := json.NewEncoder(&mgetBody).Encode(map[string]interface{}{"ids": ids}); err != nil {
+		return 0, err
+	}
+	mgetReq := esapi.MgetRequest{
+		Index: source,
+		Body:  &mgetBody,
+	}
+	mgetRes, err := mgetReq.Do(ctx, es.transport)
+	if err != nil {
+		return 0, transportError("error reading journaled documents", err)
+	}
+	defer mgetRes.Body.Close()
+	if mgetRes.IsError() {
+		return 0, responseError("error reading journaled documents", mgetRes)
+	}
+
+	var mgetResponse struct {
+		Docs []struct {
+			ID      string          `json:"_id"`
+			Found   bool            `json:"found"`
+			Version int64           `json:"_version"`
+			Source  json.RawMessage `json:"_source"`
+		} `json:"docs"`
+	}
+	if err := json.NewDecoder(mgetRes.Body).Decode(&mgetResponse); err != nil {
+		return 0, err
+	}
+
+	var bulkBody bytes.Buffer
+	enc := json.NewEncoder(&bulkBody)
+	for _, doc := range mgetResponse.Docs {
+		if !doc.Found {
+			enc.Encode(map[string]interface{}{"delete": map[string]interface{}{"_index": target, "_id": doc.ID}})
+			continue
+		}
+		enc.Encode(map[string]interface{}{"index": map[string]interface{}{
+			"_index":       target,
+			"_id":          doc.ID,
+			"version":      doc.Version,
+			"version_type": "external_gte",
+		}})
+		if err := json.Compact(&bulkBody, doc.Source); err != nil {
+			return 0, err
+		}
+		bulkBody.WriteByte('\n')
+	}
+
+	bulkReq := esapi.BulkRequest{
+		Body:    &bulkBody,
+		Refresh: "true",
+	}
+	bulkRes, err := bulkReq.Do(ctx, es.transport)
+	if err != nil {
+		return 0, transportError("error replaying journaled documents", err)
+	}
+	defer bulkRes.Body.Close()
+	if bulkRes.IsError() {
+		return 0, responseError("error replaying journaled documents", bulkRes)
+	}
+
+	var bulkResponse struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			ID     string          `json:"_id"`
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(bulkRes.Body).Decode(&bulkResponse); err != nil {
+		return 0, err
+	}
+	for i, item := range bulkResponse.Items {
+		for _, result := range item {
+			// A missing document on delete or an equal/newer version already
+			// in the target both mean the target is up to date.
+			if result.Status == http.StatusNotFound || result.Status == http.StatusConflict || result.Status < 300 {
+				continue
+			}
+			metrics.CountBulkDocuments("replay", i, 1)
+			return 0, &Error{Kind: ErrUpstreamRejected, Message: fmt.Sprintf("error replaying document %s: %s", result.ID, result.Error)}
+		}
+	}
+	metrics.CountBulkDocuments("replay", len(bulkResponse.Items), 0)
+	return int64(len(mgetResponse.Docs)), nil
+}
@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"elastic-search-config-service/store"
+	"elastic-search-config-service/store/storetest"
+)
+
+// configStores builds each config store backend the migration tracker is
+// tested against.
+var configStores = map[string]func(t *testing.T) store.ConfigStore{
+	"file": func(t *testing.T) store.ConfigStore {
+		return store.NewFileStore(filepath.Join(t.TempDir(), "config.json"))
+	},
+	"elasticsearch": func(t *testing.T) store.ConfigStore {
+		s, err := store.NewElasticsearchStore(context.Background(), storetest.NewElasticsearch(), store.DefaultConfigIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	},
+}
+
+// newReplicaTrackers returns two trackers sharing a config store, as two
+// replicas of the service would.
+func newReplicaTrackers(t *testing.T, backend string) (a, b *migrationTracker) {
+	t.Helper()
+	s := configStores[backend](t)
+	a, b = newMigrationTracker(), newMigrationTracker()
+	a.store, b.store = s, s
+	return a, b
+}
+
+func TestMigrationJournal(t *testing.T) {
+	tests := []struct {
+		name string
+		// migrate starts a migration of products on the first replica.
+		migrate bool
+		// before are writes that finish before the migration starts,
+		// spanning writes finish after it started and during writes start
+		// once it runs.
+		before, spanning, during [][]string
+		// otherIndex are writes to another index while the migration runs.
+		otherIndex  [][]string
+		wantJournal []string
+		// wantRecords is how many journal records hold wantJournal: one
+		// per write request, however many documents it wrote.
+		wantRecords int
+	}{
+		{
+			name:        "no migration",
+			during:      [][]string{{"1", "2"}},
+			wantJournal: []string{},
+		},
+		{
+			name:        "writes during the migration",
+			migrate:     true,
+			during:      [][]string{{"2", "1"}, {"3"}},
+			wantJournal: []string{"1", "2", "3"},
+			wantRecords: 2,
+		},
+		{
+			name:        "document written twice",
+			migrate:     true,
+			during:      [][]string{{"1"}, {"1", "2"}},
+			wantJournal: []string{"1", "2"},
+			wantRecords: 2,
+		},
+		{
+			name:        "write that began before the migration",
+			migrate:     true,
+			spanning:    [][]string{{"1"}},
+			during:      [][]string{{"2"}},
+			wantJournal: []string{"1", "2"},
+			wantRecords: 2,
+		},
+		{
+			name:        "write that finished before the migration",
+			migrate:     true,
+			before:      [][]string{{"1"}},
+			wantJournal: []string{},
+		},
+		{
+			name:        "writes to another index",
+			migrate:     true,
+			during:      [][]string{{"1"}},
+			otherIndex:  [][]string{{"2"}},
+			wantJournal: []string{"1"},
+			wantRecords: 1,
+		},
+	}
+	for _, tt := range tests {
+		for backend := range configStores {
+			tt, backend := tt, backend
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				t.Parallel()
+				ctx := context.Background()
+				migrator, writer := newReplicaTrackers(t, backend)
+				t.Cleanup(func() { migrator.stop(ctx, "products") })
+
+				write := func(index string, ids []string) {
+					done, err := writer.beginWrite(ctx, index, ids...)
+					if err != nil {
+						t.Fatal(err)
+					}
+					done()
+				}
+				for _, ids := range tt.before {
+					write("products", ids)
+				}
+				var pending []func()
+				for _, ids := range tt.spanning {
+					done, err := writer.beginWrite(ctx, "products", ids...)
+					if err != nil {
+						t.Fatal(err)
+					}
+					pending = append(pending, done)
+				}
+				if tt.migrate {
+					if _, err := migrator.start(ctx, "products", "products_v1", "products_v2"); err != nil {
+						t.Fatal(err)
+					}
+				}
+				for _, done := range pending {
+					done()
+				}
+				for _, ids := range tt.during {
+					write("products", ids)
+				}
+				for _, ids := range tt.otherIndex {
+					write("orders", ids)
+				}
+
+				records, err := migrator.journal(ctx, "products")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(records) != tt.wantRecords {
+					t.Errorf("journal records = %d, want %d", len(records), tt.wantRecords)
+				}
+				got, err := migrator.drain(ctx, "products")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, tt.wantJournal) {
+					t.Errorf("journal = %q, want %q", got, tt.wantJournal)
+				}
+				if again, err := migrator.drain(ctx, "products"); err != nil || len(again) != 0 {
+					t.Errorf("journal after drain = %q, %v, want empty", again, err)
+				}
+			})
+		}
+	}
+}
+
+func TestMigrationDrainPastListCap(t *testing.T) {
+	ctx := context.Background()
+	migrator, writer := newReplicaTrackers(t, "elasticsearch")
+	if _, err := migrator.start(ctx, "products", "products_v1", "products_v2"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { migrator.stop(ctx, "products") })
+
+	// One write request per document, so that the journal holds more records
+	// than a single search of the config index returns.
+	const writes = 10050
+	for i := 0; i < writes; i++ {
+		done, err := writer.beginWrite(ctx, "products", fmt.Sprintf("%05d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		done()
+	}
+	done, err := writer.beginWrite(ctx, "orders", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done()
+
+	ids, err := migrator.drain(ctx, "products")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != writes || ids[0] != "00000" || ids[writes-1] != fmt.Sprintf("%05d", writes-1) {
+		t.Fatalf("drained %d ids from %v to %v, want %d", len(ids), ids[0], ids[len(ids)-1], writes)
+	}
+	if again, err := migrator.drain(ctx, "products"); err != nil || len(again) != 0 {
+		t.Errorf("journal after drain = %d ids, %v, want empty", len(again), err)
+	}
+}
+
+func TestMigrationGate(t *testing.T) {
+	tests := []struct {
+		name string
+		// run acts on two replicas after the first one started a migration
+		// of products and returns the outcome checked against wantKind.
+		run      func(ctx context.Context, t *testing.T, migrator, other *migrationTracker) error
+		wantKind ErrorKind
+		wantErr  bool
+	}{
+		{
+			name: "untouched migration verifies",
+			run: func(ctx context.Context, t *testing.T, migrator, other *migrationTracker) error {
+				return migrator.verify(ctx, "products")
+			},
+		},
+		{
+			name: "second migration of the index",
+			run: func(ctx context.Context, t *testing.T, migrator, other *migrationTracker) error {
+				_, err := other.start(ctx, "products", "products_v1", "products_v3")
+				return err
+			},
+			wantErr:  true,
+			wantKind: ErrConflict,
+		},
+		{
+			name: "write by query during the migration",
+			run: func(ctx context.Context, t *testing.T, migrator, other *migrationTracker) error {
+				_, err := other.beginQueryWrite(ctx, "products")
+				return err
+			},
+			wantErr:  true,
+			wantKind: ErrConflict,
+		},
+		{
+			name: "write by query to another index",
+			run: func(ctx context.Context, t *testing.T, migrator, other *migrationTracker) error {
+				done, err := other.beginQueryWrite(ctx, "orders")
+				if err == nil {
+					done()
+				}
+				return err
+			},
+		},
+		{
+			name: "lease taken over after expiring",
+			run: func(ctx context.Context, t *testing.T, migrator, other *migrationTracker) error {
+				expireLease(ctx, t, migrator.store, "products")
+				abandoned, err := other.start(ctx, "products", "products_v1", "products_v3")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer other.stop(ctx, "products")
+				if abandoned != "products_v2" {
+					t.Errorf("abandoned = %q, want products_v2", abandoned)
+				}
+				return migrator.verify(ctx, "products")
+			},
+			wantErr:  true,
+			wantKind: ErrConflict,
+		},
+		{
+			name: "write that could not be journaled",
+			run: func(ctx context.Context, t *testing.T, migrator, other *migrationTracker) error {
+				other.taint(ctx, "products", "a write could not be journaled")
+				return migrator.verify(ctx, "products")
+			},
+			wantErr:  true,
+			wantKind: ErrConflict,
+		},
+		{
+			name: "cutover holds writes until it ends",
+			run: func(ctx context.Context, t *testing.T, migrator, other *migrationTracker) error {
+				g := migrator.gate("products")
+				g.Lock()
+				started := make(chan struct{})
+				written := make(chan struct{})
+				go func() {
+					close(started)
+					done, err := migrator.beginWrite(ctx, "products", "1")
+					if err == nil {
+						done()
+					}
+					close(written)
+				}()
+				<-started
+				select {
+				case <-written:
+					t.Error("write went through during the cutover")
+				case <-time.After(50 * time.Millisecond):
+				}
+				g.Unlock()
+				<-written
+				ids, err := migrator.drain(ctx, "products")
+				if err == nil && !reflect.DeepEqual(ids, []string{"1"}) {
+					t.Errorf("journal = %q, want [1]", ids)
+				}
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		for backend := range configStores {
+			tt, backend := tt, backend
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				t.Parallel()
+				ctx := context.Background()
+				migrator, other := newReplicaTrackers(t, backend)
+				if _, err := migrator.start(ctx, "products", "products_v1", "products_v2"); err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { migrator.stop(ctx, "products") })
+
+				err := tt.run(ctx, t, migrator, other)
+				if !tt.wantErr {
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					return
+				}
+				if KindOf(err) != tt.wantKind {
+					t.Fatalf("err = %v, want kind %v", err, tt.wantKind)
+				}
+			})
+		}
+	}
+}
+
+// expireLease backdates the heartbeat of the lease of index past leaseExpiry.
+func expireLease(ctx context.Context, t *testing.T, s store.ConfigStore, index string) {
+	t.Helper()
+	_, err := store.Update(ctx, s, store.CollectionMigrationLeases, index, func(current []byte) ([]byte, error) {
+		var lease migrationLease
+		if err := json.Unmarshal(current, &lease); err != nil {
+			return nil, err
+		}
+		lease.HeartbeatAt = time.Now().Add(-2 * leaseExpiry)
+		return json.Marshal(lease)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
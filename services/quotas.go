@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"elastic-search-config-service/store"
+)
+
+// quotaDayFormat names the UTC day a quota counter belongs to.
+const quotaDayFormat = "2006-01-02"
+
+// quotaUsage is the config store record counting the documents a caller
+// wrote to an index on one UTC day.
+type quotaUsage struct {
+	Caller    string `json:"caller"`
+	Index     string `json:"index"`
+	Day       string `json:"day"`
+	Documents int64  `json:"documents"`
+}
+
+// quotaReservationShare is the fraction of a daily quota a replica reserves
+// in the config store at once. Writes are charged against the reservation in
+// memory, so the store is only updated once per reserved block instead of
+// once per write.
+const quotaReservationShare = 20
+
+type quotaState struct {
+	perDay int64
+
+	mu        sync.Mutex
+	prunedDay string
+	// reserved holds, per quota counter key, the documents this process has
+	// reserved in the store and not charged yet.
+	reserved map[string]*quotaReservation
+}
+
+type quotaReservation struct {
+	mu        sync.Mutex
+	remaining int64
+}
+
+// reservation returns the in-memory reservation for a quota counter key.
+func (q *quotaState) reservation(key string) *quotaReservation {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.reserved == nil {
+		q.reserved = make(map[string]*quotaReservation)
+	}
+	r, ok := q.reserved[key]
+	if !ok {
+		r = &quotaReservation{}
+		q.reserved[key] = r
+	}
+	return r
+}
+
+// SetDocumentQuota sets how many documents a caller may write to each index
+// per UTC day. Zero disables the quota unless an API key sets its own.
+func (es *ElasticsearchClient) SetDocumentQuota(perDay int64) {
+	es.quotas.perDay = perDay
+}
+
+// ConsumeDocumentQuota charges n documents written by caller to index
+// against today's quota, refusing with ErrQuotaExceeded when it would be
+// exceeded. Documents are charged before they are written, so failed writes
+// count too. A positive limit overrides the configured quota.
+//
+// Each replica reserves blocks of the quota in the config store and charges
+// writes against its block in memory. Documents reserved but not written when
+// a replica stops or the day ends count as used.
+func (es *ElasticsearchClient) ConsumeDocumentQuota(ctx context.Context, caller, index string, n int, limit int64) error {
+	if limit <= 0 {
+		limit = es.quotas.perDay
+	}
+	if limit <= 0 || n <= 0 {
+		return nil
+	}
+
+	day := time.Now().UTC().Format(quotaDayFormat)
+	es.pruneQuotas(ctx, day)
+	key := day + "/" + caller + "/" + index
+	r := es.quotas.reservation(key)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.remaining >= int64(n) {
+		r.remaining -= int64(n)
+		return nil
+	}
+
+	// Reserve a new block, taking over what is left of the current one so
+	// that the store counter stays an upper bound of the documents written.
+	need := int64(n) - r.remaining
+	block := max(need, limit/quotaReservationShare)
+	var granted int64
+	_, err := store.Update(ctx, es.store, store.CollectionQuotas, key, func(current []byte) ([]byte, error) {
+		usage := quotaUsage{Caller: caller, Index: index, Day: day}
+		if current != nil {
+			if err := json.Unmarshal(current, &usage); err != nil {
+				return nil, err
+			}
+		}
+		available := limit - usage.Documents
+		if available < need {
+			return nil, &Error{Kind: ErrQuotaExceeded, Message: fmt.Sprintf("daily quota of %d documents on index %s used up", limit, index)}
+		}
+		granted = min(block, available)
+		usage.Documents += granted
+		return json.Marshal(usage)
+	})
+	switch {
+	case err == nil:
+		r.remaining += granted - int64(n)
+		return nil
+	case KindOf(err) == ErrQuotaExceeded:
+		return err
+	case errors.Is(err, store.ErrVersionConflict):
+		return &Error{Kind: ErrUpstreamUnavailable, Message: "document quota is being updated concurrently, retry later", Err: err}
+	default:
+		return fmt.Errorf("error updating document quota: %w", err)
+	}
+}
+
+// pruneQuotas drops the counters of earlier days, once per day and process,
+// without delaying the request.
+func (es *ElasticsearchClient) pruneQuotas(ctx context.Context, day string) {
+	es.quotas.mu.Lock()
+	if es.quotas.prunedDay == day {
+		es.quotas.mu.Unlock()
+		return
+	}
+	es.quotas.prunedDay = day
+	for key := range es.quotas.reserved {
+		if recordDay, _, _ := strings.Cut(key, "/"); recordDay < day {
+			delete(es.quotas.reserved, key)
+		}
+	}
+	es.quotas.mu.Unlock()
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		records, err := es.store.List(ctx, store.CollectionQuotas)
+		if err != nil {
+			slog.WarnContext(ctx, "error listing document quotas", "error", err)
+			return
+		}
+		for _, rec := range records {
+			recordDay, _, _ := strings.Cut(rec.Key, "/")
+			if recordDay >= day {
+				continue
+			}
+			if err := es.store.Delete(ctx, store.CollectionQuotas, rec.Key, rec.Version); err != nil {
+				slog.WarnContext(ctx, "error pruning document quota", "key", rec.Key, "error", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"elastic-search-config-service/store"
+)
+
+// countingStore counts the writes made to the wrapped store.
+type countingStore struct {
+	store.ConfigStore
+	puts int
+}
+
+func (s *countingStore) Put(ctx context.Context, collection, key string, value []byte, expectedVersion int64) (int64, error) {
+	s.puts++
+	return s.ConfigStore.Put(ctx, collection, key, value, expectedVersion)
+}
+
+func TestConsumeDocumentQuota(t *testing.T) {
+	type write struct {
+		caller   string
+		docs     int
+		wantKind ErrorKind
+	}
+	tests := []struct {
+		name     string
+		limit    int64
+		writes   []write
+		wantPuts int
+	}{
+		{
+			name:     "writes within a reserved block",
+			limit:    100,
+			writes:   []write{{caller: "key:reader", docs: 1}, {caller: "key:reader", docs: 2}, {caller: "key:reader", docs: 2}},
+			wantPuts: 1,
+		},
+		{
+			name:     "a new block once the first is used",
+			limit:    100,
+			writes:   []write{{caller: "key:reader", docs: 4}, {caller: "key:reader", docs: 4}},
+			wantPuts: 2,
+		},
+		{
+			name:     "a batch larger than a block",
+			limit:    100,
+			writes:   []write{{caller: "key:reader", docs: 30}, {caller: "key:reader", docs: 5}},
+			wantPuts: 2,
+		},
+		{
+			name:     "refused once the quota is used up",
+			limit:    10,
+			writes:   []write{{caller: "key:reader", docs: 6}, {caller: "key:reader", docs: 4}, {caller: "key:reader", docs: 1, wantKind: ErrQuotaExceeded}},
+			wantPuts: 2,
+		},
+		{
+			name:     "refused batch leaves the rest usable",
+			limit:    10,
+			writes:   []write{{caller: "key:reader", docs: 8}, {caller: "key:reader", docs: 3, wantKind: ErrQuotaExceeded}, {caller: "key:reader", docs: 2}},
+			wantPuts: 2,
+		},
+		{
+			name:     "callers are counted apart",
+			limit:    5,
+			writes:   []write{{caller: "key:a", docs: 5}, {caller: "key:a", docs: 1, wantKind: ErrQuotaExceeded}, {caller: "ip:10.0.0.2", docs: 5}},
+			wantPuts: 2,
+		},
+	}
+	for _, tt := range tests {
+		for backend, newStore := range configStores {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				ctx := context.Background()
+				s := &countingStore{ConfigStore: newStore(t)}
+				es := &ElasticsearchClient{}
+				es.store = s
+				day := time.Now().UTC().Format(quotaDayFormat)
+				es.quotas.prunedDay = day
+				for i, w := range tt.writes {
+					err := es.ConsumeDocumentQuota(ctx, w.caller, "products", w.docs, tt.limit)
+					if w.wantKind == ErrInternal {
+						if err != nil {
+							t.Fatalf("write %d: unexpected error: %v", i, err)
+						}
+						continue
+					}
+					if KindOf(err) != w.wantKind {
+						t.Fatalf("write %d: err = %v, want kind %v", i, err, w.wantKind)
+					}
+				}
+				if s.puts != tt.wantPuts {
+					t.Errorf("store writes = %d, want %d", s.puts, tt.wantPuts)
+				}
+
+				// Counters are keyed "<day>/<caller>/<index>".
+				rec, err := s.Get(ctx, store.CollectionQuotas, day+"/"+tt.writes[0].caller+"/products")
+				if err != nil {
+					t.Fatalf("reading quota counter: %v", err)
+				}
+				var usage quotaUsage
+				if err := json.Unmarshal(rec.Value, &usage); err != nil {
+					t.Fatal(err)
+				}
+				if usage.Documents == 0 || usage.Documents > tt.limit {
+					t.Errorf("counter = %d documents, want between 1 and %d", usage.Documents, tt.limit)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"elastic-search-config-service/models"
+)
+
+// DefaultMappingTTL is how long a cached mapping is trusted before it is
+// reloaded from Elasticsearch.
+const DefaultMappingTTL = 5 * time.Minute
+
+// Mapping sources reported by the registry.
+const (
+	MappingSourceStore         = "store"
+	MappingSourceElasticsearch = "elasticsearch"
+)
+
+type mappingEntry struct {
+	info     models.MappingInfo
+	source   string
+	version  int64
+	loadedAt time.Time
+}
+
+// MappingCacheEntry is a point-in-time view of a single cached mapping.
+type MappingCacheEntry struct {
+	IndexName     string                         `json:"index_name"`
+	Cached        bool                           `json:"cached"`
+	Source        string                         `json:"source,omitempty"`
+	StoreVersion  int64                          `json:"store_version,omitempty"`
+	LoadedAt      *time.Time                     `json:"loaded_at,omitempty"`
+	ExpiresAt     *time.Time                     `json:"expires_at,omitempty"`
+	Expired       bool                           `json:"expired"`
+	FieldMappings map[string]models.FieldMapping `json:"field_mappings,omitempty"`
+	Hits          uint64                         `json:"registry_hits"`
+	Misses        uint64                         `json:"registry_misses"`
+}
+
+// MappingRegistry caches field mappings per logical index. It is safe for
+// concurrent use; concurrent misses for the same index share a single load.
+type MappingRegistry struct {
+	ttl time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]mappingEntry
+	// generations advance whenever the mapping of an index is replaced or
+	// invalidated, so that a load started earlier cannot cache what it read.
+	generations map[string]uint64
+
+	flightMu sync.Mutex
+	flights  map[string]*mappingFlight
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type mappingFlight struct {
+	wg         sync.WaitGroup
+	generation uint64
+	info       models.MappingInfo
+	version    int64
+	err        error
+}
+
+// NewMappingRegistry returns an empty registry whose entries expire after ttl.
+// A non-positive ttl disables expiry.
+func NewMappingRegistry(ttl time.Duration) *MappingRegistry {
+	return &MappingRegistry{
+		ttl:         ttl,
+		entries:     make(map[string]mappingEntry),
+		generations: make(map[string]uint64),
+		flights:     make(map[string]*mappingFlight),
+	}
+}
+
+// Put stores the mapping of indexName as loaded from source at the given
+// config store version. Legacy keys using the read alias name are normalised
+// to the logical index name.
+func (r *MappingRegistry) Put(indexName string, info models.MappingInfo, source string, version int64) {
+	indexName = logicalIndexName(indexName)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.generations[indexName]++
+	r.entries[indexName] = mappingEntry{info: info, source: source, version: version, loadedAt: time.Now()}
+}
+
+func (r *MappingRegistry) generation(indexName string) uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.generations[logicalIndexName(indexName)]
+}
+
+// putLoaded caches a mapping loaded by a flight unless the index was
+// invalidated or replaced since the flight started.
+func (r *MappingRegistry) putLoaded(indexName string, f *mappingFlight) {
+	indexName = logicalIndexName(indexName)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.generations[indexName] != f.generation {
+		return
+	}
+	r.entries[indexName] = mappingEntry{info: f.info, source: MappingSourceElasticsearch, version: f.version, loadedAt: time.Now()}
+}
+
+// Get returns the mapping for indexName, calling load on a miss or when the
+// cached entry has expired. Concurrent callers for the same index wait for
+// the same load instead of each hitting Elasticsearch.
+func (r *MappingRegistry) Get(indexName string, load func() (models.MappingInfo, int64, error)) (models.MappingInfo, error) {
+	r.mu.RLock()
+	entry, ok := r.entries[indexName]
+	r.mu.RUnlock()
+	if ok && !r.expired(entry) {
+		r.hits.Add(1)
+		return entry.info, nil
+	}
+	r.misses.Add(1)
+
+	r.flightMu.Lock()
+	if f, ok := r.flights[indexName]; ok {
+		r.flightMu.Unlock()
+		f.wg.Wait()
+		return f.info, f.err
+	}
+	f := &mappingFlight{generation: r.generation(indexName)}
+	f.wg.Add(1)
+	r.flights[indexName] = f
+	r.flightMu.Unlock()
+
+	f.info, f.version, f.err = load()
+	if f.err == nil {
+		r.putLoaded(indexName, f)
+	}
+
+	r.flightMu.Lock()
+	if r.flights[indexName] == f {
+		delete(r.flights, indexName)
+	}
+	r.flightMu.Unlock()
+	f.wg.Done()
+
+	return f.info, f.err
+}
+
+// Stats returns how many lookups were served from the cache and how many
+// had to load the mapping.
+func (r *MappingRegistry) Stats() (hits, misses uint64) {
+	return r.hits.Load(), r.misses.Load()
+}
+
+// Invalidate drops the cached mapping for indexName so that the next Get
+// reloads it. Loads already in flight still answer their callers but are
+// not cached, and later callers do not wait for them.
+func (r *MappingRegistry) Invalidate(indexName string) {
+	r.mu.Lock()
+	delete(r.entries, indexName)
+	r.generations[logicalIndexName(indexName)]++
+	r.mu.Unlock()
+
+	r.flightMu.Lock()
+	delete(r.flights, indexName)
+	r.flightMu.Unlock()
+}
+
+// Snapshot describes the cache state for indexName without triggering a load.
+func (r *MappingRegistry) Snapshot(indexName string) MappingCacheEntry {
+	r.mu.RLock()
+	entry, ok := r.entries[indexName]
+	r.mu.RUnlock()
+
+	view := MappingCacheEntry{
+		IndexName: indexName,
+		Cached:    ok,
+		Hits:      r.hits.Load(),
+		Misses:    r.misses.Load(),
+	}
+	if !ok {
+		return view
+	}
+	loadedAt := entry.loadedAt
+	view.Source = entry.source
+	view.StoreVersion = entry.version
+	view.LoadedAt = &loadedAt
+	if r.ttl > 0 {
+		expiresAt := loadedAt.Add(r.ttl)
+		view.ExpiresAt = &expiresAt
+	}
+	view.Expired = r.expired(entry)
+	view.FieldMappings = entry.info.FieldMappings
+	return view
+}
+
+func (r *MappingRegistry) expired(entry mappingEntry) bool {
+	return r.ttl > 0 && time.Since(entry.loadedAt) > r.ttl
+}
+
+// logicalIndexName strips the read alias suffix older mapping files used as key.
+func logicalIndexName(name string) string {
+	return strings.TrimSuffix(name, models.GetIndexInfo(models.IndexName{}).ReadAlias)
+}
@@ -0,0 +1,500 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"elastic-search-config-service/metrics"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("elastic-search-config-service/services")
+
+// ErrCircuitOpen is returned without contacting Elasticsearch while the
+// circuit breaker considers the cluster down.
+var ErrCircuitOpen = errors.New("elasticsearch circuit breaker is open")
+
+// Operation classes used to pick a timeout for a request.
+const (
+	OpSearch = "search"
+	OpRead   = "read"
+	OpWrite  = "write"
+	OpBulk   = "bulk"
+	OpAdmin  = "admin"
+	// OpTask covers reindex and by-query requests, which may run for minutes.
+	OpTask = "task"
+)
+
+// Circuit breaker states reported in ResilienceStats.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// ResilienceConfig controls retries, timeouts and circuit breaking of
+// requests to Elasticsearch.
+type ResilienceConfig struct {
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+	// InitialBackoff and MaxBackoff bound the exponential backoff; the
+	// actual wait is picked at random up to the current bound.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// BreakerThreshold consecutive failures open the circuit for
+	// BreakerCooldown. A non-positive threshold disables the breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// Timeouts bound each operation, retries included, by operation class.
+	// A missing or non-positive entry means no timeout.
+	Timeouts map[string]time.Duration
+}
+
+// ResilienceStats counts what the resilience layer did since startup.
+type ResilienceStats struct {
+	Requests             uint64 `json:"requests"`
+	Attempts             uint64 `json:"attempts"`
+	RetriesRateLimited   uint64 `json:"retries_rate_limited"`
+	RetriesUnavailable   uint64 `json:"retries_unavailable"`
+	RetriesConnection    uint64 `json:"retries_connection"`
+	RetriesExhausted     uint64 `json:"retries_exhausted"`
+	Timeouts             uint64 `json:"timeouts"`
+	ShortCircuited       uint64 `json:"short_circuited"`
+	CircuitOpened        uint64 `json:"circuit_opened"`
+	CircuitState         string `json:"circuit_state"`
+	ConsecutiveFailures  int    `json:"consecutive_failures"`
+	CircuitOpenUntilUnix int64  `json:"circuit_open_until,omitempty"`
+}
+
+// resilientTransport wraps an esapi.Transport with retries, per-operation
+// timeouts and a circuit breaker.
+//
+// Connection errors and 429, 502, 503 and 504 responses are retried only for
+// idempotent requests, since the first attempt may have been applied: a 429
+// can come from a bulk or by-query request that was partly carried out.
+// Retries of a 429 wait at least as long as its Retry-After header asks.
+type resilientTransport struct {
+	next esapi.Transport
+	cfg  ResilienceConfig
+
+	breakerMu sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+
+	requests           atomic.Uint64
+	attempts           atomic.Uint64
+	retriesRateLimited atomic.Uint64
+	retriesUnavailable atomic.Uint64
+	retriesConnection  atomic.Uint64
+	retriesExhausted   atomic.Uint64
+	timeouts           atomic.Uint64
+	shortCircuited     atomic.Uint64
+	circuitOpened      atomic.Uint64
+}
+
+func newResilientTransport(next esapi.Transport, cfg ResilienceConfig) *resilientTransport {
+	return &resilientTransport{next: next, cfg: cfg}
+}
+
+// Perform implements esapi.Transport.
+func (t *resilientTransport) Perform(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+
+	caller := req.Context()
+	ctx, cancelOperation := context.WithCancel(caller)
+	cancel := cancelOperation
+	if timeout := t.cfg.Timeouts[classifyRequest(req)]; timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		cancel = func() {
+			cancelTimeout()
+			cancelOperation()
+		}
+	}
+	req = req.WithContext(ctx)
+
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		if err := bufferBody(req); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+	idempotent := isIdempotent(req)
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		allowed, probe := t.allow()
+		if !allowed {
+			t.shortCircuited.Add(1)
+			cancel()
+			return nil, ErrCircuitOpen
+		}
+		t.attempts.Add(1)
+		started := time.Now()
+		res, err := t.performTraced(req, attempt)
+		status := 0
+		if err == nil {
+			status = res.StatusCode
+		}
+		metrics.ObserveElasticsearch(esOperation(req), status, time.Since(started))
+		if caller.Err() != nil {
+			// The caller gave up or ran out of time; whatever the attempt
+			// returned says nothing about the cluster.
+			t.release(probe)
+		} else {
+			// Transport errors, the operation timeout among them, and
+			// unavailable statuses are the cluster's failures.
+			t.record(err == nil && !isUnavailable(res.StatusCode), probe)
+		}
+
+		retry, counter := t.shouldRetry(res, err, idempotent)
+		if !retry || ctx.Err() != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				t.timeouts.Add(1)
+			}
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			res.Body = cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+			return res, nil
+		}
+		if attempt >= t.cfg.MaxRetries {
+			t.retriesExhausted.Add(1)
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			res.Body = cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+			return res, nil
+		}
+
+		wait := t.backoff(attempt)
+		if res != nil {
+			if after := retryAfter(res); after > wait {
+				wait = after
+			}
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+		counter.Add(1)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				t.timeouts.Add(1)
+			}
+			cancel()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// performTraced sends a single attempt inside a client span and passes the
+// trace context on to Elasticsearch.
+func (t *resilientTransport) performTraced(req *http.Request, attempt int) (*http.Response, error) {
+	operation := esOperation(req)
+	ctx, span := tracer.Start(req.Context(), "elasticsearch "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemElasticsearch,
+			semconv.DBOperation(operation),
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLPath(req.URL.Path),
+			attribute.Int("elasticsearch.attempt", attempt),
+		),
+	)
+	defer span.End()
+
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	res, err := t.next.Perform(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode))
+	if res.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, res.Status)
+	}
+	return res, nil
+}
+
+// shouldRetry reports whether an attempt should be retried and which retry
+// counter to increment.
+func (t *resilientTransport) shouldRetry(res *http.Response, err error, idempotent bool) (bool, *atomic.Uint64) {
+	if err != nil {
+		return idempotent, &t.retriesConnection
+	}
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests:
+		return idempotent, &t.retriesRateLimited
+	case isUnavailable(res.StatusCode):
+		return idempotent, &t.retriesUnavailable
+	}
+	return false, nil
+}
+
+// backoff returns a random wait below the exponential bound for attempt.
+func (t *resilientTransport) backoff(attempt int) time.Duration {
+	bound := t.cfg.InitialBackoff << attempt
+	if bound <= 0 || bound > t.cfg.MaxBackoff {
+		bound = t.cfg.MaxBackoff
+	}
+	if bound <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(bound)))
+}
+
+// retryAfter returns the wait a response asks for in its Retry-After
+// header, given in seconds or as a date, or zero.
+func retryAfter(res *http.Response) time.Duration {
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// allow reports whether a request may be sent and whether it is the probe.
+// Once the cooldown has passed a single probe is let through; its outcome
+// closes or reopens the circuit.
+func (t *resilientTransport) allow() (allowed, probe bool) {
+	if t.cfg.BreakerThreshold <= 0 {
+		return true, false
+	}
+	t.breakerMu.Lock()
+	defer t.breakerMu.Unlock()
+	if t.failures < t.cfg.BreakerThreshold {
+		return true, false
+	}
+	if time.Now().Before(t.openUntil) || t.probing {
+		return false, false
+	}
+	t.probing = true
+	return true, true
+}
+
+// record counts the outcome of an attempt. Only the probe ends probing.
+func (t *resilientTransport) record(success, probe bool) {
+	if t.cfg.BreakerThreshold <= 0 {
+		return
+	}
+	t.breakerMu.Lock()
+	defer t.breakerMu.Unlock()
+	if probe {
+		t.probing = false
+	}
+	if success {
+		t.failures = 0
+		return
+	}
+	t.failures++
+	if t.failures == t.cfg.BreakerThreshold || probe {
+		t.circuitOpened.Add(1)
+	}
+	if t.failures >= t.cfg.BreakerThreshold {
+		t.openUntil = time.Now().Add(t.cfg.BreakerCooldown)
+	}
+}
+
+// release lets the next probe through without recording an outcome, when
+// the attempt that gave up was the probe.
+func (t *resilientTransport) release(probe bool) {
+	if !probe {
+		return
+	}
+	t.breakerMu.Lock()
+	defer t.breakerMu.Unlock()
+	t.probing = false
+}
+
+func (t *resilientTransport) stats() ResilienceStats {
+	stats := ResilienceStats{
+		Requests:           t.requests.Load(),
+		Attempts:           t.attempts.Load(),
+		RetriesRateLimited: t.retriesRateLimited.Load(),
+		RetriesUnavailable: t.retriesUnavailable.Load(),
+		RetriesConnection:  t.retriesConnection.Load(),
+		RetriesExhausted:   t.retriesExhausted.Load(),
+		Timeouts:           t.timeouts.Load(),
+		ShortCircuited:     t.shortCircuited.Load(),
+		CircuitOpened:      t.circuitOpened.Load(),
+		CircuitState:       CircuitClosed,
+	}
+
+	t.breakerMu.Lock()
+	defer t.breakerMu.Unlock()
+	stats.ConsecutiveFailures = t.failures
+	if t.cfg.BreakerThreshold > 0 && t.failures >= t.cfg.BreakerThreshold {
+		stats.CircuitState = CircuitHalfOpen
+		if time.Now().Before(t.openUntil) {
+			stats.CircuitState = CircuitOpen
+			stats.CircuitOpenUntilUnix = t.openUntil.Unix()
+		}
+	}
+	return stats
+}
+
+// ResilienceStats returns retry, timeout and circuit breaker counters.
+func (es *ElasticsearchClient) ResilienceStats() ResilienceStats {
+	return es.transport.stats()
+}
+
+func isUnavailable(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// readOnlyEndpoints are POST endpoints that never change data.
+var readOnlyEndpoints = []string{"_search", "_msearch", "_count", "_mget", "_field_caps", "_refresh"}
+
+// isIdempotent reports whether req can safely be sent again after an attempt
+// that may have been applied. Conditional writes, such as those the config
+// store makes, are not: a repeat of an applied write fails its own condition.
+// Neither is creating an index, which fails once the index exists.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodPut, http.MethodDelete:
+		query := req.URL.Query()
+		if query.Has("if_seq_no") || query.Has("if_primary_term") || query.Get("op_type") == "create" {
+			return false
+		}
+		segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+		if req.Method == http.MethodPut && len(segments) == 1 && !strings.HasPrefix(segments[0], "_") {
+			return false
+		}
+		for _, segment := range segments {
+			if segment == "_create" {
+				return false
+			}
+		}
+		return true
+	}
+	for _, segment := range strings.Split(req.URL.Path, "/") {
+		for _, endpoint := range readOnlyEndpoints {
+			if segment == endpoint {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// classifyRequest maps a request onto the operation class its timeout is
+// taken from.
+func classifyRequest(req *http.Request) string {
+	segments := strings.Split(req.URL.Path, "/")
+	for _, segment := range segments {
+		switch segment {
+		case "_search", "_msearch", "_count":
+			return OpSearch
+		case "_mget":
+			return OpRead
+		case "_bulk":
+			return OpBulk
+		case "_reindex", "_update_by_query", "_delete_by_query":
+			return OpTask
+		case "_doc", "_create", "_update":
+			if req.Method == http.MethodGet || req.Method == http.MethodHead {
+				return OpRead
+			}
+			return OpWrite
+		}
+	}
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return OpRead
+	}
+	return OpAdmin
+}
+
+// esOperation names the kind of request for latency metrics.
+func esOperation(req *http.Request) string {
+	for _, segment := range strings.Split(req.URL.Path, "/") {
+		switch segment {
+		case "_search", "_msearch", "_count":
+			return "search"
+		case "_bulk":
+			return "bulk"
+		case "_reindex":
+			return "reindex"
+		case "_aliases", "_alias":
+			return "alias_update"
+		case "_update_by_query", "_delete_by_query":
+			return "by_query"
+		case "_mapping":
+			return "mapping"
+		case "_settings":
+			return "settings"
+		case "_scripts":
+			return "script"
+		case "_mget":
+			return "document_read"
+		case "_doc", "_create", "_update":
+			if req.Method == http.MethodGet || req.Method == http.MethodHead {
+				return "document_read"
+			}
+			return "document_write"
+		}
+	}
+	return "index_admin"
+}
+
+func bufferBody(req *http.Request) error {
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.Body, _ = req.GetBody()
+	return nil
+}
+
+// cancelOnClose releases the operation's context once the caller is done
+// reading the response.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
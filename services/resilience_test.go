@@ -0,0 +1,309 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptedTransport answers each attempt with the next of its replies and
+// repeats the last one once they run out.
+type scriptedTransport struct {
+	replies  []func(req *http.Request) (*http.Response, error)
+	attempts int
+}
+
+func (s *scriptedTransport) Perform(req *http.Request) (*http.Response, error) {
+	reply := s.replies[len(s.replies)-1]
+	if s.attempts < len(s.replies) {
+		reply = s.replies[s.attempts]
+	}
+	s.attempts++
+	return reply(req)
+}
+
+func status(code int, header ...string) func(req *http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		res := &http.Response{StatusCode: code, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("{}"))}
+		for i := 0; i+1 < len(header); i += 2 {
+			res.Header.Set(header[i], header[i+1])
+		}
+		return res, nil
+	}
+}
+
+var errConnectionRefused = errors.New("connection refused")
+
+func connectionError(req *http.Request) (*http.Response, error) {
+	return nil, errConnectionRefused
+}
+
+// hang waits for the attempt's context to end.
+func hang(req *http.Request) (*http.Response, error) {
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func newTestRequest(t *testing.T, ctx context.Context, method, target string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, method, "http://elasticsearch:9200"+target, strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestResilientTransportRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		target       string
+		replies      []func(req *http.Request) (*http.Response, error)
+		wantAttempts int
+		wantStatus   int
+		wantErr      error
+		wantStats    ResilienceStats
+	}{
+		{
+			name:         "unavailable search retried",
+			method:       http.MethodPost,
+			target:       "/products/_search",
+			replies:      []func(req *http.Request) (*http.Response, error){status(503), status(200)},
+			wantAttempts: 2,
+			wantStatus:   200,
+			wantStats:    ResilienceStats{RetriesUnavailable: 1},
+		},
+		{
+			name:         "rate limited read retried",
+			method:       http.MethodGet,
+			target:       "/products/_doc/1",
+			replies:      []func(req *http.Request) (*http.Response, error){status(429), status(200)},
+			wantAttempts: 2,
+			wantStatus:   200,
+			wantStats:    ResilienceStats{RetriesRateLimited: 1},
+		},
+		{
+			name:         "connection error on a read retried",
+			method:       http.MethodGet,
+			target:       "/products/_doc/1",
+			replies:      []func(req *http.Request) (*http.Response, error){connectionError, status(200)},
+			wantAttempts: 2,
+			wantStatus:   200,
+			wantStats:    ResilienceStats{RetriesConnection: 1},
+		},
+		{
+			name:         "rate limited bulk not retried",
+			method:       http.MethodPost,
+			target:       "/_bulk",
+			replies:      []func(req *http.Request) (*http.Response, error){status(429)},
+			wantAttempts: 1,
+			wantStatus:   429,
+		},
+		{
+			name:         "conditional write not retried",
+			method:       http.MethodPut,
+			target:       "/config/_doc/1?if_seq_no=3&if_primary_term=1",
+			replies:      []func(req *http.Request) (*http.Response, error){connectionError},
+			wantAttempts: 1,
+			wantErr:      errConnectionRefused,
+		},
+		{
+			name:         "index creation not retried",
+			method:       http.MethodPut,
+			target:       "/products_v2",
+			replies:      []func(req *http.Request) (*http.Response, error){status(503)},
+			wantAttempts: 1,
+			wantStatus:   503,
+		},
+		{
+			name:         "client error not retried",
+			method:       http.MethodGet,
+			target:       "/products/_doc/1",
+			replies:      []func(req *http.Request) (*http.Response, error){status(404)},
+			wantAttempts: 1,
+			wantStatus:   404,
+		},
+		{
+			name:         "retries exhausted",
+			method:       http.MethodGet,
+			target:       "/products/_doc/1",
+			replies:      []func(req *http.Request) (*http.Response, error){status(502)},
+			wantAttempts: 3,
+			wantStatus:   502,
+			wantStats:    ResilienceStats{RetriesUnavailable: 2, RetriesExhausted: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &scriptedTransport{replies: tt.replies}
+			transport := newResilientTransport(next, ResilienceConfig{MaxRetries: 2, MaxBackoff: time.Millisecond})
+
+			res, err := transport.Perform(newTestRequest(t, context.Background(), tt.method, tt.target))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				res.Body.Close()
+				if res.StatusCode != tt.wantStatus {
+					t.Errorf("status = %d, want %d", res.StatusCode, tt.wantStatus)
+				}
+			}
+			if next.attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", next.attempts, tt.wantAttempts)
+			}
+			stats := transport.stats()
+			got := ResilienceStats{
+				RetriesRateLimited: stats.RetriesRateLimited,
+				RetriesUnavailable: stats.RetriesUnavailable,
+				RetriesConnection:  stats.RetriesConnection,
+				RetriesExhausted:   stats.RetriesExhausted,
+			}
+			if got != tt.wantStats {
+				t.Errorf("stats = %+v, want %+v", got, tt.wantStats)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{name: "missing"},
+		{name: "seconds", value: "3", min: 3 * time.Second, max: 3 * time.Second},
+		{name: "date", value: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), min: 58 * time.Second, max: time.Minute},
+		{name: "negative seconds", value: "-1"},
+		{name: "garbage", value: "soon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &http.Response{Header: http.Header{}}
+			if tt.value != "" {
+				res.Header.Set("Retry-After", tt.value)
+			}
+			if got := retryAfter(res); got < tt.min || got > tt.max {
+				t.Errorf("retryAfter(%q) = %v, want between %v and %v", tt.value, got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestResilientTransportBreaker(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	type attempt struct {
+		reply func(req *http.Request) (*http.Response, error)
+		// wait passes before the attempt is sent.
+		wait time.Duration
+		// ctx returns the caller's context for the attempt.
+		ctx         func() (context.Context, context.CancelFunc)
+		timeout     time.Duration
+		wantCircuit bool
+	}
+	canceled := func() (context.Context, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(5*time.Millisecond, cancel)
+		return ctx, cancel
+	}
+	expiring := func() (context.Context, context.CancelFunc) {
+		return context.WithTimeout(context.Background(), 5*time.Millisecond)
+	}
+	tests := []struct {
+		name         string
+		attempts     []attempt
+		wantFailures int
+		wantState    string
+	}{
+		{
+			name:         "opens after consecutive failures",
+			attempts:     []attempt{{reply: status(503)}, {reply: connectionError}, {reply: status(200), wantCircuit: true}},
+			wantFailures: 2,
+			wantState:    CircuitOpen,
+		},
+		{
+			name:         "success resets the count",
+			attempts:     []attempt{{reply: status(503)}, {reply: status(200)}, {reply: status(503)}},
+			wantFailures: 1,
+			wantState:    CircuitClosed,
+		},
+		{
+			name:         "rejected requests are not failures",
+			attempts:     []attempt{{reply: status(400)}, {reply: status(429)}, {reply: status(409)}},
+			wantFailures: 0,
+			wantState:    CircuitClosed,
+		},
+		{
+			name:         "probe closes the circuit",
+			attempts:     []attempt{{reply: status(503)}, {reply: status(503)}, {reply: status(200), wait: cooldown}, {reply: status(200)}},
+			wantFailures: 0,
+			wantState:    CircuitClosed,
+		},
+		{
+			name:         "failed probe reopens the circuit",
+			attempts:     []attempt{{reply: status(503)}, {reply: status(503)}, {reply: status(503), wait: cooldown}, {reply: status(200), wantCircuit: true}},
+			wantFailures: 3,
+			wantState:    CircuitOpen,
+		},
+		{
+			name:         "canceled callers are not failures",
+			attempts:     []attempt{{reply: hang, ctx: canceled}, {reply: hang, ctx: canceled}, {reply: status(200)}},
+			wantFailures: 0,
+			wantState:    CircuitClosed,
+		},
+		{
+			name:         "caller deadlines are not failures",
+			attempts:     []attempt{{reply: hang, ctx: expiring}, {reply: hang, ctx: expiring}, {reply: status(200)}},
+			wantFailures: 0,
+			wantState:    CircuitClosed,
+		},
+		{
+			name:         "operation timeouts are failures",
+			attempts:     []attempt{{reply: hang, timeout: 5 * time.Millisecond}, {reply: hang, timeout: 5 * time.Millisecond}, {reply: status(200), wantCircuit: true}},
+			wantFailures: 2,
+			wantState:    CircuitOpen,
+		},
+		{
+			name:         "probe given up by its caller lets the next one through",
+			attempts:     []attempt{{reply: status(503)}, {reply: status(503)}, {reply: hang, wait: cooldown, ctx: canceled}, {reply: status(200)}},
+			wantFailures: 0,
+			wantState:    CircuitClosed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := newResilientTransport(nil, ResilienceConfig{BreakerThreshold: 2, BreakerCooldown: cooldown})
+			for i, a := range tt.attempts {
+				time.Sleep(a.wait)
+				transport.next = &scriptedTransport{replies: []func(req *http.Request) (*http.Response, error){a.reply}}
+				transport.cfg.Timeouts = map[string]time.Duration{OpRead: a.timeout}
+				ctx, cancel := context.Background(), context.CancelFunc(func() {})
+				if a.ctx != nil {
+					ctx, cancel = a.ctx()
+				}
+
+				res, err := transport.Perform(newTestRequest(t, ctx, http.MethodGet, "/products/_doc/1"))
+				cancel()
+				if err == nil {
+					res.Body.Close()
+				}
+				if got := errors.Is(err, ErrCircuitOpen); got != a.wantCircuit {
+					t.Fatalf("attempt %d: err = %v, want circuit open %v", i, err, a.wantCircuit)
+				}
+			}
+			stats := transport.stats()
+			if stats.ConsecutiveFailures != tt.wantFailures || stats.CircuitState != tt.wantState {
+				t.Errorf("breaker = %d failures, %s, want %d failures, %s", stats.ConsecutiveFailures, stats.CircuitState, tt.wantFailures, tt.wantState)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"sort"
+	"strings"
+
+	"elastic-search-config-service/models"
+)
+
+// schemaMetaKey marks the mapping of an index created from a schema in its
+// _meta. The mark travels with the mapping into every later generation.
+const schemaMetaKey = "declared_schema"
+
+// hasDeclaredSchema reports whether mappings belong to an index created from
+// a schema, whose field types were chosen rather than guessed.
+func hasDeclaredSchema(mappings map[string]interface{}) bool {
+	meta, _ := mappings["_meta"].(map[string]interface{})
+	declared, _ := meta[schemaMetaKey].(bool)
+	return declared
+}
+
+// buildIndexBody turns a declarative schema into the body of a create index
+// request. Field flags decide how each field is indexed, following the same
+// rules ChangeMappings applies to searchable and facet attributes.
+func buildIndexBody(schema *models.IndexSchema) (map[string]interface{}, error) {
+	if err := validateSchema(schema); err != nil {
+		return nil, err
+	}
+
+	// Sort paths so that parents are always created before their children.
+	paths := make([]string, 0, len(schema.Fields))
+	for path := range schema.Fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	properties := make(map[string]interface{})
+	for _, path := range paths {
+		insertField(properties, path, fieldSchemaMapping(schema.Fields[path]))
+	}
+
+	mappings := map[string]interface{}{
+		"_meta":      map[string]interface{}{schemaMetaKey: true},
+		"properties": properties,
+	}
+	if schema.Dynamic != "" {
+		mappings["dynamic"] = schema.Dynamic
+	}
+
+	settings := make(map[string]interface{})
+	if schema.Shards > 0 {
+		settings["number_of_shards"] = schema.Shards
+	}
+	if schema.Replicas != nil {
+		settings["number_of_replicas"] = *schema.Replicas
+	}
+	analysis := make(map[string]interface{})
+	for kind, definitions := range schemaAnalysis(schema) {
+		if len(definitions) > 0 {
+			analysis[kind] = definitions
+		}
+	}
+	if len(analysis) > 0 {
+		settings["analysis"] = analysis
+	}
+
+	body := map[string]interface{}{
+		"mappings": mappings,
+	}
+	if len(settings) > 0 {
+		body["settings"] = settings
+	}
+	return body, nil
+}
+
+// insertField sets the mapping of the field at path within properties,
+// creating the objects leading up to it that are missing.
+func insertField(properties map[string]interface{}, path string, mapping map[string]interface{}) {
+	parent := properties
+	segments := strings.Split(path, ".")
+	for _, segment := range segments[:len(segments)-1] {
+		node, ok := parent[segment].(map[string]interface{})
+		if !ok {
+			node = map[string]interface{}{}
+			parent[segment] = node
+		}
+		children, ok := node["properties"].(map[string]interface{})
+		if !ok {
+			children = make(map[string]interface{})
+			node["properties"] = children
+		}
+		parent = children
+	}
+	parent[segments[len(segments)-1]] = mapping
+}
+
+// schemaAttributes lists the searchable and facet fields of schema, sorted,
+// in the form ChangeMappings takes them.
+func schemaAttributes(schema *models.IndexSchema) (searchable, facet []string) {
+	for path, field := range schema.Fields {
+		if field.Searchable {
+			searchable = append(searchable, path)
+		}
+		if field.Facet {
+			facet = append(facet, path)
+		}
+	}
+	sort.Strings(searchable)
+	sort.Strings(facet)
+	return searchable, facet
+}
+
+// schemaAnalysis returns the analysis definitions of schema keyed by their
+// section in settings.analysis.
+func schemaAnalysis(schema *models.IndexSchema) map[string]map[string]map[string]interface{} {
+	return map[string]map[string]map[string]interface{}{
+		"analyzer":    schema.Analyzers,
+		"tokenizer":   schema.Tokenizers,
+		"filter":      schema.Filters,
+		"char_filter": schema.CharFilters,
+		"normalizer":  schema.Normalizers,
+	}
+}
+
+// fieldSchemaMapping returns the Elasticsearch mapping of a single field.
+func fieldSchemaMapping(field models.FieldSchema) map[string]interface{} {
+	mapping := map[string]interface{}{}
+
+	switch field.Type {
+	case "object", "nested":
+		mapping["type"] = field.Type
+		return mapping
+	case "text":
+		switch {
+		case field.Searchable:
+			mapping["type"] = "text"
+			if field.Analyzer != "" {
+				mapping["analyzer"] = field.Analyzer
+			}
+			if field.SearchAnalyzer != "" {
+				mapping["search_analyzer"] = field.SearchAnalyzer
+			}
+			if field.Facet || field.Sortable {
+				mapping["fields"] = map[string]interface{}{
+					"keyword": map[string]interface{}{
+						"type":         "keyword",
+						"ignore_above": 256,
+					},
+				}
+			}
+		case field.Facet || field.Sortable:
+			mapping["type"] = "keyword"
+		default:
+			mapping["type"] = "text"
+			mapping["index"] = false
+		}
+	default:
+		mapping["type"] = field.Type
+		if !field.Searchable && !field.Facet && !field.Sortable {
+			mapping["index"] = false
+			mapping["doc_values"] = false
+		}
+	}
+	return mapping
+}
+
+func validateSchema(schema *models.IndexSchema) error {
+	switch schema.Dynamic {
+	case "", models.DynamicStrict, models.DynamicFalse, models.DynamicTrue:
+	default:
+		return invalidRequestError("dynamic must be one of strict, false or true")
+	}
+	if schema.Shards < 0 {
+		return invalidRequestError("number_of_shards must be positive")
+	}
+	if schema.Replicas != nil && *schema.Replicas < 0 {
+		return invalidRequestError("number_of_replicas must not be negative")
+	}
+
+	var invalid []FieldError
+	for path, field := range schema.Fields {
+		if path == "" || strings.HasPrefix(path, ".") || strings.HasSuffix(path, ".") || strings.Contains(path, "..") {
+			invalid = append(invalid, FieldError{Field: path, Reason: "invalid field path"})
+			continue
+		}
+		if _, ok := models.FieldTypes[field.Type]; !ok {
+			invalid = append(invalid, FieldError{Field: path, Reason: "unsupported type " + field.Type})
+			continue
+		}
+		container := field.Type == "object" || field.Type == "nested"
+		if container && (field.Searchable || field.Facet || field.Sortable) {
+			invalid = append(invalid, FieldError{Field: path, Reason: field.Type + " fields cannot be searchable, facet or sortable"})
+		}
+		if (field.Analyzer != "" || field.SearchAnalyzer != "") && (field.Type != "text" || !field.Searchable) {
+			invalid = append(invalid, FieldError{Field: path, Reason: "analyzers only apply to searchable text fields"})
+		}
+		for _, analyzer := range []string{field.Analyzer, field.SearchAnalyzer} {
+			if _, custom := schema.Analyzers[analyzer]; analyzer != "" && !custom && !isBuiltinAnalyzer(analyzer) {
+				invalid = append(invalid, FieldError{Field: path, Reason: "unknown analyzer " + analyzer})
+			}
+		}
+
+		// Every declared ancestor must be able to hold children.
+		segments := strings.Split(path, ".")
+		for i := 1; i < len(segments); i++ {
+			parentPath := strings.Join(segments[:i], ".")
+			if parent, ok := schema.Fields[parentPath]; ok && parent.Type != "object" && parent.Type != "nested" {
+				invalid = append(invalid, FieldError{Field: path, Reason: "parent " + parentPath + " is not an object or nested field"})
+			}
+		}
+	}
+	if len(invalid) > 0 {
+		sort.Slice(invalid, func(i, j int) bool { return invalid[i].Field < invalid[j].Field })
+		return invalidFieldsError("invalid index schema", invalid)
+	}
+	return nil
+}
+
+// builtinAnalyzers are the analyzers Elasticsearch provides without any
+// analysis settings. Language analyzers are accepted by name as well.
+var builtinAnalyzers = map[string]struct{}{
+	"standard":    {},
+	"simple":      {},
+	"whitespace":  {},
+	"stop":        {},
+	"keyword":     {},
+	"pattern":     {},
+	"fingerprint": {},
+}
+
+var languageAnalyzers = map[string]struct{}{
+	"arabic": {}, "armenian": {}, "basque": {}, "bengali": {}, "brazilian": {},
+	"bulgarian": {}, "catalan": {}, "cjk": {}, "czech": {}, "danish": {},
+	"dutch": {}, "english": {}, "estonian": {}, "finnish": {}, "french": {},
+	"galician": {}, "german": {}, "greek": {}, "hindi": {}, "hungarian": {},
+	"indonesian": {}, "irish": {}, "italian": {}, "latvian": {}, "lithuanian": {},
+	"norwegian": {}, "persian": {}, "portuguese": {}, "romanian": {}, "russian": {},
+	"serbian": {}, "sorani": {}, "spanish": {}, "swedish": {}, "turkish": {}, "thai": {},
+}
+
+func isBuiltinAnalyzer(name string) bool {
+	if _, ok := builtinAnalyzers[name]; ok {
+		return true
+	}
+	_, ok := languageAnalyzers[name]
+	return ok
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"elastic-search-config-service/models"
+)
+
+func TestCreateDynamicMappingTypes(t *testing.T) {
+	const properties = `{
+		"title":{"type":"text","analyzer":"english"},
+		"price":{"type":"float"},
+		"stock":{"type":"long"},
+		"sku":{"type":"keyword"}
+	}`
+	settings := models.IndexSettings{
+		SearchableAttributes: []string{"title", "price"},
+		FacetAttributes:      []string{"title", "stock"},
+	}
+	tests := []struct {
+		name string
+		meta string
+		want string
+	}{
+		{
+			name: "index without a schema",
+			want: `{
+				"title":{"type":"text","analyzer":"english","fields":{"keyword":{"type":"keyword","ignore_above":256}}},
+				"price":{"type":"text"},
+				"stock":{"type":"keyword"},
+				"sku":{"type":"keyword","index":false,"doc_values":false}
+			}`,
+		},
+		{
+			name: "index created from a schema",
+			meta: `{"declared_schema":true}`,
+			want: `{
+				"title":{"type":"text","analyzer":"english","fields":{"keyword":{"type":"keyword","ignore_above":256}}},
+				"price":{"type":"float"},
+				"stock":{"type":"long"},
+				"sku":{"type":"keyword","index":false,"doc_values":false}
+			}`,
+		},
+		{
+			name: "other _meta",
+			meta: `{"owner":"search-team"}`,
+			want: `{
+				"title":{"type":"text","analyzer":"english","fields":{"keyword":{"type":"keyword","ignore_above":256}}},
+				"price":{"type":"text"},
+				"stock":{"type":"keyword"},
+				"sku":{"type":"keyword","index":false,"doc_values":false}
+			}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mappings := `{"properties":` + properties + `}`
+			if tt.meta != "" {
+				mappings = `{"_meta":` + tt.meta + `,"properties":` + properties + `}`
+			}
+			var existing map[string]interface{}
+			if err := json.Unmarshal([]byte(`{"products_v1":{"mappings":`+mappings+`}}`), &existing); err != nil {
+				t.Fatal(err)
+			}
+
+			mapping, err := createDynamicMapping("products_v1", existing, settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want map[string]interface{}
+			if err := json.Unmarshal([]byte(marshalToJSONString(mapping["properties"])), &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("properties = %s, want %s", marshalToJSONString(got), marshalToJSONString(want))
+			}
+		})
+	}
+}
+
+func TestBuildIndexBodyMarksSchema(t *testing.T) {
+	body, err := buildIndexBody(&models.IndexSchema{Fields: map[string]models.FieldSchema{"title": {Type: "text", Searchable: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasDeclaredSchema(body["mappings"].(map[string]interface{})) {
+		t.Errorf("mappings %s do not mark the schema", marshalToJSONString(body["mappings"]))
+	}
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"elastic-search-config-service/models"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// scriptHelpers are shared by every managed script. Functions cannot reach
+// ctx, so the document source is passed in explicitly.
+const scriptHelpers = `
+Map parentOf(Map source, List path, boolean create) {
+  Map node = source;
+  for (int i = 0; i < path.size() - 1; i++) {
+    def child = node.get(path.get(i));
+    if (child == null && create) {
+      child = new HashMap();
+      node.put(path.get(i), child);
+    }
+    if (!(child instanceof Map)) {
+      return null;
+    }
+    node = (Map) child;
+  }
+  return node;
+}
+
+List listAt(Map parent, String key, boolean create) {
+  if (parent == null) {
+    return null;
+  }
+  def value = parent.get(key);
+  if (value == null) {
+    if (!create) {
+      return null;
+    }
+    value = new ArrayList();
+    parent.put(key, value);
+  } else if (!(value instanceof List)) {
+    List wrapped = new ArrayList();
+    wrapped.add(value);
+    parent.put(key, wrapped);
+    value = wrapped;
+  }
+  return (List) value;
+}
+
+boolean matches(def item, Map where) {
+  if (!(item instanceof Map)) {
+    return false;
+  }
+  for (def entry : where.entrySet()) {
+    if (!Objects.equals(item.get(entry.getKey()), entry.getValue())) {
+      return false;
+    }
+  }
+  return true;
+}
+`
+
+// scriptSources holds the body of each managed script, keyed by operation.
+var scriptSources = map[string]string{
+	models.UpdateOpAppend: `
+String key = params.path.get(params.path.size() - 1);
+List list = listAt(parentOf(ctx._source, params.path, true), key, true);
+if (list == null) {
+  ctx.op = 'noop';
+} else {
+  list.add(params.item);
+}
+`,
+	models.UpdateOpRemove: `
+String key = params.path.get(params.path.size() - 1);
+List list = listAt(parentOf(ctx._source, params.path, false), key, false);
+int removed = 0;
+if (list != null) {
+  Iterator it = list.iterator();
+  while (it.hasNext()) {
+    if (matches(it.next(), params.where)) {
+      it.remove();
+      removed++;
+    }
+  }
+}
+if (removed == 0) {
+  ctx.op = 'noop';
+}
+`,
+	models.UpdateOpModify: `
+String key = params.path.get(params.path.size() - 1);
+List list = listAt(parentOf(ctx._source, params.path, false), key, false);
+int modified = 0;
+if (list != null) {
+  for (def item : list) {
+    if (matches(item, params.where)) {
+      item.putAll(params.set);
+      modified++;
+    }
+  }
+}
+if (modified == 0) {
+  ctx.op = 'noop';
+}
+`,
+	models.UpdateOpIncrement: `
+String key = params.path.get(params.path.size() - 1);
+if (params.where == null) {
+  Map parent = parentOf(ctx._source, params.path, true);
+  if (parent == null) {
+    ctx.op = 'noop';
+  } else {
+    def current = parent.get(key);
+    parent.put(key, (current == null ? 0 : current) + params.by);
+  }
+} else {
+  List list = listAt(parentOf(ctx._source, params.path, false), key, false);
+  int changed = 0;
+  if (list != null) {
+    for (def item : list) {
+      if (matches(item, params.where)) {
+        def current = item.get(params.field);
+        item.put(params.field, (current == null ? 0 : current) + params.by);
+        changed++;
+      }
+    }
+  }
+  if (changed == 0) {
+    ctx.op = 'noop';
+  }
+}
+`,
+}
+
+// scriptVersion is part of every script ID. Bump it whenever a script source
+// changes so that running instances keep using the version they know.
+const scriptVersion = "v1"
+
+func scriptID(op string) string {
+	return "ecs-" + op + "-" + scriptVersion
+}
+
+// scriptManager installs the managed scripts as stored scripts on first use.
+type scriptManager struct {
+	mu        sync.Mutex
+	installed map[string]bool
+}
+
+func newScriptManager() *scriptManager {
+	return &scriptManager{installed: make(map[string]bool)}
+}
+
+// ensureScript stores the script for op unless this process already did and
+// returns its ID. Storing is idempotent, so concurrent instances may race.
+func (es *ElasticsearchClient) ensureScript(ctx context.Context, op string) (string, error) {
+	source, ok := scriptSources[op]
+	if !ok {
+		return "", invalidRequestError("unknown update operation " + op)
+	}
+	id := scriptID(op)
+
+	es.scripts.mu.Lock()
+	defer es.scripts.mu.Unlock()
+	if es.scripts.installed[op] {
+		return id, nil
+	}
+
+	var buf bytes.Buffer
+	body := map[string]interface{}{
+		"script": map[string]interface{}{
+			"lang":   "painless",
+			"source": scriptHelpers + source,
+		},
+	}
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return "", err
+	}
+	req := esapi.PutScriptRequest{
+		ScriptID: id,
+		Body:     &buf,
+	}
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		return "", transportError("error storing update script", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return "", responseError("error storing update script", res)
+	}
+	es.scripts.installed[op] = true
+	return id, nil
+}
+
+// ManagedScripts lists the stored scripts used for scripted updates.
+func (es *ElasticsearchClient) ManagedScripts() []models.ManagedScript {
+	es.scripts.mu.Lock()
+	defer es.scripts.mu.Unlock()
+	scripts := make([]models.ManagedScript, 0, len(scriptSources))
+	for op := range scriptSources {
+		scripts = append(scripts, models.ManagedScript{
+			ID:        scriptID(op),
+			Op:        op,
+			Installed: es.scripts.installed[op],
+		})
+	}
+	sort.Slice(scripts, func(i, j int) bool { return scripts[i].ID < scripts[j].ID })
+	return scripts
+}
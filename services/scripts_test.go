@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"elastic-search-config-service/models"
+)
+
+var updateTestMapping = models.QueryBuilder{FieldMappings: map[string]models.FieldMapping{
+	"title":             {DataType: []string{"text"}},
+	"stock":             {DataType: []string{"long"}},
+	"variants.sku":      {Path: "variants", DataType: []string{"keyword"}, IsNested: true},
+	"variants.color":    {Path: "variants", DataType: []string{"keyword"}, IsNested: true},
+	"variants.quantity": {Path: "variants", DataType: []string{"integer"}, IsNested: true},
+}}
+
+func TestValidateFieldUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		update models.FieldUpdate
+		// wantKind is the zero ErrInternal for a valid update.
+		wantKind    ErrorKind
+		wantInvalid []string
+	}{
+		{
+			name:   "append to a nested list",
+			update: models.FieldUpdate{Op: models.UpdateOpAppend, Path: "variants", Item: map[string]interface{}{"sku": "a-1"}},
+		},
+		{
+			name:     "append without an item",
+			update:   models.FieldUpdate{Op: models.UpdateOpAppend, Path: "variants"},
+			wantKind: ErrInvalidRequest,
+		},
+		{
+			name:        "append to a leaf field",
+			update:      models.FieldUpdate{Op: models.UpdateOpAppend, Path: "title", Item: map[string]interface{}{"sku": "a-1"}},
+			wantKind:    ErrInvalidField,
+			wantInvalid: []string{"title"},
+		},
+		{
+			name:   "remove matching items",
+			update: models.FieldUpdate{Op: models.UpdateOpRemove, Path: "variants", Where: map[string]interface{}{"sku": "a-1"}},
+		},
+		{
+			name:        "remove by an unmapped field",
+			update:      models.FieldUpdate{Op: models.UpdateOpRemove, Path: "variants", Where: map[string]interface{}{"size": "xl", "sku": "a-1"}},
+			wantKind:    ErrInvalidField,
+			wantInvalid: []string{"variants.size"},
+		},
+		{
+			name:     "modify without set",
+			update:   models.FieldUpdate{Op: models.UpdateOpModify, Path: "variants", Where: map[string]interface{}{"sku": "a-1"}},
+			wantKind: ErrInvalidRequest,
+		},
+		{
+			name:        "modify unmapped fields",
+			update:      models.FieldUpdate{Op: models.UpdateOpModify, Path: "variants", Where: map[string]interface{}{"sku": "a-1"}, Set: map[string]interface{}{"size": "xl", "weight": 2}},
+			wantKind:    ErrInvalidField,
+			wantInvalid: []string{"variants.size", "variants.weight"},
+		},
+		{
+			name:   "increment a top level number",
+			update: models.FieldUpdate{Op: models.UpdateOpIncrement, Path: "stock", By: -2},
+		},
+		{
+			name:   "increment a field of matching items",
+			update: models.FieldUpdate{Op: models.UpdateOpIncrement, Path: "variants", Where: map[string]interface{}{"sku": "a-1"}, Field: "quantity", By: 1},
+		},
+		{
+			name:        "increment text",
+			update:      models.FieldUpdate{Op: models.UpdateOpIncrement, Path: "title", By: 1},
+			wantKind:    ErrInvalidField,
+			wantInvalid: []string{"title"},
+		},
+		{
+			name:     "increment by zero",
+			update:   models.FieldUpdate{Op: models.UpdateOpIncrement, Path: "stock"},
+			wantKind: ErrInvalidRequest,
+		},
+		{
+			name:     "increment matching items without a field",
+			update:   models.FieldUpdate{Op: models.UpdateOpIncrement, Path: "variants", Where: map[string]interface{}{"sku": "a-1"}, By: 1},
+			wantKind: ErrInvalidRequest,
+		},
+		{
+			name:     "unknown operation",
+			update:   models.FieldUpdate{Op: "replace", Path: "title"},
+			wantKind: ErrInvalidRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := updateTestMapping
+			err := validateFieldUpdate(&qb, tt.update)
+			if tt.wantKind == ErrInternal {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if KindOf(err) != tt.wantKind {
+				t.Fatalf("err = %v, want kind %v", err, tt.wantKind)
+			}
+			if tt.wantInvalid == nil {
+				return
+			}
+			var got []string
+			for _, field := range err.(*Error).Fields {
+				got = append(got, field.Field)
+			}
+			if !reflect.DeepEqual(got, tt.wantInvalid) {
+				t.Errorf("invalid fields = %q, want %q", got, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+// scriptStore records the stored scripts put into it.
+type scriptStore struct {
+	puts     map[string]string
+	putCount int
+}
+
+func (s *scriptStore) Perform(req *http.Request) (*http.Response, error) {
+	id, ok := strings.CutPrefix(req.URL.Path, "/_scripts/")
+	if !ok || req.Method != http.MethodPut {
+		return status(http.StatusBadRequest)(req)
+	}
+	var body struct {
+		Script struct {
+			Lang   string `json:"lang"`
+			Source string `json:"source"`
+		} `json:"script"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	s.puts[id] = body.Script.Source
+	s.putCount++
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`{"acknowledged":true}`))}, nil
+}
+
+func TestUpdateScript(t *testing.T) {
+	ctx := context.Background()
+	scripts := &scriptStore{puts: make(map[string]string)}
+	es := &ElasticsearchClient{mappings: NewMappingRegistry(0), scripts: newScriptManager(), transport: newResilientTransport(scripts, ResilienceConfig{})}
+	es.mappings.Put("products", models.MappingInfo{IndexName: "products", FieldMappings: updateTestMapping.FieldMappings}, MappingSourceElasticsearch, 1)
+	ind := models.IndexInfo{IndexName: "products"}
+
+	tests := []struct {
+		update     models.FieldUpdate
+		wantID     string
+		wantParams string
+	}{
+		{
+			update:     models.FieldUpdate{Op: models.UpdateOpAppend, Path: "variants", Item: map[string]interface{}{"sku": "a-1"}},
+			wantID:     "ecs-append-v1",
+			wantParams: `{"item":{"sku":"a-1"},"path":["variants"]}`,
+		},
+		{
+			update:     models.FieldUpdate{Op: models.UpdateOpAppend, Path: "variants", Item: map[string]interface{}{"sku": "b-2"}},
+			wantID:     "ecs-append-v1",
+			wantParams: `{"item":{"sku":"b-2"},"path":["variants"]}`,
+		},
+		{
+			update:     models.FieldUpdate{Op: models.UpdateOpModify, Path: "variants", Where: map[string]interface{}{"sku": "a-1"}, Set: map[string]interface{}{"color": "red"}},
+			wantID:     "ecs-modify-v1",
+			wantParams: `{"path":["variants"],"set":{"color":"red"},"where":{"sku":"a-1"}}`,
+		},
+		{
+			update:     models.FieldUpdate{Op: models.UpdateOpIncrement, Path: "stock", By: 3},
+			wantID:     "ecs-increment-v1",
+			wantParams: `{"by":3,"path":["stock"],"where":null}`,
+		},
+		{
+			update:     models.FieldUpdate{Op: models.UpdateOpIncrement, Path: "variants", Where: map[string]interface{}{"sku": "a-1"}, Field: "quantity", By: -1},
+			wantID:     "ecs-increment-v1",
+			wantParams: `{"by":-1,"field":"quantity","path":["variants"],"where":{"sku":"a-1"}}`,
+		},
+	}
+	for _, tt := range tests {
+		script, err := es.updateScript(ctx, ind, tt.update)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.update.Op, err)
+		}
+		if script["id"] != tt.wantID {
+			t.Errorf("%s: script id = %v, want %s", tt.update.Op, script["id"], tt.wantID)
+		}
+		if params := marshalToJSONString(script["params"]); params != tt.wantParams {
+			t.Errorf("%s: params = %s, want %s", tt.update.Op, params, tt.wantParams)
+		}
+	}
+
+	// Each script is stored once, with the shared helpers.
+	if scripts.putCount != 3 || len(scripts.puts) != 3 {
+		t.Errorf("stored %d scripts in %d requests, want 3 in 3", len(scripts.puts), scripts.putCount)
+	}
+	for id, source := range scripts.puts {
+		if !strings.HasPrefix(source, scriptHelpers) {
+			t.Errorf("script %s does not start with the helpers", id)
+		}
+	}
+	var installed []string
+	for _, script := range es.ManagedScripts() {
+		if script.Installed {
+			installed = append(installed, script.ID)
+		}
+	}
+	if want := []string{"ecs-append-v1", "ecs-increment-v1", "ecs-modify-v1"}; !reflect.DeepEqual(installed, want) {
+		t.Errorf("installed scripts = %q, want %q", installed, want)
+	}
+}
@@ -3,51 +3,90 @@ package services
 import (
 	"bytes"
 	"context"
+	"elastic-search-config-service/metrics"
 	"elastic-search-config-service/models"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func (es *ElasticsearchClient) Search(payload models.SearchReq) (map[string]interface{}, error) {
+// minSearchTimeoutMargin is the least time kept between the search timeout
+// and the request deadline.
+const minSearchTimeoutMargin = 50 * time.Millisecond
+
+func (es *ElasticsearchClient) Search(ctx context.Context, payload models.SearchReq) (map[string]interface{}, error) {
 	ind := models.GetIndexInfo(models.IndexName{Index: payload.IndexName})
 	// form query here
-	query, queryBuf, err := es.BuildSearchQuery(payload)
+	buildStarted := time.Now()
+	query, queryBuf, err := es.BuildSearchQuery(ctx, payload)
 	if err != nil {
-		return nil, fmt.Errorf("some error occurred while building search query: %w", err)
+		return nil, fmt.Errorf("error building search query: %w", err)
 	}
-	fmt.Println(marshalToJSONString(query))
-	// return nil, nil
+	metrics.ObserveQueryBuild("search", time.Since(buildStarted))
+	es.logQuery(ctx, ind.IndexName, "search", query)
 	req := esapi.SearchRequest{
-		Index: []string{ind.ReadAlias},
-		Body:  &queryBuf,
+		Index:   []string{ind.ReadAlias},
+		Body:    &queryBuf,
+		Timeout: searchTimeout(ctx),
 	}
-	res, err := req.Do(context.Background(), es.client)
+	started := time.Now()
+	res, err := req.Do(ctx, es.transport)
 	if err != nil {
-		return nil, err
+		return nil, transportError("error executing search", err)
 	}
 	defer res.Body.Close()
 	if res.IsError() {
-		return nil, fmt.Errorf("error creating index: %s", res.String())
+		return nil, responseError("error executing search", res)
 	}
 	var searchResponse map[string]interface{}
 	if err := json.NewDecoder(res.Body).Decode(&searchResponse); err != nil {
 		return nil, err
 	}
+	took, _ := searchResponse["took"].(float64)
+	metrics.ObserveSearch("search", int64(took), time.Since(started))
 
-	fmt.Println(searchResponse)
+	hits := searchResponse["hits"].(map[string]interface{})
+	if timedOut, _ := searchResponse["timed_out"].(bool); timedOut {
+		// Partial results: only the shards that answered in time are included.
+		hits["timed_out"] = true
+	}
+	return hits, nil
+}
 
-	return searchResponse["hits"].(map[string]interface{}), nil
+// searchTimeout returns the Elasticsearch search timeout that leaves enough
+// of the request deadline for partial results to make it back, or zero when
+// ctx has no deadline.
+func searchTimeout(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	remaining := time.Until(deadline)
+	margin := remaining / 10
+	if margin < minSearchTimeoutMargin {
+		margin = minSearchTimeoutMargin
+	}
+	if remaining-margin < time.Millisecond {
+		return time.Millisecond
+	}
+	return remaining - margin
 }
 
-func (es *ElasticsearchClient) BuildSearchQuery(reqPayload models.SearchReq) (map[string]interface{}, bytes.Buffer, error) {
+func (es *ElasticsearchClient) BuildSearchQuery(ctx context.Context, reqPayload models.SearchReq) (map[string]interface{}, bytes.Buffer, error) {
+	ctx, span := tracer.Start(ctx, "BuildSearchQuery", trace.WithAttributes(attribute.String("index", reqPayload.IndexName)))
+	defer span.End()
+
 	var buf bytes.Buffer
-	query := map[string]interface{}{
-		"query": es.getSearchQueryHelper(reqPayload),
-		"from":  reqPayload.Cursor,
-		"size":  reqPayload.PageSize,
-		// "sort": getSortingData(reqPayload),
+	query, err := es.buildSearchQuery(ctx, reqPayload)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, buf, err
 	}
 	if err := json.NewEncoder(&buf).Encode(query); err != nil {
 		return query, buf, err
@@ -56,31 +95,68 @@ func (es *ElasticsearchClient) BuildSearchQuery(reqPayload models.SearchReq) (ma
 	return query, buf, nil
 }
 
-func (es *ElasticsearchClient) getSearchQueryHelper(reqPayload models.SearchReq) map[string]interface{} {
+func (es *ElasticsearchClient) buildSearchQuery(ctx context.Context, reqPayload models.SearchReq) (map[string]interface{}, error) {
+	ind := models.GetIndexInfo(models.IndexName{Index: reqPayload.IndexName})
+	qb, err := es.GetMappingBuilder(ctx, ind)
+	if err != nil {
+		return nil, err
+	}
+	perms, err := es.fieldPermissions(ctx, ind, &qb, reqPayload.FieldAccess)
+	if err != nil {
+		return nil, err
+	}
+	// The tenant filter is imposed on the caller and may use fields hidden
+	// from it; the filter the caller sent may not.
+	fields := make([]string, len(reqPayload.Filter))
+	for i, unit := range reqPayload.Filter {
+		fields[i] = unit.Field
+	}
+	if hidden := perms.hidden(fields); len(hidden) > 0 {
+		return nil, invalidFieldsError("invalid filter", hidden)
+	}
+	searchQuery, err := getSearchQueryHelper(&qb, reqPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	query := map[string]interface{}{
+		"query": searchQuery,
+		"from":  reqPayload.Cursor,
+		"size":  reqPayload.PageSize,
+		// "sort": getSortingData(reqPayload),
+	}
+	if source := perms.source(); source != nil {
+		query["_source"] = source
+	}
+	return query, nil
+}
+
+func getSearchQueryHelper(qb *models.QueryBuilder, reqPayload models.SearchReq) (map[string]interface{}, error) {
 	normalizeBoostValues(&reqPayload.SearchConfig)
 
 	boolQuery := make(map[string]interface{})
-	// qb := models.NewQueryBuilder()
-	qb, err := es.GetMappingBuilder(models.GetIndexInfo(models.IndexName{Index: reqPayload.IndexName}))
-	if err != nil {
-		return map[string]interface{}{}
-	}
-	if should := generateElasticsearchSearch(&qb, reqPayload); should != nil {
+	if should := generateElasticsearchSearch(qb, reqPayload); should != nil {
 		boolQuery["should"] = should
 		boolQuery["minimum_should_match"] = 1 // later we will play around with this
 	}
-	if filter, _ := generateElasticsearchFilter(&qb, reqPayload.Filter); filter != nil {
+	// Filter units are ANDed, so the tenant filter narrows whatever the
+	// caller asked for.
+	filter, err := generateElasticsearchFilter(qb, append(append(models.Filter{}, reqPayload.Filter...), reqPayload.TenantFilter...))
+	if err != nil {
+		return nil, err
+	}
+	if filter != nil {
 		boolQuery["filter"] = filter
 	}
 
 	return map[string]interface{}{
 		"bool": boolQuery,
-	}
+	}, nil
 }
 
 func generateElasticsearchFilter(qb *models.QueryBuilder, f models.Filter) (map[string]interface{}, error) {
 	if len(f) == 0 {
-		return nil, fmt.Errorf("no filters provided")
+		return nil, nil
 	}
 
 	esFilter := make(map[string]interface{})
@@ -89,11 +165,11 @@ func generateElasticsearchFilter(qb *models.QueryBuilder, f models.Filter) (map[
 	for _, filterUnit := range f {
 		fieldMapping, exists := qb.FieldMappings[filterUnit.Field]
 		if !exists {
-			return nil, fmt.Errorf("field %s does not exist in field mappings", filterUnit.Field)
+			return nil, invalidFieldsError("invalid filter", []FieldError{{Field: filterUnit.Field, Reason: "field does not exist in index mapping"}})
 		}
 
 		if len(filterUnit.Values) == 0 {
-			return nil, fmt.Errorf("no values for field %s", filterUnit.Field)
+			return nil, invalidFieldsError("invalid filter", []FieldError{{Field: filterUnit.Field, Reason: "no values provided"}})
 		}
 
 		var shouldClause map[string]interface{}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"elastic-search-config-service/models"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// dynamicSettings are the index settings that can safely be changed on a live
+// index through the settings endpoint.
+var dynamicSettings = map[string]struct{}{
+	"number_of_replicas": {},
+	"refresh_interval":   {},
+	"max_result_window":  {},
+}
+
+// dynamicSettingPrefixes admit whole families of dynamic settings.
+var dynamicSettingPrefixes = []string{
+	"search.slowlog.threshold.",
+	"indexing.slowlog.threshold.",
+}
+
+// staticSettings can only be chosen when an index is created; changing them
+// requires a new generation of the index.
+var staticSettings = map[string]struct{}{
+	"number_of_shards":         {},
+	"number_of_routing_shards": {},
+	"codec":                    {},
+	"routing_partition_size":   {},
+	"soft_deletes.enabled":     {},
+	"sort.field":               {},
+	"sort.order":               {},
+}
+
+// UpdateIndexSettings applies dynamic settings to the physical index (or
+// indices, during a migration) behind the logical index's aliases and returns
+// the normalised settings together with the indices they were applied to.
+func (es *ElasticsearchClient) UpdateIndexSettings(ctx context.Context, ind models.IndexInfo, settings map[string]interface{}) (models.IndexSettingsUpdate, error) {
+	flat := make(map[string]interface{})
+	flattenSettings("", settings, flat)
+	if len(flat) == 0 {
+		return models.IndexSettingsUpdate{}, invalidRequestError("no settings provided")
+	}
+
+	if err := validateDynamicSettings(flat); err != nil {
+		return models.IndexSettingsUpdate{}, err
+	}
+
+	indices, err := es.logicalIndexGenerations(ctx, ind)
+	if err != nil {
+		return models.IndexSettingsUpdate{}, err
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{"index": flat}); err != nil {
+		return models.IndexSettingsUpdate{}, err
+	}
+	req := esapi.IndicesPutSettingsRequest{
+		Index: indices,
+		Body:  &buf,
+	}
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		return models.IndexSettingsUpdate{}, transportError("error updating index settings", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return models.IndexSettingsUpdate{}, responseError("error updating index settings", res)
+	}
+	return models.IndexSettingsUpdate{Indices: indices, Settings: flat}, nil
+}
+
+// validateDynamicSettings rejects flattened settings that cannot be changed
+// on a live index.
+func validateDynamicSettings(flat map[string]interface{}) error {
+	var invalid []FieldError
+	for key := range flat {
+		if isDynamicSetting(key) {
+			continue
+		}
+		reason := "setting cannot be changed through this endpoint"
+		if _, static := staticSettings[key]; static || strings.HasPrefix(key, "analysis.") {
+			reason = "static setting, it can only be set when the index is created"
+		}
+		invalid = append(invalid, FieldError{Field: key, Reason: reason})
+	}
+	if len(invalid) > 0 {
+		sort.Slice(invalid, func(i, j int) bool { return invalid[i].Field < invalid[j].Field })
+		return invalidFieldsError("invalid index settings", invalid)
+	}
+	return nil
+}
+
+// logicalIndexGenerations returns every physical index behind the read or
+// write alias of a logical index. Both usually point to the same index; they
+// only differ while a migration is in flight.
+func (es *ElasticsearchClient) logicalIndexGenerations(ctx context.Context, ind models.IndexInfo) ([]string, error) {
+	readIndices, err := es.aliasIndices(ctx, ind.ReadAlias)
+	if err != nil {
+		return nil, err
+	}
+	writeIndices, err := es.aliasIndices(ctx, ind.WriteAlias)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	var indices []string
+	for _, index := range append(readIndices, writeIndices...) {
+		if _, ok := seen[index]; !ok {
+			seen[index] = struct{}{}
+			indices = append(indices, index)
+		}
+	}
+	sort.Strings(indices)
+	return indices, nil
+}
+
+// flattenSettings turns nested settings into dotted keys and drops the
+// optional "index." prefix, so {"index": {"refresh_interval": "1s"}} and
+// {"index.refresh_interval": "1s"} are treated alike.
+func flattenSettings(prefix string, settings map[string]interface{}, out map[string]interface{}) {
+	for key, value := range settings {
+		fullKey := key
+		if prefix != "" {
+			fullKey = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			flattenSettings(fullKey, nested, out)
+			continue
+		}
+		out[strings.TrimPrefix(fullKey, "index.")] = value
+	}
+}
+
+func isDynamicSetting(key string) bool {
+	if _, ok := dynamicSettings[key]; ok {
+		return true
+	}
+	for _, prefix := range dynamicSettingPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"elastic-search-config-service/models"
+	"elastic-search-config-service/store"
+)
+
+// SettingsHistory returns every recorded settings version of a logical
+// index, oldest first.
+func (es *ElasticsearchClient) SettingsHistory(ctx context.Context, ind models.IndexInfo) ([]models.IndexSettingsVersion, error) {
+	rec, err := es.store.Get(ctx, store.CollectionSettingsHistory, ind.IndexName)
+	if errors.Is(err, store.ErrNotFound) {
+		return []models.IndexSettingsVersion{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting settings history: %w", err)
+	}
+	return decodeSettingsHistory(ind.IndexName, rec.Value)
+}
+
+// SettingsDiff compares two settings versions of a logical index. A zero to
+// compares from with the latest version.
+func (es *ElasticsearchClient) SettingsDiff(ctx context.Context, ind models.IndexInfo, from, to int64) (models.IndexSettingsDiff, error) {
+	history, err := es.SettingsHistory(ctx, ind)
+	if err != nil {
+		return models.IndexSettingsDiff{}, err
+	}
+	if to == 0 && len(history) > 0 {
+		to = history[len(history)-1].Version
+	}
+	fromVersion, err := settingsVersion(ind.IndexName, history, from)
+	if err != nil {
+		return models.IndexSettingsDiff{}, err
+	}
+	toVersion, err := settingsVersion(ind.IndexName, history, to)
+	if err != nil {
+		return models.IndexSettingsDiff{}, err
+	}
+	return models.IndexSettingsDiff{
+		IndexName: ind.IndexName,
+		From:      from,
+		To:        to,
+		Changes:   diffSettings(fromVersion.Settings, toVersion.Settings),
+	}, nil
+}
+
+// RestoreSettingsVersion makes an earlier settings version current again.
+// The mapping is migrated to its searchable and facet attributes the same
+// way ChangeMappings does, and the restored settings are recorded as a new
+// version.
+func (es *ElasticsearchClient) RestoreSettingsVersion(ctx context.Context, ind models.IndexInfo, version int64) (models.SettingsRestoreResult, error) {
+	history, err := es.SettingsHistory(ctx, ind)
+	if err != nil {
+		return models.SettingsRestoreResult{}, err
+	}
+	target, err := settingsVersion(ind.IndexName, history, version)
+	if err != nil {
+		return models.SettingsRestoreResult{}, err
+	}
+	current, err := es.GetIndexSettings(ctx, ind)
+	if err != nil {
+		return models.SettingsRestoreResult{}, err
+	}
+
+	var result models.SettingsRestoreResult
+	restored := target.Settings
+	switch {
+	case len(restored.SearchableAttributes) > 0 || len(restored.FacetAttributes) > 0:
+		result.Migration, err = es.remapIndex(ctx, ind, restored, nil)
+		if err != nil {
+			return result, err
+		}
+	case len(current.SearchableAttributes) > 0 || len(current.FacetAttributes) > 0:
+		return result, invalidRequestError(fmt.Sprintf("version %d has no searchable or facet attributes to remap the index to", version))
+	default:
+		result.Migration.Strategy = models.MigrationUnchanged
+	}
+
+	_, recorded, err := es.storeIndexSettings(ctx, ind.IndexName, version, func(s *models.IndexSettings) {
+		*s = restored
+	})
+	if err != nil {
+		return result, err
+	}
+	if recorded.Version == 0 {
+		// Nothing changed, so the latest version already matches.
+		recorded = history[len(history)-1]
+	}
+	result.Version = recorded
+	return result, nil
+}
+
+// errSettingsUnchanged stops recordSettingsVersion from writing a history
+// that already ends with the settings.
+var errSettingsUnchanged = errors.New("settings unchanged")
+
+// recordSettingsVersion appends settings to the history of index when they
+// differ from its latest version. An index whose settings predate the
+// history gets previous recorded first, so it can be restored. Comparing
+// with the history rather than previous records settings whose recording
+// failed the first time once they are saved again.
+func (es *ElasticsearchClient) recordSettingsVersion(ctx context.Context, index string, previous, settings models.IndexSettings, restoredFrom int64) (models.IndexSettingsVersion, error) {
+	var recorded models.IndexSettingsVersion
+	_, err := store.Update(ctx, es.store, store.CollectionSettingsHistory, index, func(current []byte) ([]byte, error) {
+		var history []models.IndexSettingsVersion
+		if current != nil {
+			var err error
+			if history, err = decodeSettingsHistory(index, current); err != nil {
+				return nil, err
+			}
+		}
+		latest := previous
+		if len(history) > 0 {
+			latest = history[len(history)-1].Settings
+		}
+		if len(diffSettings(latest, settings)) == 0 {
+			return nil, errSettingsUnchanged
+		}
+
+		now := time.Now().UTC()
+		if len(history) == 0 && len(diffSettings(models.IndexSettings{}, previous)) > 0 {
+			history = append(history, models.IndexSettingsVersion{Version: 1, Settings: previous, CreatedAt: now})
+		}
+		var last int64
+		if len(history) > 0 {
+			last = history[len(history)-1].Version
+		}
+		recorded = models.IndexSettingsVersion{
+			Version:      last + 1,
+			Settings:     settings,
+			CreatedAt:    now,
+			RestoredFrom: restoredFrom,
+		}
+		return json.Marshal(append(history, recorded))
+	})
+	if errors.Is(err, errSettingsUnchanged) {
+		return models.IndexSettingsVersion{}, nil
+	}
+	if err != nil {
+		return models.IndexSettingsVersion{}, err
+	}
+	return recorded, nil
+}
+
+func decodeSettingsHistory(index string, data []byte) ([]models.IndexSettingsVersion, error) {
+	var history []models.IndexSettingsVersion
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("error decoding settings history of %s: %w", index, err)
+	}
+	return history, nil
+}
+
+func settingsVersion(index string, history []models.IndexSettingsVersion, version int64) (models.IndexSettingsVersion, error) {
+	for _, v := range history {
+		if v.Version == version {
+			return v, nil
+		}
+	}
+	return models.IndexSettingsVersion{}, &Error{
+		Kind:    ErrSettingsVersionNotFound,
+		Message: "settings version " + strconv.FormatInt(version, 10) + " of " + index + " not found",
+	}
+}
+
+// diffSettings lists the attribute entries added and removed going from a
+// to b. Order within a list is not significant.
+func diffSettings(a, b models.IndexSettings) []models.AttributeChange {
+	changes := []models.AttributeChange{}
+	for _, attr := range []struct {
+		name     string
+		from, to []string
+	}{
+		{"searchable_attributes", a.SearchableAttributes, b.SearchableAttributes},
+		{"facet_attributes", a.FacetAttributes, b.FacetAttributes},
+		{"displayed_attributes", a.DisplayedAttributes, b.DisplayedAttributes},
+	} {
+		change := models.AttributeChange{
+			Attribute: attr.name,
+			Added:     missingFrom(attr.from, attr.to),
+			Removed:   missingFrom(attr.to, attr.from),
+		}
+		if len(change.Added) > 0 || len(change.Removed) > 0 {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// missingFrom returns the entries of list that are not in set.
+func missingFrom(set, list []string) []string {
+	present := make(map[string]struct{}, len(set))
+	for _, s := range set {
+		present[s] = struct{}{}
+	}
+	var missing []string
+	for _, s := range list {
+		if _, ok := present[s]; !ok {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
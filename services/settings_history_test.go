@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"elastic-search-config-service/models"
+	"elastic-search-config-service/store"
+)
+
+func newSettingsClient(t *testing.T, s store.ConfigStore) *ElasticsearchClient {
+	t.Helper()
+	es := &ElasticsearchClient{migrations: newMigrationTracker(), settings: newSettingsCache()}
+	es.SetConfigStore(s)
+	return es
+}
+
+func displayed(attributes ...string) func(s *models.IndexSettings) {
+	return func(s *models.IndexSettings) {
+		s.DisplayedAttributes = attributes
+	}
+}
+
+func TestRestoreSettingsVersion(t *testing.T) {
+	ind := models.IndexInfo{IndexName: "products"}
+	tests := []struct {
+		name string
+		// saved are the displayed attributes saved before the restore.
+		saved       [][]string
+		restore     int64
+		wantVersion models.IndexSettingsVersion
+		wantKind    ErrorKind
+		wantErr     bool
+	}{
+		{
+			name:        "earlier version",
+			saved:       [][]string{{"title"}, {"title", "price"}},
+			restore:     1,
+			wantVersion: models.IndexSettingsVersion{Version: 3, Settings: models.IndexSettings{DisplayedAttributes: []string{"title"}}, RestoredFrom: 1},
+		},
+		{
+			name:        "latest version",
+			saved:       [][]string{{"title"}, {"title", "price"}},
+			restore:     2,
+			wantVersion: models.IndexSettingsVersion{Version: 2, Settings: models.IndexSettings{DisplayedAttributes: []string{"title", "price"}}},
+		},
+		{
+			name:     "unknown version",
+			saved:    [][]string{{"title"}},
+			restore:  5,
+			wantErr:  true,
+			wantKind: ErrSettingsVersionNotFound,
+		},
+		{
+			name:     "index without history",
+			restore:  1,
+			wantErr:  true,
+			wantKind: ErrSettingsVersionNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			es := newSettingsClient(t, store.NewFileStore(filepath.Join(t.TempDir(), "config.json")))
+			for _, attributes := range tt.saved {
+				if _, err := es.saveIndexSettings(ctx, ind.IndexName, displayed(attributes...)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result, err := es.RestoreSettingsVersion(ctx, ind, tt.restore)
+			if tt.wantErr {
+				if KindOf(err) != tt.wantKind {
+					t.Fatalf("err = %v, want kind %v", err, tt.wantKind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := result.Version
+			got.CreatedAt = tt.wantVersion.CreatedAt
+			if !reflect.DeepEqual(got, tt.wantVersion) {
+				t.Errorf("version = %+v, want %+v", got, tt.wantVersion)
+			}
+			if result.Migration.Strategy != models.MigrationUnchanged {
+				t.Errorf("migration strategy = %q, want %q", result.Migration.Strategy, models.MigrationUnchanged)
+			}
+			settings, err := es.GetIndexSettings(ctx, ind)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(settings, tt.wantVersion.Settings) {
+				t.Errorf("current settings = %+v, want %+v", settings, tt.wantVersion.Settings)
+			}
+		})
+	}
+}
+
+// failingHistoryStore fails the next failures writes of the settings
+// history.
+type failingHistoryStore struct {
+	store.ConfigStore
+	failures int
+}
+
+func (s *failingHistoryStore) Put(ctx context.Context, collection, key string, value []byte, expectedVersion int64) (int64, error) {
+	if collection == store.CollectionSettingsHistory && s.failures > 0 {
+		s.failures--
+		return 0, errors.New("config store unavailable")
+	}
+	return s.ConfigStore.Put(ctx, collection, key, value, expectedVersion)
+}
+
+func TestSettingsHistoryFailure(t *testing.T) {
+	ctx := context.Background()
+	ind := models.IndexInfo{IndexName: "products"}
+	s := &failingHistoryStore{ConfigStore: store.NewFileStore(filepath.Join(t.TempDir(), "config.json"))}
+	es := newSettingsClient(t, s)
+	if _, err := es.saveIndexSettings(ctx, ind.IndexName, displayed("title")); err != nil {
+		t.Fatal(err)
+	}
+
+	s.failures = 1
+	if _, err := es.saveIndexSettings(ctx, ind.IndexName, displayed("title", "price")); err == nil {
+		t.Fatal("saving settings whose history could not be written succeeded")
+	}
+	history, err := es.SettingsHistory(ctx, ind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("history has %d versions after the failed write, want 1", len(history))
+	}
+
+	// Saving the same settings again records them.
+	if _, err := es.saveIndexSettings(ctx, ind.IndexName, displayed("title", "price")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := es.saveIndexSettings(ctx, ind.IndexName, displayed("title", "price")); err != nil {
+		t.Fatal(err)
+	}
+	if history, err = es.SettingsHistory(ctx, ind); err != nil {
+		t.Fatal(err)
+	}
+	var got [][]string
+	for _, v := range history {
+		got = append(got, v.Settings.DisplayedAttributes)
+	}
+	if want := [][]string{{"title"}, {"title", "price"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("history = %q, want %q", got, want)
+	}
+}
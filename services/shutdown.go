@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"elastic-search-config-service/models"
+	"elastic-search-config-service/store"
+)
+
+// PersistUnfinishedMigrations saves the state of every migration still
+// running into the config store, so that an interrupted reindex and the
+// writes it had journaled can be found after a restart. It returns how many
+// migrations were saved.
+func (es *ElasticsearchClient) PersistUnfinishedMigrations(ctx context.Context) (int, error) {
+	migrations := es.migrations.unfinished(ctx)
+	for _, m := range migrations {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return 0, err
+		}
+		_, err = store.Update(ctx, es.store, store.CollectionMigrations, m.IndexName, func([]byte) ([]byte, error) {
+			return data, nil
+		})
+		if err != nil {
+			return 0, fmt.Errorf("error saving migration state of %s: %w", m.IndexName, err)
+		}
+		if err := es.migrations.abandon(ctx, m.IndexName); err != nil {
+			slog.WarnContext(ctx, "error giving up migration lease", "index", m.IndexName, "error", err)
+		}
+		slog.WarnContext(ctx, "saved unfinished migration", "index", m.IndexName,
+			"source", m.SourceIndex, "target", m.TargetIndex, "journaled", len(m.JournaledIDs))
+	}
+	return len(migrations), nil
+}
+
+// InterruptedMigrations lists the migration states saved by previous
+// shutdowns.
+func (es *ElasticsearchClient) InterruptedMigrations(ctx context.Context) ([]models.InterruptedMigration, error) {
+	records, err := es.store.List(ctx, store.CollectionMigrations)
+	if err != nil {
+		return nil, fmt.Errorf("error loading interrupted migrations from config store: %w", err)
+	}
+	migrations := make([]models.InterruptedMigration, 0, len(records))
+	for _, rec := range records {
+		var m models.InterruptedMigration
+		if err := json.Unmarshal(rec.Value, &m); err != nil {
+			return nil, fmt.Errorf("error decoding interrupted migration %s: %w", rec.Key, err)
+		}
+		migrations = append(migrations, m)
+	}
+	return migrations, nil
+}
+
+// CleanupAbandonedMigrations removes what migrations that stopped without
+// finishing left behind: the new generation they were creating, unless
+// aliases already point to it, their lease, their journal and their saved
+// state. Migrations whose lease still receives heartbeats are running on
+// another replica and left alone. Such a migration can simply be started
+// again. It returns how many migrations were cleaned up.
+func (es *ElasticsearchClient) CleanupAbandonedMigrations(ctx context.Context, interrupted []models.InterruptedMigration) (int, error) {
+	expired, live, err := es.migrations.expiredLeases(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	cleaned := make(map[string]struct{})
+	for index, rec := range expired {
+		var lease migrationLease
+		if err := json.Unmarshal(rec.Value, &lease); err != nil {
+			return 0, fmt.Errorf("error decoding migration lease of %s: %w", index, err)
+		}
+		es.dropUnusedGeneration(ctx, lease.Target)
+		if err := es.migrations.clear(ctx, index, rec.Version); err != nil {
+			return len(cleaned), fmt.Errorf("error clearing abandoned migration of %s: %w", index, err)
+		}
+		slog.WarnContext(ctx, "cleaned up abandoned migration", "index", index, "owner", lease.Owner, "target", lease.Target)
+		cleaned[index] = struct{}{}
+	}
+
+	for _, m := range interrupted {
+		if _, running := live[m.IndexName]; running {
+			continue
+		}
+		es.dropUnusedGeneration(ctx, m.TargetIndex)
+		rec, err := es.store.Get(ctx, store.CollectionMigrations, m.IndexName)
+		if err == nil {
+			err = es.store.Delete(ctx, store.CollectionMigrations, m.IndexName, rec.Version)
+		}
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return len(cleaned), fmt.Errorf("error clearing interrupted migration of %s: %w", m.IndexName, err)
+		}
+		cleaned[m.IndexName] = struct{}{}
+	}
+	return len(cleaned), nil
+}
+
+// clearInterruptedMigration drops the saved state of an interrupted migration
+// of index once a later migration has completed.
+func (es *ElasticsearchClient) clearInterruptedMigration(ctx context.Context, index string) {
+	rec, err := es.store.Get(ctx, store.CollectionMigrations, index)
+	if errors.Is(err, store.ErrNotFound) {
+		return
+	}
+	if err == nil {
+		err = es.store.Delete(ctx, store.CollectionMigrations, index, rec.Version)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "error clearing interrupted migration", "index", index, "error", err)
+		return
+	}
+	es.updateBootstrap(func(r *BootstrapReport) {
+		kept := r.InterruptedMigrations[:0]
+		for _, m := range r.InterruptedMigrations {
+			if m.IndexName != index {
+				kept = append(kept, m)
+			}
+		}
+		r.InterruptedMigrations = kept
+	})
+}
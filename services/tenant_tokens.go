@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"elastic-search-config-service/models"
+	"elastic-search-config-service/store"
+)
+
+// tenantTokenHeader is the JOSE header of every tenant token: a JWT signed
+// with HMAC-SHA256.
+var tenantTokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// SetTenantTokenSecret sets the HMAC secret tenant tokens are signed with.
+// Backends holding the secret can mint tokens themselves. An empty secret
+// disables tenant tokens.
+func (es *ElasticsearchClient) SetTenantTokenSecret(secret string) {
+	es.tenantSecret = []byte(secret)
+}
+
+// MintTenantToken signs a token restricted to req.Indices and req.Filter.
+// Every index the requested patterns can match must be searchable with key.
+func (es *ElasticsearchClient) MintTenantToken(ctx context.Context, req models.CreateTenantTokenRequest, key models.APIKey) (models.TenantToken, error) {
+	if len(es.tenantSecret) == 0 {
+		return models.TenantToken{}, invalidRequestError("tenant tokens are not enabled")
+	}
+
+	var invalid []FieldError
+	if len(req.Indices) == 0 {
+		invalid = append(invalid, FieldError{Field: "indices", Reason: "must not be empty"})
+	}
+	for _, pattern := range req.Indices {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			invalid = append(invalid, FieldError{Field: "indices", Reason: "invalid index pattern " + pattern})
+			continue
+		}
+		if !key.AllowsPattern(models.ActionSearch, pattern) {
+			invalid = append(invalid, FieldError{Field: "indices", Reason: "api key may not search " + pattern})
+		}
+	}
+	if len(req.Filter) == 0 {
+		invalid = append(invalid, FieldError{Field: "filter", Reason: "must not be empty"})
+	}
+	if !req.ExpiresAt.After(time.Now()) {
+		invalid = append(invalid, FieldError{Field: "expires_at", Reason: "must be in the future"})
+	}
+	if len(invalid) > 0 {
+		return models.TenantToken{}, &Error{Kind: ErrInvalidRequest, Message: "invalid tenant token", Fields: invalid}
+	}
+
+	claims := models.TenantTokenClaims{
+		Indices:     req.Indices,
+		Filter:      req.Filter,
+		FieldAccess: key.FieldAccess,
+		APIKeyID:    key.ID,
+		IssuedAt:    time.Now().Unix(),
+		ExpiresAt:   req.ExpiresAt.Unix(),
+	}
+	if key.ID == AdminAPIKeyID {
+		claims.APIKeyID = ""
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return models.TenantToken{}, err
+	}
+	signingInput := tenantTokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return models.TenantToken{
+		Token:     signingInput + "." + es.signTenantToken(signingInput),
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC(),
+	}, nil
+}
+
+func (es *ElasticsearchClient) signTenantToken(signingInput string) string {
+	mac := hmac.New(sha256.New, es.tenantSecret)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// AuthenticateTenantToken checks the signature and expiry of a tenant token
+// and that the key it was minted with is still active. ok is false for
+// invalid tokens; err is only set when the config store could not be read.
+func (es *ElasticsearchClient) AuthenticateTenantToken(ctx context.Context, token string) (models.TenantTokenClaims, bool, error) {
+	if len(es.tenantSecret) == 0 {
+		return models.TenantTokenClaims{}, false, nil
+	}
+	header, rest, ok := strings.Cut(token, ".")
+	if !ok || header != tenantTokenHeader {
+		return models.TenantTokenClaims{}, false, nil
+	}
+	payload, signature, ok := strings.Cut(rest, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(es.signTenantToken(header+"."+payload))) {
+		return models.TenantTokenClaims{}, false, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return models.TenantTokenClaims{}, false, nil
+	}
+	var claims models.TenantTokenClaims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return models.TenantTokenClaims{}, false, nil
+	}
+	if len(claims.Filter) == 0 || time.Now().Unix() >= claims.ExpiresAt {
+		return models.TenantTokenClaims{}, false, nil
+	}
+
+	if claims.APIKeyID != "" {
+		cached, err := es.cachedAPIKey(ctx, claims.APIKeyID)
+		if errors.Is(err, store.ErrNotFound) {
+			return models.TenantTokenClaims{}, false, nil
+		}
+		if err != nil {
+			return models.TenantTokenClaims{}, false, err
+		}
+		if !cached.key.Active(time.Now()) {
+			return models.TenantTokenClaims{}, false, nil
+		}
+	}
+	return claims, true, nil
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"elastic-search-config-service/models"
+	"elastic-search-config-service/store"
+)
+
+func newTenantTokenClient(t *testing.T, secret string) *ElasticsearchClient {
+	t.Helper()
+	es := &ElasticsearchClient{apiKeys: newAPIKeyring(), migrations: newMigrationTracker()}
+	es.SetConfigStore(store.NewFileStore(filepath.Join(t.TempDir(), "config.json")))
+	es.SetTenantTokenSecret(secret)
+	return es
+}
+
+// signedTenantToken signs claims the way MintTenantToken does, without its
+// checks.
+func signedTenantToken(t *testing.T, es *ElasticsearchClient, claims models.TenantTokenClaims) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingInput := tenantTokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + es.signTenantToken(signingInput)
+}
+
+func storeAPIKey(t *testing.T, es *ElasticsearchClient, key models.APIKey) {
+	t.Helper()
+	value, err := json.Marshal(storedAPIKey{APIKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := es.store.Put(context.Background(), store.CollectionAPIKeys, key.ID, value, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthenticateTenantToken(t *testing.T) {
+	var filter models.Filter
+	if err := json.Unmarshal([]byte(`[{"field":"tenant","values":["acme"]}]`), &filter); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	revokedAt := now.Add(-time.Minute)
+	claims := func(keyID string, expiresAt time.Time) models.TenantTokenClaims {
+		return models.TenantTokenClaims{
+			Indices:   []string{"products"},
+			Filter:    filter,
+			APIKeyID:  keyID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: expiresAt.Unix(),
+		}
+	}
+
+	es := newTenantTokenClient(t, "secret")
+	other := newTenantTokenClient(t, "other secret")
+	disabled := newTenantTokenClient(t, "")
+	storeAPIKey(t, es, models.APIKey{ID: "active", Actions: []string{models.ActionSearch}, Indices: []string{"*"}})
+	storeAPIKey(t, es, models.APIKey{ID: "revoked", Actions: []string{models.ActionSearch}, Indices: []string{"*"}, RevokedAt: &revokedAt})
+
+	valid := signedTenantToken(t, es, claims("", now.Add(time.Hour)))
+	header, rest, _ := strings.Cut(valid, ".")
+	payload, signature, _ := strings.Cut(rest, ".")
+	widened := claims("", now.Add(time.Hour))
+	widened.Indices = []string{"*"}
+	widenedPayload, _ := json.Marshal(widened)
+	withoutFilter := claims("", now.Add(time.Hour))
+	withoutFilter.Filter = nil
+
+	tests := []struct {
+		name   string
+		client *ElasticsearchClient
+		token  string
+		wantOK bool
+	}{
+		{name: "valid token", client: es, token: valid, wantOK: true},
+		{name: "token of an active key", client: es, token: signedTenantToken(t, es, claims("active", now.Add(time.Hour))), wantOK: true},
+		{name: "token of a revoked key", client: es, token: signedTenantToken(t, es, claims("revoked", now.Add(time.Hour)))},
+		{name: "token of a deleted key", client: es, token: signedTenantToken(t, es, claims("deleted", now.Add(time.Hour)))},
+		{name: "expired token", client: es, token: signedTenantToken(t, es, claims("", now.Add(-time.Second)))},
+		{name: "token without filter", client: es, token: signedTenantToken(t, es, withoutFilter)},
+		{name: "payload changed after signing", client: es, token: header + "." + base64.RawURLEncoding.EncodeToString(widenedPayload) + "." + signature},
+		{name: "signature removed", client: es, token: header + "." + payload},
+		{name: "other header", client: es, token: base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + payload + "." + signature},
+		{name: "signed with another secret", client: es, token: signedTenantToken(t, other, claims("", now.Add(time.Hour)))},
+		{name: "tenant tokens disabled", client: disabled, token: valid},
+		{name: "not a token", client: es, token: "garbage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := tt.client.AuthenticateTenantToken(context.Background(), tt.token)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && !got.Allows("products") {
+				t.Errorf("claims %+v do not allow products", got)
+			}
+		})
+	}
+}
+
+func TestMintTenantToken(t *testing.T) {
+	var filter models.Filter
+	if err := json.Unmarshal([]byte(`[{"field":"tenant","values":["acme"]}]`), &filter); err != nil {
+		t.Fatal(err)
+	}
+	key := models.APIKey{ID: "products", Actions: []string{models.ActionSearch}, Indices: []string{"products_*"}}
+	es := newTenantTokenClient(t, "secret")
+	storeAPIKey(t, es, key)
+	expiresAt := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		client  *ElasticsearchClient
+		req     models.CreateTenantTokenRequest
+		wantErr bool
+	}{
+		{name: "indices covered by the key", client: es, req: models.CreateTenantTokenRequest{Indices: []string{"products_eu", "products_us_*"}, Filter: filter, ExpiresAt: expiresAt}},
+		{name: "pattern wider than the key", client: es, req: models.CreateTenantTokenRequest{Indices: []string{"prod*"}, Filter: filter, ExpiresAt: expiresAt}, wantErr: true},
+		{name: "index outside the key", client: es, req: models.CreateTenantTokenRequest{Indices: []string{"orders"}, Filter: filter, ExpiresAt: expiresAt}, wantErr: true},
+		{name: "invalid pattern", client: es, req: models.CreateTenantTokenRequest{Indices: []string{"products_["}, Filter: filter, ExpiresAt: expiresAt}, wantErr: true},
+		{name: "no filter", client: es, req: models.CreateTenantTokenRequest{Indices: []string{"products_eu"}, ExpiresAt: expiresAt}, wantErr: true},
+		{name: "already expired", client: es, req: models.CreateTenantTokenRequest{Indices: []string{"products_eu"}, Filter: filter, ExpiresAt: time.Now().Add(-time.Minute)}, wantErr: true},
+		{name: "tenant tokens disabled", client: newTenantTokenClient(t, ""), req: models.CreateTenantTokenRequest{Indices: []string{"products_eu"}, Filter: filter, ExpiresAt: expiresAt}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tt.client.MintTenantToken(context.Background(), tt.req, key)
+			if tt.wantErr {
+				if KindOf(err) != ErrInvalidRequest {
+					t.Fatalf("err = %v, want an invalid request", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, ok, err := tt.client.AuthenticateTenantToken(context.Background(), token.Token)
+			if err != nil || !ok {
+				t.Fatalf("minted token does not verify: ok = %v, err = %v", ok, err)
+			}
+			if claims.APIKeyID != key.ID || !claims.Allows(tt.req.Indices[0]) {
+				t.Errorf("claims = %+v, want key %s allowing %s", claims, key.ID, tt.req.Indices[0])
+			}
+		})
+	}
+}
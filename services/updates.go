@@ -0,0 +1,252 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"elastic-search-config-service/models"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+var numericTypes = map[string]struct{}{
+	"long": {}, "integer": {}, "short": {}, "byte": {}, "unsigned_long": {},
+	"double": {}, "float": {}, "half_float": {}, "scaled_float": {},
+}
+
+// ScriptUpdateDocument applies update to a single document with the managed
+// script for its operation. A result of "noop" means nothing matched.
+func (es *ElasticsearchClient) ScriptUpdateDocument(ctx context.Context, ind models.IndexInfo, id string, update models.FieldUpdate, cond models.WriteCondition) (models.DocumentWriteResult, error) {
+	script, err := es.updateScript(ctx, ind, update)
+	if err != nil {
+		return models.DocumentWriteResult{}, err
+	}
+
+	done, err := es.migrations.beginWrite(ctx, ind.IndexName, id)
+	if err != nil {
+		return models.DocumentWriteResult{}, err
+	}
+	defer done()
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{"script": script}); err != nil {
+		return models.DocumentWriteResult{}, err
+	}
+	req := esapi.UpdateRequest{
+		Index:      ind.WriteAlias,
+		DocumentID: id,
+		Body:       &buf,
+		Refresh:    "true",
+	}
+	if cond.IfMatch != nil {
+		req.IfSeqNo = &cond.IfMatch.SeqNo
+		req.IfPrimaryTerm = &cond.IfMatch.PrimaryTerm
+	}
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		return models.DocumentWriteResult{}, transportError("error updating document", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return models.DocumentWriteResult{}, documentError("error updating document", id, res)
+	}
+
+	var writeResponse documentWriteResponse
+	if err := json.NewDecoder(res.Body).Decode(&writeResponse); err != nil {
+		return models.DocumentWriteResult{}, err
+	}
+	return writeResponse.toResult(), nil
+}
+
+// UpdateDocumentsByQuery applies update to every document matching filter.
+// Like DeleteDocumentsByQuery it is refused while a migration runs.
+func (es *ElasticsearchClient) UpdateDocumentsByQuery(ctx context.Context, ind models.IndexInfo, filter models.Filter, update models.FieldUpdate) (models.UpdateByQueryResponse, error) {
+	if len(filter) == 0 {
+		return models.UpdateByQueryResponse{}, invalidRequestError("filter must not be empty")
+	}
+	script, err := es.updateScript(ctx, ind, update)
+	if err != nil {
+		return models.UpdateByQueryResponse{}, err
+	}
+
+	done, err := es.migrations.beginQueryWrite(ctx, ind.IndexName)
+	if err != nil {
+		return models.UpdateByQueryResponse{}, err
+	}
+	defer done()
+
+	query, err := es.filterQuery(ctx, ind, filter)
+	if err != nil {
+		return models.UpdateByQueryResponse{}, err
+	}
+	var buf bytes.Buffer
+	body := map[string]interface{}{
+		"query":  query,
+		"script": script,
+	}
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return models.UpdateByQueryResponse{}, err
+	}
+	refresh := true
+	req := esapi.UpdateByQueryRequest{
+		Index:     []string{ind.WriteAlias},
+		Body:      &buf,
+		Conflicts: "proceed",
+		Refresh:   &refresh,
+	}
+	res, err := req.Do(ctx, es.transport)
+	if err != nil {
+		return models.UpdateByQueryResponse{}, transportError("error updating documents by query", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return models.UpdateByQueryResponse{}, responseError("error updating documents by query", res)
+	}
+
+	var updateResponse struct {
+		Updated          int64 `json:"updated"`
+		Noops            int64 `json:"noops"`
+		VersionConflicts int64 `json:"version_conflicts"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&updateResponse); err != nil {
+		return models.UpdateByQueryResponse{}, err
+	}
+	return models.UpdateByQueryResponse{
+		Updated:          updateResponse.Updated,
+		Noops:            updateResponse.Noops,
+		VersionConflicts: updateResponse.VersionConflicts,
+	}, nil
+}
+
+// updateScript validates update against the index mapping and returns the
+// stored script reference with its parameters.
+func (es *ElasticsearchClient) updateScript(ctx context.Context, ind models.IndexInfo, update models.FieldUpdate) (map[string]interface{}, error) {
+	qb, err := es.GetMappingBuilder(ctx, ind)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateFieldUpdate(&qb, update); err != nil {
+		return nil, err
+	}
+	id, err := es.ensureScript(ctx, update.Op)
+	if err != nil {
+		return nil, err
+	}
+
+	params := map[string]interface{}{
+		"path": strings.Split(update.Path, "."),
+	}
+	switch update.Op {
+	case models.UpdateOpAppend:
+		params["item"] = update.Item
+	case models.UpdateOpRemove:
+		params["where"] = update.Where
+	case models.UpdateOpModify:
+		params["where"] = update.Where
+		params["set"] = update.Set
+	case models.UpdateOpIncrement:
+		params["by"] = update.By
+		if len(update.Where) > 0 {
+			params["where"] = update.Where
+			params["field"] = update.Field
+		} else {
+			params["where"] = nil
+		}
+	}
+	return map[string]interface{}{
+		"id":     id,
+		"params": params,
+	}, nil
+}
+
+func validateFieldUpdate(qb *models.QueryBuilder, update models.FieldUpdate) error {
+	if _, ok := scriptSources[update.Op]; !ok {
+		return invalidRequestError("op must be one of append, remove, modify or increment")
+	}
+	if update.Path == "" {
+		return invalidRequestError("path must not be empty")
+	}
+
+	var invalid []FieldError
+	requireObject := func() {
+		if !hasChildFields(qb, update.Path) {
+			invalid = append(invalid, FieldError{Field: update.Path, Reason: "not an object or nested field in index mapping"})
+		}
+	}
+	requireChildren := func(fields map[string]interface{}) {
+		for _, name := range sortedKeys(fields) {
+			path := update.Path + "." + name
+			if _, ok := qb.FieldMappings[path]; !ok && !hasChildFields(qb, path) {
+				invalid = append(invalid, FieldError{Field: path, Reason: "field does not exist in index mapping"})
+			}
+		}
+	}
+	requireNumber := func(path string) {
+		mapping, ok := qb.FieldMappings[path]
+		if !ok {
+			invalid = append(invalid, FieldError{Field: path, Reason: "field does not exist in index mapping"})
+			return
+		}
+		if len(mapping.DataType) == 0 {
+			invalid = append(invalid, FieldError{Field: path, Reason: "not a numeric field"})
+			return
+		}
+		if _, numeric := numericTypes[mapping.DataType[0]]; !numeric {
+			invalid = append(invalid, FieldError{Field: path, Reason: "not a numeric field"})
+		}
+	}
+
+	switch update.Op {
+	case models.UpdateOpAppend:
+		if len(update.Item) == 0 {
+			return invalidRequestError("item must not be empty")
+		}
+		requireObject()
+	case models.UpdateOpRemove:
+		if len(update.Where) == 0 {
+			return invalidRequestError("where must not be empty")
+		}
+		requireObject()
+		requireChildren(update.Where)
+	case models.UpdateOpModify:
+		if len(update.Where) == 0 || len(update.Set) == 0 {
+			return invalidRequestError("where and set must not be empty")
+		}
+		requireObject()
+		requireChildren(update.Where)
+		requireChildren(update.Set)
+	case models.UpdateOpIncrement:
+		if update.By == 0 {
+			return invalidRequestError("by must not be zero")
+		}
+		if len(update.Where) == 0 {
+			requireNumber(update.Path)
+			break
+		}
+		if update.Field == "" {
+			return invalidRequestError("field is required when where is given")
+		}
+		requireObject()
+		requireChildren(update.Where)
+		requireNumber(update.Path + "." + update.Field)
+	}
+
+	if len(invalid) > 0 {
+		sort.Slice(invalid, func(i, j int) bool { return invalid[i].Field < invalid[j].Field })
+		return invalidFieldsError("invalid update", invalid)
+	}
+	return nil
+}
+
+// hasChildFields reports whether any mapped field lives under path.
+func hasChildFields(qb *models.QueryBuilder, path string) bool {
+	for field := range qb.FieldMappings {
+		if strings.HasPrefix(field, path+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package store
+
+import (
+	"context"
+
+	"elastic-search-config-service/models"
+)
+
+const (
+	// DefaultAuditIndex is the hidden system index used by ElasticsearchAuditLog.
+	DefaultAuditIndex = ".config-service-audit"
+	// DefaultAuditLimit and MaxAuditLimit bound how many entries Query returns.
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 1000
+)
+
+// AuditLog is an append-only record of configuration changes. Entries can be
+// added and queried but never changed or removed through it.
+type AuditLog interface {
+	Append(ctx context.Context, entry models.AuditEntry) error
+	// Query returns the newest entries matching q first.
+	Query(ctx context.Context, q models.AuditQuery) ([]models.AuditEntry, error)
+	Close() error
+}
+
+func auditLimit(q models.AuditQuery) int {
+	switch {
+	case q.Limit <= 0:
+		return DefaultAuditLimit
+	case q.Limit > MaxAuditLimit:
+		return MaxAuditLimit
+	default:
+		return q.Limit
+	}
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"elastic-search-config-service/models"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// ElasticsearchAuditLog keeps audit entries as documents in a system index.
+// Entries are only ever created, never updated.
+type ElasticsearchAuditLog struct {
+	transport esapi.Transport
+	index     string
+}
+
+// NewElasticsearchAuditLog returns an audit log writing to index, creating
+// the index with a fixed mapping if it does not exist yet.
+func NewElasticsearchAuditLog(ctx context.Context, transport esapi.Transport, index string) (*ElasticsearchAuditLog, error) {
+	l := &ElasticsearchAuditLog{transport: transport, index: index}
+	if err := l.ensureIndex(ctx); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *ElasticsearchAuditLog) ensureIndex(ctx context.Context) error {
+	body := `{
+		"settings": {"index": {"hidden": true, "number_of_shards": 1}},
+		"mappings": {
+			"dynamic": false,
+			"properties": {
+				"id":         {"type": "keyword"},
+				"time":       {"type": "date"},
+				"actor":      {"type": "keyword"},
+				"request_id": {"type": "keyword"},
+				"operation":  {"type": "keyword"},
+				"index":      {"type": "keyword"},
+				"request":    {"type": "object", "enabled": false},
+				"before":     {"type": "object", "enabled": false},
+				"after":      {"type": "object", "enabled": false},
+				"outcome":    {"type": "keyword"},
+				"status":     {"type": "integer"},
+				"error":      {"type": "text"}
+			}
+		}
+	}`
+	req := esapi.IndicesCreateRequest{
+		Index: l.index,
+		Body:  strings.NewReader(body),
+	}
+	res, err := req.Do(ctx, l.transport)
+	if err != nil {
+		return fmt.Errorf("error creating audit index: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() && !strings.Contains(readBody(res), "resource_already_exists_exception") {
+		return fmt.Errorf("error creating audit index: %s", res.Status())
+	}
+	return nil
+}
+
+func (l *ElasticsearchAuditLog) Append(ctx context.Context, entry models.AuditEntry) error {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	req := esapi.IndexRequest{
+		Index:      l.index,
+		DocumentID: entry.ID,
+		OpType:     "create",
+		Body:       bytes.NewReader(body),
+		Refresh:    "wait_for",
+	}
+	res, err := req.Do(ctx, l.transport)
+	if err != nil {
+		return fmt.Errorf("error writing audit entry: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("error writing audit entry: %s", readBody(res))
+	}
+	return nil
+}
+
+func (l *ElasticsearchAuditLog) Query(ctx context.Context, q models.AuditQuery) ([]models.AuditEntry, error) {
+	filters := []interface{}{}
+	for field, value := range map[string]string{"index": q.Index, "actor": q.Actor, "operation": q.Operation} {
+		if value != "" {
+			filters = append(filters, map[string]interface{}{"term": map[string]interface{}{field: value}})
+		}
+	}
+	if !q.From.IsZero() || !q.To.IsZero() {
+		bounds := map[string]interface{}{}
+		if !q.From.IsZero() {
+			bounds["gte"] = q.From.Format(time.RFC3339Nano)
+		}
+		if !q.To.IsZero() {
+			bounds["lte"] = q.To.Format(time.RFC3339Nano)
+		}
+		filters = append(filters, map[string]interface{}{"range": map[string]interface{}{"time": bounds}})
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"size":  auditLimit(q),
+		"query": map[string]interface{}{"bool": map[string]interface{}{"filter": filters}},
+		"sort":  []interface{}{map[string]interface{}{"time": "desc"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req := esapi.SearchRequest{
+		Index: []string{l.index},
+		Body:  bytes.NewReader(body),
+	}
+	res, err := req.Do(ctx, l.transport)
+	if err != nil {
+		return nil, fmt.Errorf("error querying audit log: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return []models.AuditEntry{}, nil
+	}
+	if res.IsError() {
+		return nil, fmt.Errorf("error querying audit log: %s", readBody(res))
+	}
+
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				Source models.AuditEntry `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, err
+	}
+	entries := make([]models.AuditEntry, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		entries = append(entries, hit.Source)
+	}
+	return entries, nil
+}
+
+func (l *ElasticsearchAuditLog) Close() error {
+	return nil
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"elastic-search-config-service/models"
+)
+
+// maxAuditLineSize bounds a single entry of the audit file.
+const maxAuditLineSize = 16 << 20
+
+// FileAuditLog appends one JSON entry per line to a file. Each entry is
+// written with a single append, so several processes on the same host can
+// share the file.
+type FileAuditLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileAuditLog returns an audit log backed by path, created on the first
+// append.
+func NewFileAuditLog(path string) *FileAuditLog {
+	return &FileAuditLog{path: path}
+}
+
+func (l *FileAuditLog) Append(ctx context.Context, entry models.AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %w", err)
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+	return nil
+}
+
+// Query scans the file keeping only the newest matching entries, so memory
+// stays bounded by the limit of q. Lines that cannot be decoded, such as one
+// cut short by a crash during an append, are skipped and reported in the log.
+func (l *FileAuditLog) Query(ctx context.Context, q models.AuditQuery) ([]models.AuditEntry, error) {
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return []models.AuditEntry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log: %w", err)
+	}
+	defer f.Close()
+
+	newest := &auditHeap{}
+	limit := auditLimit(q)
+	skipped := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxAuditLineSize)
+	for line := 0; scanner.Scan(); line++ {
+		var entry models.AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			skipped++
+			continue
+		}
+		if !q.Matches(entry) {
+			continue
+		}
+		heap.Push(newest, auditLine{entry: entry, line: line})
+		if newest.Len() > limit {
+			heap.Pop(newest)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading audit log: %w", err)
+	}
+	if skipped > 0 {
+		slog.WarnContext(ctx, "skipped undecodable audit log lines", "path", l.path, "lines", skipped)
+	}
+
+	entries := make([]models.AuditEntry, newest.Len())
+	for i := len(entries) - 1; i >= 0; i-- {
+		entries[i] = heap.Pop(newest).(auditLine).entry
+	}
+	return entries, nil
+}
+
+// auditLine is a matching entry with its position in the file. Among entries
+// logged at the same time, the one appended last is the newest.
+type auditLine struct {
+	entry models.AuditEntry
+	line  int
+}
+
+// auditHeap is a min-heap whose root is the entry listed last: the oldest,
+// or the one furthest up the file among entries logged at the same time.
+type auditHeap []auditLine
+
+func (h auditHeap) Len() int { return len(h) }
+
+func (h auditHeap) Less(i, j int) bool {
+	if !h[i].entry.Time.Equal(h[j].entry.Time) {
+		return h[i].entry.Time.Before(h[j].entry.Time)
+	}
+	return h[i].line < h[j].line
+}
+
+func (h auditHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *auditHeap) Push(x any) { *h = append(*h, x.(auditLine)) }
+
+func (h *auditHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+func (l *FileAuditLog) Close() error {
+	return nil
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"elastic-search-config-service/models"
+)
+
+func TestFileAuditLogQuery(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log := NewFileAuditLog(path)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Entries are appended out of time order, with a tie at base+2m, and a
+	// line cut short by a crash in the middle of the file.
+	entries := []models.AuditEntry{
+		{ID: "a", Time: base.Add(1 * time.Minute), Index: "products"},
+		{ID: "b", Time: base.Add(3 * time.Minute), Index: "orders"},
+		{ID: "c", Time: base.Add(2 * time.Minute), Index: "products"},
+		{ID: "d", Time: base, Index: "products"},
+		{ID: "e", Time: base.Add(2 * time.Minute), Index: "products"},
+		{ID: "f", Time: base.Add(4 * time.Minute), Index: "products"},
+	}
+	for i, entry := range entries {
+		if i == 3 {
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.WriteString(`{"id":"torn","time":"2026-01-01T00:0` + "\n"); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+		}
+		if err := log.Append(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query models.AuditQuery
+		want  []string
+	}{
+		{name: "newest first", query: models.AuditQuery{}, want: []string{"f", "b", "e", "c", "a", "d"}},
+		{name: "limit keeps the newest", query: models.AuditQuery{Limit: 3}, want: []string{"f", "b", "e"}},
+		{name: "limit splits a tie", query: models.AuditQuery{Limit: 3, Index: "products"}, want: []string{"f", "e", "c"}},
+		{name: "time range", query: models.AuditQuery{From: base.Add(time.Minute), To: base.Add(2 * time.Minute)}, want: []string{"e", "c", "a"}},
+		{name: "no match", query: models.AuditQuery{Actor: "nobody"}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := log.Query(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, entry := range got {
+				ids = append(ids, entry.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("entries = %q, want %q", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileAuditLogQueryMissingFile(t *testing.T) {
+	log := NewFileAuditLog(filepath.Join(t.TempDir(), "audit.log"))
+	got, err := log.Query(context.Background(), models.AuditQuery{})
+	if err != nil || got == nil || len(got) != 0 {
+		t.Errorf("Query = %v, %v, want no entries", got, err)
+	}
+}
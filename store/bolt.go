@@ -0,0 +1,125 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltStore keeps configuration in an embedded bbolt database with one bucket
+// per collection. bbolt takes an exclusive lock on the file, so it suits a
+// single instance; replicas that need to share state should use
+// ElasticsearchStore instead.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens (or creates) the database at path.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening config store: %w", err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Get(ctx context.Context, collection, key string) (Record, error) {
+	var rec Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(collection))
+		if b == nil {
+			return notFound(collection, key)
+		}
+		data := b.Get([]byte(key))
+		if data == nil {
+			return notFound(collection, key)
+		}
+		return json.Unmarshal(data, &rec)
+	})
+	return rec, err
+}
+
+func (s *BoltStore) List(ctx context.Context, collection string) ([]Record, error) {
+	return s.ListPrefix(ctx, collection, "")
+}
+
+func (s *BoltStore) ListPrefix(ctx context.Context, collection, prefix string) ([]Record, error) {
+	var records []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(collection))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+			var rec Record
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			records = append(records, rec)
+		}
+		return nil
+	})
+	return records, err
+}
+
+func (s *BoltStore) Put(ctx context.Context, collection, key string, value []byte, expectedVersion int64) (int64, error) {
+	var version int64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(collection))
+		if err != nil {
+			return err
+		}
+		var current Record
+		if data := b.Get([]byte(key)); data != nil {
+			if err := json.Unmarshal(data, &current); err != nil {
+				return err
+			}
+		}
+		if current.Version != expectedVersion {
+			return versionConflict(collection, key, expectedVersion, current.Version)
+		}
+		version = current.Version + 1
+		data, err := json.Marshal(Record{
+			Collection: collection,
+			Key:        key,
+			Value:      json.RawMessage(value),
+			Version:    version,
+			UpdatedAt:  time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+	return version, err
+}
+
+func (s *BoltStore) Delete(ctx context.Context, collection, key string, expectedVersion int64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(collection))
+		if b == nil {
+			return notFound(collection, key)
+		}
+		data := b.Get([]byte(key))
+		if data == nil {
+			return notFound(collection, key)
+		}
+		var current Record
+		if err := json.Unmarshal(data, &current); err != nil {
+			return err
+		}
+		if current.Version != expectedVersion {
+			return versionConflict(collection, key, expectedVersion, current.Version)
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,273 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// DefaultConfigIndex is the hidden system index used by ElasticsearchStore.
+const DefaultConfigIndex = ".config-service"
+
+// listPageSize is how many records List and ListPrefix fetch per search
+// request; they page through the collection until every record was read.
+const listPageSize = 1000
+
+// ElasticsearchStore keeps configuration as documents in a system index of
+// the cluster the service already talks to. Concurrency control relies on
+// the _seq_no/_primary_term of each document, so any number of replicas can
+// share it.
+type ElasticsearchStore struct {
+	transport esapi.Transport
+	index     string
+}
+
+type esRecord struct {
+	Record
+	seqNo       int
+	primaryTerm int
+}
+
+// NewElasticsearchStore returns a store writing to index, creating the index
+// with a fixed mapping if it does not exist yet.
+func NewElasticsearchStore(ctx context.Context, transport esapi.Transport, index string) (*ElasticsearchStore, error) {
+	s := &ElasticsearchStore{transport: transport, index: index}
+	if err := s.ensureIndex(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *ElasticsearchStore) ensureIndex(ctx context.Context) error {
+	body := `{
+		"settings": {"index": {"hidden": true, "number_of_shards": 1}},
+		"mappings": {
+			"dynamic": false,
+			"properties": {
+				"collection": {"type": "keyword"},
+				"key":        {"type": "keyword"},
+				"value":      {"type": "object", "enabled": false},
+				"version":    {"type": "long"},
+				"updated_at": {"type": "date"}
+			}
+		}
+	}`
+	req := esapi.IndicesCreateRequest{
+		Index: s.index,
+		Body:  strings.NewReader(body),
+	}
+	res, err := req.Do(ctx, s.transport)
+	if err != nil {
+		return fmt.Errorf("error creating config index: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() && !strings.Contains(readBody(res), "resource_already_exists_exception") {
+		return fmt.Errorf("error creating config index: %s", res.Status())
+	}
+	return nil
+}
+
+func (s *ElasticsearchStore) Get(ctx context.Context, collection, key string) (Record, error) {
+	rec, err := s.get(ctx, collection, key)
+	return rec.Record, err
+}
+
+func (s *ElasticsearchStore) get(ctx context.Context, collection, key string) (esRecord, error) {
+	req := esapi.GetRequest{
+		Index:      s.index,
+		DocumentID: documentID(collection, key),
+	}
+	res, err := req.Do(ctx, s.transport)
+	if err != nil {
+		return esRecord{}, fmt.Errorf("error reading config record: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return esRecord{}, notFound(collection, key)
+	}
+	if res.IsError() {
+		return esRecord{}, fmt.Errorf("error reading config record: %s", readBody(res))
+	}
+
+	var doc struct {
+		SeqNo       int    `json:"_seq_no"`
+		PrimaryTerm int    `json:"_primary_term"`
+		Source      Record `json:"_source"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		return esRecord{}, err
+	}
+	return esRecord{Record: doc.Source, seqNo: doc.SeqNo, primaryTerm: doc.PrimaryTerm}, nil
+}
+
+func (s *ElasticsearchStore) List(ctx context.Context, collection string) ([]Record, error) {
+	return s.ListPrefix(ctx, collection, "")
+}
+
+func (s *ElasticsearchStore) ListPrefix(ctx context.Context, collection, prefix string) ([]Record, error) {
+	filter := []interface{}{
+		map[string]interface{}{"term": map[string]interface{}{"collection": collection}},
+	}
+	if prefix != "" {
+		filter = append(filter, map[string]interface{}{"prefix": map[string]interface{}{"key": prefix}})
+	}
+	query := map[string]interface{}{
+		"size":  listPageSize,
+		"query": map[string]interface{}{"bool": map[string]interface{}{"filter": filter}},
+		"sort":  []interface{}{map[string]interface{}{"key": "asc"}},
+	}
+
+	records := []Record{}
+	for {
+		page, err := s.search(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, page...)
+		if len(page) < listPageSize {
+			return records, nil
+		}
+		// Keys are unique within a collection, so the last one marks where
+		// the next page starts.
+		query["search_after"] = []interface{}{page[len(page)-1].Key}
+	}
+}
+
+// search runs query against the config index and returns the records found.
+func (s *ElasticsearchStore) search(ctx context.Context, query map[string]interface{}) ([]Record, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(query); err != nil {
+		return nil, err
+	}
+	req := esapi.SearchRequest{
+		Index: []string{s.index},
+		Body:  &buf,
+	}
+	res, err := req.Do(ctx, s.transport)
+	if err != nil {
+		return nil, fmt.Errorf("error listing config records: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("error listing config records: %s", readBody(res))
+	}
+
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				Source Record `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		records = append(records, hit.Source)
+	}
+	return records, nil
+}
+
+func (s *ElasticsearchStore) Put(ctx context.Context, collection, key string, value []byte, expectedVersion int64) (int64, error) {
+	current, err := s.get(ctx, collection, key)
+	exists := err == nil
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return 0, err
+	}
+	if current.Version != expectedVersion {
+		return 0, versionConflict(collection, key, expectedVersion, current.Version)
+	}
+
+	version := expectedVersion + 1
+	body, err := json.Marshal(Record{
+		Collection: collection,
+		Key:        key,
+		Value:      json.RawMessage(value),
+		Version:    version,
+		UpdatedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req := esapi.IndexRequest{
+		Index:      s.index,
+		DocumentID: documentID(collection, key),
+		Body:       bytes.NewReader(body),
+		Refresh:    "wait_for",
+	}
+	if exists {
+		req.IfSeqNo = &current.seqNo
+		req.IfPrimaryTerm = &current.primaryTerm
+	} else {
+		req.OpType = "create"
+	}
+	res, err := req.Do(ctx, s.transport)
+	if err != nil {
+		return 0, fmt.Errorf("error writing config record: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusConflict {
+		return 0, concurrentWrite(collection, key)
+	}
+	if res.IsError() {
+		return 0, fmt.Errorf("error writing config record: %s", readBody(res))
+	}
+	return version, nil
+}
+
+func (s *ElasticsearchStore) Delete(ctx context.Context, collection, key string, expectedVersion int64) error {
+	current, err := s.get(ctx, collection, key)
+	if err != nil {
+		return err
+	}
+	if current.Version != expectedVersion {
+		return versionConflict(collection, key, expectedVersion, current.Version)
+	}
+
+	req := esapi.DeleteRequest{
+		Index:         s.index,
+		DocumentID:    documentID(collection, key),
+		IfSeqNo:       &current.seqNo,
+		IfPrimaryTerm: &current.primaryTerm,
+		Refresh:       "wait_for",
+	}
+	res, err := req.Do(ctx, s.transport)
+	if err != nil {
+		return fmt.Errorf("error deleting config record: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusConflict {
+		return concurrentWrite(collection, key)
+	}
+	if res.IsError() {
+		return fmt.Errorf("error deleting config record: %s", readBody(res))
+	}
+	return nil
+}
+
+func (s *ElasticsearchStore) Close() error {
+	return nil
+}
+
+// documentID returns the ID a record is stored under, escaped for the
+// request path: esapi writes document IDs into the URL as they are, so a key
+// holding "/" or "?" would otherwise address another endpoint.
+func documentID(collection, key string) string {
+	return url.PathEscape(collection + ":" + key)
+}
+
+func readBody(res *esapi.Response) string {
+	data, _ := io.ReadAll(res.Body)
+	return string(data)
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"elastic-search-config-service/store/storetest"
+)
+
+func newTestElasticsearchStore(t *testing.T) *ElasticsearchStore {
+	t.Helper()
+	s, err := NewElasticsearchStore(context.Background(), storetest.NewElasticsearch(), DefaultConfigIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestElasticsearchStoreKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{name: "plain key", key: "products"},
+		{name: "journal key", key: "products/42"},
+		{name: "quota key", key: "2026-10-19/key:reader/products"},
+		{name: "key with a query string", key: "products?refresh=true"},
+		{name: "key with an escaped slash", key: "products%2F42"},
+		{name: "key with a fragment", key: "products#42"},
+		{name: "key with spaces", key: "my products"},
+		{name: "key with dots", key: "../products"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newTestElasticsearchStore(t)
+			if _, err := s.Put(ctx, CollectionMigrationJournal, "orders/other", []byte(`{}`), 0); err != nil {
+				t.Fatal(err)
+			}
+
+			version, err := s.Put(ctx, CollectionMigrationJournal, tt.key, []byte(`{"n":1}`), 0)
+			if err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			if _, err := s.Put(ctx, CollectionMigrationJournal, tt.key, []byte(`{"n":1}`), 0); !errors.Is(err, ErrVersionConflict) {
+				t.Fatalf("second create: err = %v, want a version conflict", err)
+			}
+			if version, err = s.Put(ctx, CollectionMigrationJournal, tt.key, []byte(`{"n":2}`), version); err != nil {
+				t.Fatalf("update: %v", err)
+			}
+
+			rec, err := s.Get(ctx, CollectionMigrationJournal, tt.key)
+			if err != nil {
+				t.Fatalf("get: %v", err)
+			}
+			if rec.Key != tt.key || rec.Version != version || string(rec.Value) != `{"n":2}` {
+				t.Errorf("get = %s %d %s, want %s %d {\"n\":2}", rec.Key, rec.Version, rec.Value, tt.key, version)
+			}
+			records, err := s.ListPrefix(ctx, CollectionMigrationJournal, tt.key)
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			if len(records) != 1 || records[0].Key != tt.key {
+				t.Errorf("list by prefix %q = %v, want only the record", tt.key, records)
+			}
+
+			if err := s.Delete(ctx, CollectionMigrationJournal, tt.key, version); err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+			if _, err := s.Get(ctx, CollectionMigrationJournal, tt.key); !errors.Is(err, ErrNotFound) {
+				t.Errorf("get after delete: err = %v, want not found", err)
+			}
+			if _, err := s.Get(ctx, CollectionMigrationJournal, "orders/other"); err != nil {
+				t.Errorf("other record: %v", err)
+			}
+		})
+	}
+}
+
+func TestElasticsearchStoreListPrefix(t *testing.T) {
+	ctx := context.Background()
+	s := newTestElasticsearchStore(t)
+	put := func(collection, key string) {
+		t.Helper()
+		if _, err := s.Put(ctx, collection, key, []byte(`{}`), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// More records than a search returns at once, and more than a single
+	// search may return at all.
+	const journaled = 10050
+	for i := 0; i < journaled; i++ {
+		put(CollectionMigrationJournal, fmt.Sprintf("products/%05d", i))
+	}
+	put(CollectionMigrationJournal, "orders/1")
+	put(CollectionMigrationJournal, "products_v2/1")
+	put(CollectionQuotas, "products/1")
+
+	tests := []struct {
+		name       string
+		collection string
+		prefix     string
+		want       int
+	}{
+		{name: "every page of a prefix", collection: CollectionMigrationJournal, prefix: "products/", want: journaled},
+		{name: "other prefix", collection: CollectionMigrationJournal, prefix: "orders/", want: 1},
+		{name: "whole collection", collection: CollectionMigrationJournal, want: journaled + 2},
+		{name: "other collection", collection: CollectionQuotas, prefix: "products/", want: 1},
+		{name: "no match", collection: CollectionMigrationJournal, prefix: "missing/", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := s.ListPrefix(ctx, tt.collection, tt.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != tt.want {
+				t.Fatalf("got %d records, want %d", len(records), tt.want)
+			}
+			for i, rec := range records {
+				if i > 0 && rec.Key <= records[i-1].Key {
+					t.Fatalf("records not sorted by key: %s after %s", rec.Key, records[i-1].Key)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileStore keeps every collection in a single JSON file. Reads and writes
+// take an advisory lock on a sibling ".lock" file so that several processes
+// on the same host (or sharing a volume that honours flock) do not clobber
+// each other.
+type FileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+type fileContents map[string]map[string]Record
+
+// NewFileStore returns a store backed by path. The file is created lazily on
+// the first write.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+func (s *FileStore) Get(ctx context.Context, collection, key string) (Record, error) {
+	var rec Record
+	err := s.withLock(func() error {
+		contents, err := s.read()
+		if err != nil {
+			return err
+		}
+		r, ok := contents[collection][key]
+		if !ok {
+			return notFound(collection, key)
+		}
+		rec = r
+		return nil
+	})
+	return rec, err
+}
+
+func (s *FileStore) List(ctx context.Context, collection string) ([]Record, error) {
+	return s.ListPrefix(ctx, collection, "")
+}
+
+func (s *FileStore) ListPrefix(ctx context.Context, collection, prefix string) ([]Record, error) {
+	var records []Record
+	err := s.withLock(func() error {
+		contents, err := s.read()
+		if err != nil {
+			return err
+		}
+		for key, r := range contents[collection] {
+			if strings.HasPrefix(key, prefix) {
+				records = append(records, r)
+			}
+		}
+		return nil
+	})
+	sort.Slice(records, func(i, j int) bool { return records[i].Key < records[j].Key })
+	return records, err
+}
+
+func (s *FileStore) Put(ctx context.Context, collection, key string, value []byte, expectedVersion int64) (int64, error) {
+	var version int64
+	err := s.withLock(func() error {
+		contents, err := s.read()
+		if err != nil {
+			return err
+		}
+		current := contents[collection][key]
+		if current.Version != expectedVersion {
+			return versionConflict(collection, key, expectedVersion, current.Version)
+		}
+		if contents[collection] == nil {
+			contents[collection] = make(map[string]Record)
+		}
+		version = current.Version + 1
+		contents[collection][key] = Record{
+			Collection: collection,
+			Key:        key,
+			Value:      json.RawMessage(value),
+			Version:    version,
+			UpdatedAt:  time.Now().UTC(),
+		}
+		return s.write(contents)
+	})
+	return version, err
+}
+
+func (s *FileStore) Delete(ctx context.Context, collection, key string, expectedVersion int64) error {
+	return s.withLock(func() error {
+		contents, err := s.read()
+		if err != nil {
+			return err
+		}
+		current, ok := contents[collection][key]
+		if !ok {
+			return notFound(collection, key)
+		}
+		if current.Version != expectedVersion {
+			return versionConflict(collection, key, expectedVersion, current.Version)
+		}
+		delete(contents[collection], key)
+		return s.write(contents)
+	})
+}
+
+func (s *FileStore) Close() error {
+	return nil
+}
+
+func (s *FileStore) withLock(fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, err := os.OpenFile(s.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening config store lock: %w", err)
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("error locking config store: %w", err)
+	}
+	defer unlockFile(lock)
+
+	return fn()
+}
+
+func (s *FileStore) read() (fileContents, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return make(fileContents), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading config store: %w", err)
+	}
+	contents := make(fileContents)
+	if len(data) == 0 {
+		return contents, nil
+	}
+	if err := json.Unmarshal(data, &contents); err != nil {
+		return nil, fmt.Errorf("error unmarshaling config store: %w", err)
+	}
+	return contents, nil
+}
+
+// write replaces the file atomically so a crash never leaves it half written.
+func (s *FileStore) write(contents fileContents) error {
+	data, err := json.MarshalIndent(contents, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error marshaling config store: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error writing config store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing config store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing config store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("error writing config store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package store
+
+import "os"
+
+// Advisory locking is only implemented on unix; elsewhere FileStore is
+// limited to a single process.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
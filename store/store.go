@@ -0,0 +1,109 @@
+// Package store persists service configuration (mapping metadata, index
+// settings and similar documents) behind a small versioned key/value API so
+// that several replicas of the service can share state.
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Collections used by the service. Each collection is an independent key space.
+const (
+	CollectionMappings   = "mappings"
+	CollectionMigrations = "migrations"
+	CollectionAPIKeys    = "api_keys"
+	CollectionSettings   = "settings"
+	CollectionQuotas     = "quotas"
+	// CollectionSettingsHistory keeps every accepted version of the settings
+	// of each logical index, oldest first.
+	CollectionSettingsHistory = "settings_history"
+	// CollectionMigrationLeases holds one lease per logical index while a
+	// mapping migration of that index runs.
+	CollectionMigrationLeases = "migration_leases"
+	// CollectionMigrationJournal records, keyed by "<index>/<entry>", the
+	// documents written by each write request while a migration of their
+	// index runs.
+	CollectionMigrationJournal = "migration_journal"
+)
+
+var (
+	// ErrNotFound is returned when no record exists for a key.
+	ErrNotFound = errors.New("config record not found")
+	// ErrVersionConflict is returned when a write was made against a version
+	// that is no longer current.
+	ErrVersionConflict = errors.New("config record version conflict")
+)
+
+// Record is a stored configuration document. Version starts at 1 and is
+// incremented by every successful write.
+type Record struct {
+	Collection string          `json:"collection"`
+	Key        string          `json:"key"`
+	Value      json.RawMessage `json:"value"`
+	Version    int64           `json:"version"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// ConfigStore is implemented by every configuration backend.
+//
+// Writes use optimistic concurrency: Put and Delete only succeed when
+// expectedVersion matches the stored version, with 0 meaning "must not
+// exist yet". Callers read, modify and write back, retrying on
+// ErrVersionConflict.
+type ConfigStore interface {
+	Get(ctx context.Context, collection, key string) (Record, error)
+	List(ctx context.Context, collection string) ([]Record, error)
+	// ListPrefix returns the records of collection whose key starts with
+	// prefix, sorted by key.
+	ListPrefix(ctx context.Context, collection, prefix string) ([]Record, error)
+	Put(ctx context.Context, collection, key string, value []byte, expectedVersion int64) (int64, error)
+	Delete(ctx context.Context, collection, key string, expectedVersion int64) error
+	Close() error
+}
+
+func versionConflict(collection, key string, expected, actual int64) error {
+	return fmt.Errorf("%w: %s/%s expected version %d, found %d", ErrVersionConflict, collection, key, expected, actual)
+}
+
+func concurrentWrite(collection, key string) error {
+	return fmt.Errorf("%w: %s/%s was modified concurrently", ErrVersionConflict, collection, key)
+}
+
+func notFound(collection, key string) error {
+	return fmt.Errorf("%w: %s/%s", ErrNotFound, collection, key)
+}
+
+// Update reads the record at collection/key, applies fn to its value (nil if
+// the record does not exist) and writes the result back, retrying a few
+// times when another writer got there first.
+func Update(ctx context.Context, s ConfigStore, collection, key string, fn func(current []byte) ([]byte, error)) (int64, error) {
+	const attempts = 5
+	var err error
+	for i := 0; i < attempts; i++ {
+		var current Record
+		current, err = s.Get(ctx, collection, key)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return 0, err
+		}
+
+		var next []byte
+		next, err = fn(current.Value)
+		if err != nil {
+			return 0, err
+		}
+
+		var version int64
+		version, err = s.Put(ctx, collection, key, next, current.Version)
+		if err == nil {
+			return version, nil
+		}
+		if !errors.Is(err, ErrVersionConflict) {
+			return 0, err
+		}
+	}
+	return 0, err
+}
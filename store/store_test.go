@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// racingStore lets another writer update a record right before each of the
+// first races Puts, so that those Puts hit a version conflict.
+type racingStore struct {
+	ConfigStore
+	races int
+	puts  int
+}
+
+func (s *racingStore) Put(ctx context.Context, collection, key string, value []byte, expectedVersion int64) (int64, error) {
+	s.puts++
+	if s.races > 0 {
+		s.races--
+		current, err := s.ConfigStore.Get(ctx, collection, key)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return 0, err
+		}
+		if _, err := s.ConfigStore.Put(ctx, collection, key, []byte(`"other"`), current.Version); err != nil {
+			return 0, err
+		}
+	}
+	return s.ConfigStore.Put(ctx, collection, key, value, expectedVersion)
+}
+
+func TestUpdate(t *testing.T) {
+	errRefused := errors.New("refused")
+	tests := []struct {
+		name        string
+		existing    string
+		races       int
+		fnErr       error
+		wantErr     error
+		wantVersion int64
+		wantPuts    int
+	}{
+		{name: "creates missing record", wantVersion: 1, wantPuts: 1},
+		{name: "updates existing record", existing: `"old"`, wantVersion: 2, wantPuts: 1},
+		{name: "retries after a conflict", existing: `"old"`, races: 1, wantVersion: 3, wantPuts: 2},
+		{name: "retries until the last attempt", races: 4, wantVersion: 5, wantPuts: 5},
+		{name: "gives up after five conflicts", existing: `"old"`, races: 5, wantErr: ErrVersionConflict, wantPuts: 5},
+		{name: "returns the error of fn without writing", existing: `"old"`, fnErr: errRefused, wantErr: errRefused},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			file := NewFileStore(filepath.Join(t.TempDir(), "config.json"))
+			if tt.existing != "" {
+				if _, err := file.Put(ctx, CollectionMappings, "key", []byte(tt.existing), 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s := &racingStore{ConfigStore: file, races: tt.races}
+
+			calls := 0
+			version, err := Update(ctx, s, CollectionMappings, "key", func(current []byte) ([]byte, error) {
+				calls++
+				if tt.fnErr != nil {
+					return nil, tt.fnErr
+				}
+				return []byte(strconv.Itoa(calls)), nil
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if version != tt.wantVersion {
+				t.Errorf("version = %d, want %d", version, tt.wantVersion)
+			}
+			if s.puts != tt.wantPuts {
+				t.Errorf("puts = %d, want %d", s.puts, tt.wantPuts)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			rec, err := file.Get(ctx, CollectionMappings, "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := strconv.Itoa(calls); string(rec.Value) != want {
+				t.Errorf("stored value = %s, want %s", rec.Value, want)
+			}
+		})
+	}
+}
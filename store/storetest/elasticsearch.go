@@ -0,0 +1,261 @@
+// Package storetest provides an in-memory stand-in for the Elasticsearch
+// endpoints ElasticsearchStore relies on, so that code built on the store can
+// be tested without a cluster.
+package storetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Elasticsearch implements esapi.Transport for index creation, single
+// document get, index and delete with optimistic concurrency, and searches
+// filtering by term and prefix, sorted by one field with search_after. Like
+// the real cluster it decodes document IDs from the escaped request path, so
+// an ID that was not escaped reaches another endpoint.
+type Elasticsearch struct {
+	mu      sync.Mutex
+	indices map[string]map[string]document
+	seqNo   int64
+}
+
+type document struct {
+	source json.RawMessage
+	seqNo  int64
+}
+
+// NewElasticsearch returns a cluster without indices.
+func NewElasticsearch() *Elasticsearch {
+	return &Elasticsearch{indices: make(map[string]map[string]document)}
+}
+
+// Perform implements esapi.Transport.
+func (e *Elasticsearch) Perform(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	segments := strings.Split(strings.TrimPrefix(req.URL.EscapedPath(), "/"), "/")
+	switch {
+	case len(segments) == 1 && req.Method == http.MethodPut:
+		return e.createIndex(segments[0])
+	case len(segments) == 2 && segments[1] == "_search":
+		return e.search(segments[0], body)
+	case len(segments) == 3 && segments[1] == "_doc":
+		id, err := url.PathUnescape(segments[2])
+		if err != nil {
+			return respond(http.StatusBadRequest, errorBody("illegal_argument_exception", err.Error()))
+		}
+		switch req.Method {
+		case http.MethodGet:
+			return e.get(segments[0], id)
+		case http.MethodPut, http.MethodPost:
+			return e.index(segments[0], id, req.URL.Query(), body)
+		case http.MethodDelete:
+			return e.delete(segments[0], id, req.URL.Query())
+		}
+	}
+	return respond(http.StatusBadRequest, errorBody("illegal_argument_exception", "no handler found for uri ["+req.URL.EscapedPath()+"] and method ["+req.Method+"]"))
+}
+
+func (e *Elasticsearch) createIndex(index string) (*http.Response, error) {
+	if _, ok := e.indices[index]; ok {
+		return respond(http.StatusBadRequest, errorBody("resource_already_exists_exception", "index ["+index+"] already exists"))
+	}
+	e.indices[index] = make(map[string]document)
+	return respond(http.StatusOK, map[string]interface{}{"acknowledged": true, "index": index})
+}
+
+func (e *Elasticsearch) get(index, id string) (*http.Response, error) {
+	doc, ok := e.indices[index][id]
+	if !ok {
+		return respond(http.StatusNotFound, map[string]interface{}{"_index": index, "_id": id, "found": false})
+	}
+	return respond(http.StatusOK, map[string]interface{}{
+		"_index":        index,
+		"_id":           id,
+		"_seq_no":       doc.seqNo,
+		"_primary_term": 1,
+		"found":         true,
+		"_source":       doc.source,
+	})
+}
+
+func (e *Elasticsearch) index(index, id string, params url.Values, body []byte) (*http.Response, error) {
+	docs, ok := e.indices[index]
+	if !ok {
+		return respond(http.StatusNotFound, errorBody("index_not_found_exception", "no such index ["+index+"]"))
+	}
+	current, exists := docs[id]
+	if params.Get("op_type") == "create" && exists {
+		return respond(http.StatusConflict, errorBody("version_conflict_engine_exception", "document already exists"))
+	}
+	if conflict := seqNoConflict(params, current, exists); conflict {
+		return respond(http.StatusConflict, errorBody("version_conflict_engine_exception", "sequence number mismatch"))
+	}
+	e.seqNo++
+	docs[id] = document{source: body, seqNo: e.seqNo}
+	status, result := http.StatusOK, "updated"
+	if !exists {
+		status, result = http.StatusCreated, "created"
+	}
+	return respond(status, map[string]interface{}{"_index": index, "_id": id, "_seq_no": e.seqNo, "result": result})
+}
+
+func (e *Elasticsearch) delete(index, id string, params url.Values) (*http.Response, error) {
+	current, exists := e.indices[index][id]
+	if !exists {
+		return respond(http.StatusNotFound, map[string]interface{}{"_index": index, "_id": id, "result": "not_found"})
+	}
+	if seqNoConflict(params, current, exists) {
+		return respond(http.StatusConflict, errorBody("version_conflict_engine_exception", "sequence number mismatch"))
+	}
+	delete(e.indices[index], id)
+	return respond(http.StatusOK, map[string]interface{}{"_index": index, "_id": id, "result": "deleted"})
+}
+
+func seqNoConflict(params url.Values, current document, exists bool) bool {
+	value := params.Get("if_seq_no")
+	if value == "" {
+		return false
+	}
+	seqNo, err := strconv.ParseInt(value, 10, 64)
+	return err != nil || !exists || seqNo != current.seqNo
+}
+
+// searchRequest is the subset of the search API the fake understands.
+type searchRequest struct {
+	Size  *int `json:"size"`
+	Query struct {
+		Term map[string]string `json:"term"`
+		Bool struct {
+			Filter []map[string]map[string]string `json:"filter"`
+		} `json:"bool"`
+	} `json:"query"`
+	Sort        []map[string]string `json:"sort"`
+	SearchAfter []string            `json:"search_after"`
+}
+
+func (e *Elasticsearch) search(index string, body []byte) (*http.Response, error) {
+	docs, ok := e.indices[index]
+	if !ok {
+		return respond(http.StatusNotFound, errorBody("index_not_found_exception", "no such index ["+index+"]"))
+	}
+	var req searchRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return respond(http.StatusBadRequest, errorBody("parsing_exception", err.Error()))
+	}
+	filters := req.Query.Bool.Filter
+	if req.Query.Term != nil {
+		filters = append(filters, map[string]map[string]string{"term": req.Query.Term})
+	}
+	sortField := ""
+	if len(req.Sort) == 1 {
+		for field, order := range req.Sort[0] {
+			if order != "asc" {
+				return respond(http.StatusBadRequest, errorBody("illegal_argument_exception", "only ascending sorts are supported"))
+			}
+			sortField = field
+		}
+	}
+
+	type hit struct {
+		id     string
+		sortBy string
+		source json.RawMessage
+	}
+	var hits []hit
+	for id, doc := range docs {
+		var fields map[string]interface{}
+		if err := json.Unmarshal(doc.source, &fields); err != nil {
+			return nil, err
+		}
+		if !matches(fields, filters) {
+			continue
+		}
+		sortBy, _ := fields[sortField].(string)
+		if len(req.SearchAfter) == 1 && sortBy <= req.SearchAfter[0] {
+			continue
+		}
+		hits = append(hits, hit{id: id, sortBy: sortBy, source: doc.source})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].sortBy != hits[j].sortBy {
+			return hits[i].sortBy < hits[j].sortBy
+		}
+		return hits[i].id < hits[j].id
+	})
+	total := len(hits)
+	size := 10
+	if req.Size != nil {
+		size = *req.Size
+	}
+	if len(hits) > size {
+		hits = hits[:size]
+	}
+
+	out := make([]map[string]interface{}, 0, len(hits))
+	for _, h := range hits {
+		out = append(out, map[string]interface{}{"_index": index, "_id": h.id, "_source": h.source, "sort": []string{h.sortBy}})
+	}
+	return respond(http.StatusOK, map[string]interface{}{
+		"hits": map[string]interface{}{
+			"total": map[string]interface{}{"value": total, "relation": "eq"},
+			"hits":  out,
+		},
+	})
+}
+
+func matches(fields map[string]interface{}, filters []map[string]map[string]string) bool {
+	for _, filter := range filters {
+		for kind, clause := range filter {
+			for field, value := range clause {
+				actual, _ := fields[field].(string)
+				switch kind {
+				case "term":
+					if actual != value {
+						return false
+					}
+				case "prefix":
+					if !strings.HasPrefix(actual, value) {
+						return false
+					}
+				default:
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+func errorBody(kind, reason string) map[string]interface{} {
+	return map[string]interface{}{"error": map[string]interface{}{"type": kind, "reason": reason}}
+}
+
+func respond(status int, body interface{}) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding fake response: %w", err)
+	}
+	return &http.Response{
+		StatusCode: status,
+		Status:     strconv.Itoa(status) + " " + http.StatusText(status),
+		Header:     http.Header{"Content-Type": []string{"application/json"}, "X-Elastic-Product": []string{"Elasticsearch"}},
+		Body:       io.NopCloser(bytes.NewReader(data)),
+	}, nil
+}